@@ -0,0 +1,295 @@
+package camtest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// bpmnDefinitions the parsed part of a BPMN 2.0 XML document
+type bpmnDefinitions struct {
+	Messages []struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"name,attr"`
+	} `xml:"message"`
+	Errors []struct {
+		ID        string `xml:"id,attr"`
+		ErrorCode string `xml:"errorCode,attr"`
+	} `xml:"error"`
+	Processes []struct {
+		ID       string        `xml:"id,attr"`
+		Name     string        `xml:"name,attr"`
+		Elements []bpmnElement `xml:",any"`
+	} `xml:"process"`
+}
+
+// bpmnElement an element of a process, the attributes of all supported types
+type bpmnElement struct {
+	XMLName        xml.Name
+	ID             string `xml:"id,attr"`
+	Name           string `xml:"name,attr"`
+	Type           string `xml:"type,attr"`
+	Topic          string `xml:"topic,attr"`
+	TaskPriority   string `xml:"taskPriority,attr"`
+	Assignee       string `xml:"assignee,attr"`
+	MessageRef     string `xml:"messageRef,attr"`
+	Default        string `xml:"default,attr"`
+	AttachedToRef  string `xml:"attachedToRef,attr"`
+	CancelActivity string `xml:"cancelActivity,attr"`
+	SourceRef      string `xml:"sourceRef,attr"`
+	TargetRef      string `xml:"targetRef,attr"`
+
+	ConditionExpression *struct {
+		Text string `xml:",chardata"`
+	} `xml:"conditionExpression"`
+	MessageEventDefinition *struct {
+		MessageRef string `xml:"messageRef,attr"`
+	} `xml:"messageEventDefinition"`
+	ErrorEventDefinition *struct {
+		ErrorRef string `xml:"errorRef,attr"`
+	} `xml:"errorEventDefinition"`
+	TerminateEventDefinition *struct{} `xml:"terminateEventDefinition"`
+	TimerEventDefinition     *struct{} `xml:"timerEventDefinition"`
+	SignalEventDefinition    *struct{} `xml:"signalEventDefinition"`
+}
+
+// ignoredElements the elements of a process without runtime behavior
+var ignoredElements = map[string]bool{
+	"documentation":       true,
+	"extensionElements":   true,
+	"laneSet":             true,
+	"textAnnotation":      true,
+	"association":         true,
+	"group":               true,
+	"dataObject":          true,
+	"dataObjectReference": true,
+	"dataStoreReference":  true,
+	"property":            true,
+	"ioSpecification":     true,
+}
+
+// node a flow node of a process
+type node struct {
+	ID   string
+	Name string
+	// Kind the BPMN element name, e.g. serviceTask
+	Kind string
+	// ActivityType the type of the activity instances like the history of the engine, e.g. noneEndEvent
+	ActivityType string
+	// Topic the topic of an external service task
+	Topic    string
+	Priority int
+	Assignee string
+	// Message the name of the message of a catch event, receive task or message start event
+	Message string
+	// ErrorCode the code caught by an error boundary event, empty catches all errors
+	ErrorCode string
+	Terminate bool
+	// Default the default flow of an exclusive gateway
+	Default    *flow
+	Incoming   []*flow
+	Outgoing   []*flow
+	Boundaries []*node
+}
+
+// flow a sequence flow
+type flow struct {
+	ID        string
+	Source    *node
+	Target    *node
+	Condition string
+}
+
+// process a parsed executable process
+type process struct {
+	ID    string
+	Name  string
+	Nodes map[string]*node
+	// Order the nodes in document order
+	Order []*node
+	// Starts the start events in document order
+	Starts []*node
+	Flows  []*flow
+}
+
+// parseProcess parses the process of the key from the BPMN 2.0 XML, an error if it has unsupported elements
+func parseProcess(data []byte, key string) (*process, error) {
+	procs, err := parseModel(data, key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(procs) == 0 {
+		return nil, fmt.Errorf("process %s not found", key)
+	}
+
+	return procs[0], nil
+}
+
+// parseModel parses the processes of the BPMN 2.0 XML, all processes if the key is empty.
+// Unsupported elements are errors if strict, otherwise nodes without behavior
+func parseModel(data []byte, key string, strict bool) ([]*process, error) {
+	var defs bpmnDefinitions
+	if err := xml.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("cannot parse BPMN: %w", err)
+	}
+
+	messages := make(map[string]string, len(defs.Messages))
+	for _, m := range defs.Messages {
+		messages[m.ID] = m.Name
+	}
+
+	errorCodes := make(map[string]string, len(defs.Errors))
+	for _, e := range defs.Errors {
+		errorCodes[e.ID] = e.ErrorCode
+	}
+
+	var procs []*process
+	for _, p := range defs.Processes {
+		if key != "" && p.ID != key {
+			continue
+		}
+
+		proc := &process{ID: p.ID, Name: p.Name, Nodes: make(map[string]*node)}
+
+		var flows, boundaries []bpmnElement
+		for _, el := range p.Elements {
+			switch kind := el.XMLName.Local; {
+			case ignoredElements[kind]:
+			case kind == "sequenceFlow":
+				flows = append(flows, el)
+			default:
+				n, err := newNode(el, messages, errorCodes)
+				if err != nil && strict {
+					return nil, fmt.Errorf("process %s: %w", p.ID, err)
+				} else if err != nil {
+					n = &node{ID: el.ID, Name: el.Name, Kind: kind, ActivityType: kind}
+				}
+
+				proc.Nodes[n.ID] = n
+				proc.Order = append(proc.Order, n)
+				switch kind {
+				case "startEvent":
+					proc.Starts = append(proc.Starts, n)
+				case "boundaryEvent":
+					boundaries = append(boundaries, el)
+				}
+			}
+		}
+
+		for _, el := range boundaries {
+			attached := proc.Nodes[el.AttachedToRef]
+			if attached == nil {
+				return nil, fmt.Errorf("process %s: boundary event %s is attached to unknown activity %s", p.ID, el.ID, el.AttachedToRef)
+			}
+			attached.Boundaries = append(attached.Boundaries, proc.Nodes[el.ID])
+		}
+
+		for _, el := range flows {
+			f := &flow{ID: el.ID, Source: proc.Nodes[el.SourceRef], Target: proc.Nodes[el.TargetRef]}
+			if f.Source == nil || f.Target == nil {
+				return nil, fmt.Errorf("process %s: sequence flow %s connects unknown elements", p.ID, el.ID)
+			}
+
+			if el.ConditionExpression != nil {
+				f.Condition = strings.TrimSpace(el.ConditionExpression.Text)
+			}
+
+			f.Source.Outgoing = append(f.Source.Outgoing, f)
+			f.Target.Incoming = append(f.Target.Incoming, f)
+			proc.Flows = append(proc.Flows, f)
+		}
+
+		for _, el := range p.Elements {
+			if el.Default != "" {
+				for _, f := range proc.Flows {
+					if f.ID == el.Default {
+						proc.Nodes[el.ID].Default = f
+					}
+				}
+			}
+		}
+
+		procs = append(procs, proc)
+	}
+
+	return procs, nil
+}
+
+// newNode creates the node of a flow element, an error if the element is not supported
+func newNode(el bpmnElement, messages, errorCodes map[string]string) (*node, error) {
+	n := &node{ID: el.ID, Name: el.Name, Kind: el.XMLName.Local}
+
+	unsupported := func() (*node, error) {
+		return nil, fmt.Errorf("element %s of type %s is not supported", el.ID, n.Kind)
+	}
+
+	if el.TimerEventDefinition != nil || el.SignalEventDefinition != nil {
+		return unsupported()
+	}
+
+	switch n.Kind {
+	case "startEvent":
+		n.ActivityType = "startEvent"
+		if el.MessageEventDefinition != nil {
+			n.ActivityType = "messageStartEvent"
+			n.Message = messages[el.MessageEventDefinition.MessageRef]
+		} else if el.ErrorEventDefinition != nil {
+			return unsupported()
+		}
+	case "endEvent":
+		switch {
+		case el.TerminateEventDefinition != nil:
+			n.ActivityType = "terminateEndEvent"
+			n.Terminate = true
+		case el.MessageEventDefinition != nil, el.ErrorEventDefinition != nil:
+			return unsupported()
+		default:
+			n.ActivityType = "noneEndEvent"
+		}
+	case "serviceTask", "sendTask", "businessRuleTask":
+		if el.Type != "external" || el.Topic == "" {
+			return nil, fmt.Errorf("%s %s is not an external task with a topic", n.Kind, el.ID)
+		}
+		n.ActivityType = n.Kind
+		n.Topic = el.Topic
+		if el.TaskPriority != "" {
+			if _, err := fmt.Sscan(el.TaskPriority, &n.Priority); err != nil {
+				return nil, fmt.Errorf("invalid task priority of %s: %s", el.ID, el.TaskPriority)
+			}
+		}
+	case "userTask":
+		n.ActivityType = "userTask"
+		n.Assignee = el.Assignee
+	case "receiveTask":
+		n.ActivityType = "receiveTask"
+		n.Message = messages[el.MessageRef]
+	case "intermediateCatchEvent":
+		if el.MessageEventDefinition == nil {
+			return unsupported()
+		}
+		n.ActivityType = "intermediateMessageCatch"
+		n.Message = messages[el.MessageEventDefinition.MessageRef]
+	case "intermediateThrowEvent":
+		if el.MessageEventDefinition != nil || el.ErrorEventDefinition != nil {
+			return unsupported()
+		}
+		n.ActivityType = "intermediateNoneThrowEvent"
+	case "boundaryEvent":
+		if el.ErrorEventDefinition == nil {
+			return unsupported()
+		}
+		n.ActivityType = "boundaryError"
+		n.ErrorCode = errorCodes[el.ErrorEventDefinition.ErrorRef]
+	case "exclusiveGateway", "parallelGateway", "task", "manualTask":
+		n.ActivityType = n.Kind
+	default:
+		return unsupported()
+	}
+
+	if (n.Kind == "receiveTask" || n.Kind == "intermediateCatchEvent") && n.Message == "" {
+		return nil, fmt.Errorf("%s %s has no message", n.Kind, el.ID)
+	}
+
+	return n, nil
+}
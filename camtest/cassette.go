@@ -0,0 +1,404 @@
+package camtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/interticketinc/camunda/internal/redact"
+)
+
+// RecorderMode a mode of a Recorder
+type RecorderMode int
+
+const (
+	// ModeReplay replays the responses of the cassette, an unmatched request fails the test when it finishes
+	ModeReplay RecorderMode = iota
+	// ModeRecord sends the requests to the engine and saves the interactions to the cassette after the test
+	ModeRecord
+)
+
+// RecorderOptions options of a Recorder
+type RecorderOptions struct {
+	// Mode record or replay (default: ModeReplay)
+	Mode RecorderMode
+	// Transport sends the requests in ModeRecord (default: http.DefaultTransport)
+	Transport http.RoundTripper
+	// RedactHeaders the headers whose values are not saved, in addition to Authorization, Cookie and Set-Cookie
+	RedactHeaders []string
+	// RedactVariables the names of the variables whose values are not saved in the bodies, "*" for all variables.
+	// The requests are redacted the same way before matching
+	RedactVariables []string
+	// Match the matching of the requests in ModeReplay
+	Match MatchOptions
+}
+
+// MatchOptions the parts of a request compared with the recorded requests.
+// The method and the path are always compared
+type MatchOptions struct {
+	// IgnoreQuery matches any query string
+	IgnoreQuery bool
+	// IgnoreQueryParams the query parameters not compared
+	IgnoreQueryParams []string
+	// Body compares JSON bodies as JSON values, other bodies e.g. deployments are not compared
+	Body bool
+	// IgnoreBodyFields the top level fields of the JSON bodies not compared, e.g. workerId
+	IgnoreBodyFields []string
+	// Repeat replays the last matching interaction again when all matching interactions were used,
+	// e.g. for polling requests
+	Repeat bool
+}
+
+// Interaction a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest a request of an interaction
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	// Body a JSON body
+	Body json.RawMessage `json:"body,omitempty"`
+	// Text a body which is not JSON
+	Text string `json:"text,omitempty"`
+}
+
+// RecordedResponse a response of an interaction
+type RecordedResponse struct {
+	Status  int             `json:"status"`
+	Headers http.Header     `json:"headers,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	Text    string          `json:"text,omitempty"`
+}
+
+// cassette the file format of the recorded interactions
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder an http.RoundTripper recording the engine interactions of a test to a cassette file
+// and replaying them, use it with camunda.Client.SetCustomTransport
+type Recorder struct {
+	t    testing.TB
+	path string
+	opts RecorderOptions
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	unmatched    []RecordedRequest
+}
+
+// NewRecorder creates a recorder of the cassette file. In ModeReplay the cassette is loaded, a missing cassette
+// fails the test. In ModeRecord the cassette is written when the test finishes
+func NewRecorder(t testing.TB, path string, opts RecorderOptions) *Recorder {
+	t.Helper()
+
+	r := &Recorder{t: t, path: path, opts: opts}
+
+	if opts.Mode == ModeRecord {
+		t.Cleanup(func() {
+			if err := r.save(); err != nil {
+				t.Errorf("cannot save cassette: %s", err)
+			}
+		})
+
+		return r
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot load cassette: %s", err)
+	}
+
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("cannot parse cassette %s: %s", path, err)
+	}
+
+	r.interactions = c.Interactions
+	r.used = make([]bool, len(c.Interactions))
+
+	// the requests may be sent by goroutines outliving the test, the unmatched ones are reported at its end
+	t.Cleanup(func() {
+		for _, req := range r.Unmatched() {
+			t.Errorf("camtest: no recorded interaction of %s matches %s", path, req)
+		}
+	})
+
+	return r
+}
+
+// Interactions returns the recorded or loaded interactions
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]Interaction, 0, len(r.interactions))
+	for _, i := range r.interactions {
+		res = append(res, *i)
+	}
+
+	return res
+}
+
+// Unused returns the loaded interactions not replayed
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []Interaction
+	for i, used := range r.used {
+		if !used {
+			res = append(res, *r.interactions[i])
+		}
+	}
+
+	return res
+}
+
+// Unmatched returns the requests not matching any loaded interaction
+func (r *Recorder) Unmatched() []RecordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RecordedRequest(nil), r.unmatched...)
+}
+
+// RoundTrip records or replays the request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := RecordedRequest{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Query:   req.URL.RawQuery,
+		Headers: redact.Headers(req.Header, r.opts.RedactHeaders),
+	}
+	rec.Body, rec.Text = r.redactBody(body)
+
+	if r.opts.Mode == ModeRecord {
+		return r.record(req, rec)
+	}
+
+	return r.replay(req, rec)
+}
+
+func (r *Recorder) record(req *http.Request, rec RecordedRequest) (*http.Response, error) {
+	transport := r.opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	i := &Interaction{
+		Request: rec,
+		Response: RecordedResponse{
+			Status:  res.StatusCode,
+			Headers: redact.Headers(res.Header, r.opts.RedactHeaders),
+		},
+	}
+	i.Response.Body, i.Response.Text = r.redactBody(body)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, i)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+func (r *Recorder) replay(req *http.Request, rec RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := -1
+	for n, i := range r.interactions {
+		if !r.matches(&rec, &i.Request) {
+			continue
+		}
+
+		if !r.used[n] {
+			r.used[n] = true
+			return response(req, &i.Response), nil
+		}
+
+		last = n
+	}
+
+	if r.opts.Match.Repeat && last >= 0 {
+		return response(req, &r.interactions[last].Response), nil
+	}
+
+	r.unmatched = append(r.unmatched, rec)
+
+	return nil, fmt.Errorf("camtest: no recorded interaction of %s matches %s", r.path, rec)
+}
+
+// matches compares the request with a recorded request
+func (r *Recorder) matches(req, rec *RecordedRequest) bool {
+	if req.Method != rec.Method || req.Path != rec.Path {
+		return false
+	}
+
+	if !r.opts.Match.IgnoreQuery && r.query(req.Query) != r.query(rec.Query) {
+		return false
+	}
+
+	if !r.opts.Match.Body || req.Body == nil || rec.Body == nil {
+		return true
+	}
+
+	return reflect.DeepEqual(r.bodyValue(req.Body), r.bodyValue(rec.Body))
+}
+
+// query returns the normalized query string without the ignored parameters
+func (r *Recorder) query(raw string) string {
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+
+	for _, name := range r.opts.Match.IgnoreQueryParams {
+		q.Del(name)
+	}
+
+	return q.Encode()
+}
+
+// bodyValue returns the JSON value of the body without the ignored fields
+func (r *Recorder) bodyValue(body json.RawMessage) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, name := range r.opts.Match.IgnoreBodyFields {
+			delete(m, name)
+		}
+	}
+
+	return v
+}
+
+// redactBody returns a JSON body with the values of the redacted variables replaced, or the text of other bodies
+func (r *Recorder) redactBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, string(body)
+	}
+
+	if len(r.opts.RedactVariables) > 0 {
+		redact.JSONVariables(v, r.opts.RedactVariables)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, string(body)
+	}
+
+	return data, ""
+}
+
+// save writes the recorded interactions to the cassette
+func (r *Recorder) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(&cassette{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0644)
+}
+
+// readRequestBody reads the body of the request and replaces it for sending
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// response creates the response of a recorded response
+func response(req *http.Request, rec *RecordedResponse) *http.Response {
+	body := []byte(rec.Text)
+	if rec.Body != nil {
+		body = rec.Body
+	}
+
+	header := rec.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// String describes the request, e.g. in test failures
+func (r RecordedRequest) String() string {
+	s := r.Method + " " + r.Path
+	if r.Query != "" {
+		s += "?" + r.Query
+	}
+
+	if r.Body != nil {
+		s += " " + strings.TrimSpace(string(r.Body))
+	}
+
+	return s
+}
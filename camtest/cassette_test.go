@@ -0,0 +1,124 @@
+package camtest_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestRecorder(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	opts := camtest.RecorderOptions{
+		RedactVariables: []string{"password"},
+		Match:           camtest.MatchOptions{Body: true, IgnoreBodyFields: []string{"workerId"}},
+	}
+
+	run := func(t testing.TB, endpoint string, rt *camtest.Recorder) (string, error) {
+		client := camunda.NewClient(&camunda.ClientOptions{EndpointUrl: endpoint, ApiUser: "demo", ApiPassword: "secret"})
+		client.SetCustomTransport(rt)
+		tm := client.TaskManager()
+
+		tasks, err := tm.FetchAndLock(camunda.FetchAndLockRequest{
+			WorkerID: "worker-" + time.Now().Format(time.RFC3339Nano),
+			MaxTasks: 1,
+			Topics:   []*camunda.TopicLockConfig{{TopicName: "test-topic", LockDuration: 60000}},
+		})
+		if err != nil || len(tasks) != 1 {
+			t.Fatalf("cannot fetch: %d tasks, %v", len(tasks), err)
+		}
+
+		workerID := tasks[0].WorkerID
+		return tasks[0].ID, tm.Complete(tasks[0].ID, camunda.QueryComplete{
+			WorkerID:  &workerID,
+			Variables: camunda.Variables{"password": {Value: "hunter2", Type: "String"}},
+		})
+	}
+
+	var recorded string
+	t.Run("record", func(t *testing.T) {
+		e := fakeengine.New()
+		defer e.Close()
+		e.AddExternalTask(fakeengine.ExternalTask{TopicName: "test-topic"})
+
+		record := opts
+		record.Mode = camtest.ModeRecord
+
+		id, err := run(t, e.URL(), camtest.NewRecorder(t, cassette, record))
+		if err != nil {
+			t.Fatalf("cannot complete: %s", err)
+		}
+		recorded = id
+	})
+
+	data, err := ioutil.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("cassette not saved: %s", err)
+	}
+
+	for _, secret := range []string{"hunter2", "Basic "} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		id, err := run(t, "http://127.0.0.1:1/engine-rest", camtest.NewRecorder(t, cassette, opts))
+		if err != nil {
+			t.Fatalf("cannot complete: %s", err)
+		}
+
+		if id != recorded {
+			t.Errorf("replayed task %s, want %s", id, recorded)
+		}
+	})
+
+	t.Run("unmatched", func(t *testing.T) {
+		tb := &failingTB{TB: t}
+		client := camunda.NewClient(&camunda.ClientOptions{EndpointUrl: "http://127.0.0.1:1/engine-rest"})
+		rec := camtest.NewRecorder(tb, cassette, opts)
+		client.SetCustomTransport(rec)
+
+		workerID := "test-worker"
+		err := client.TaskManager().Complete("other-task", camunda.QueryComplete{WorkerID: &workerID})
+		if err == nil || len(rec.Unmatched()) != 1 {
+			t.Fatalf("unmatched request not returned as an error: %v", err)
+		}
+
+		if tb.failed {
+			t.Error("unmatched request failed the test before it finished")
+		}
+
+		tb.cleanup()
+		if !tb.failed {
+			t.Error("unmatched request did not fail the test")
+		}
+	})
+}
+
+// failingTB records the failures and the cleanups instead of failing the test
+type failingTB struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+}
+
+func (tb *failingTB) Cleanup(f func()) {
+	tb.cleanups = append(tb.cleanups, f)
+}
+
+// cleanup runs the cleanups like at the end of the test
+func (tb *failingTB) cleanup() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func (tb *failingTB) Errorf(format string, args ...interface{}) {
+	tb.failed = true
+}
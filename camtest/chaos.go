@@ -0,0 +1,239 @@
+package camtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjected the default connection error of an injected fault
+var ErrInjected = errors.New("camtest: injected connection error")
+
+// operations the Camunda operations recognized by the path of a request, the first match wins
+var operations = []struct {
+	name   string
+	method string
+	path   *regexp.Regexp
+}{
+	{"fetchAndLock", http.MethodPost, regexp.MustCompile(`/external-task/fetchAndLock$`)},
+	{"complete", http.MethodPost, regexp.MustCompile(`/external-task/[^/]+/complete$`)},
+	{"handleFailure", http.MethodPost, regexp.MustCompile(`/external-task/[^/]+/failure$`)},
+	{"handleBpmnError", http.MethodPost, regexp.MustCompile(`/external-task/[^/]+/bpmnError$`)},
+	{"extendLock", http.MethodPost, regexp.MustCompile(`/external-task/[^/]+/extendLock$`)},
+	{"unlock", http.MethodPost, regexp.MustCompile(`/external-task/[^/]+/unlock$`)},
+	{"startInstance", http.MethodPost, regexp.MustCompile(`/process-definition/.+/start$`)},
+	{"completeTask", http.MethodPost, regexp.MustCompile(`/task/[^/]+/complete$`)},
+	{"correlate", http.MethodPost, regexp.MustCompile(`/message$`)},
+	{"deploy", http.MethodPost, regexp.MustCompile(`/deployment/create$`)},
+}
+
+// Operation returns the name of the Camunda operation of the request, e.g. fetchAndLock, complete,
+// handleFailure, handleBpmnError, extendLock, unlock, startInstance, completeTask, correlate or deploy,
+// empty for other requests
+func Operation(req *http.Request) string {
+	for _, op := range operations {
+		if req.Method == op.method && op.path.MatchString(req.URL.Path) {
+			return op.name
+		}
+	}
+
+	return ""
+}
+
+// Fault a fault injected into a request, the latency is added before the other faults
+type Fault struct {
+	// Latency delays the request
+	Latency time.Duration
+	// Err fails the request like a connection error without sending it, e.g. ErrInjected
+	Err error
+	// Status responds with the status without sending the request
+	Status int
+	// Body the body of the Status response (default: a JSON engine exception)
+	Body string
+	// MalformedJSON sends the request and truncates the JSON body of the response
+	MalformedJSON bool
+}
+
+// ChaosRule injects faults into the requests of an operation
+type ChaosRule struct {
+	// Operation the operation of the requests as returned by Operation, empty matches all requests
+	Operation string
+	// Match selects the requests additionally, optional
+	Match func(req *http.Request) bool
+	// Sequence the faults of the consecutive matching requests, a nil fault passes a request through.
+	// The requests after the sequence pass through unless Repeat is set
+	Sequence []*Fault
+	// Repeat restarts the sequence at its end
+	Repeat bool
+	// Probability injects Fault into a matching request with the probability if Sequence is empty
+	Probability float64
+	Fault       Fault
+}
+
+// Injection a fault injected into a request
+type Injection struct {
+	Operation string
+	Method    string
+	Path      string
+	Fault     Fault
+}
+
+// Chaos an http.RoundTripper injecting faults into the requests to the engine, use it with
+// camunda.Client.SetCustomTransport. A request is handled by the first rule matching it
+type Chaos struct {
+	transport http.RoundTripper
+	rules     []*ChaosRule
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	counts   []int
+	injected []Injection
+}
+
+// NewChaos creates a chaos transport sending the requests with the transport (default: http.DefaultTransport),
+// the seed makes the probabilities reproducible
+func NewChaos(transport http.RoundTripper, seed int64, rules ...*ChaosRule) *Chaos {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &Chaos{
+		transport: transport,
+		rules:     rules,
+		rand:      rand.New(rand.NewSource(seed)),
+		counts:    make([]int, len(rules)),
+	}
+}
+
+// Injected returns the faults injected so far
+func (c *Chaos) Injected() []Injection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Injection(nil), c.injected...)
+}
+
+// RoundTrip sends the request with the fault of the matching rule
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := Operation(req)
+
+	fault := c.fault(req, op)
+	if fault == nil {
+		return c.transport.RoundTrip(req)
+	}
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch {
+	case fault.Err != nil:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fault.Err
+	case fault.Status != 0:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return faultResponse(req, fault), nil
+	}
+
+	res, err := c.transport.RoundTrip(req)
+	if err != nil || !fault.MalformedJSON {
+		return res, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	body = body[:len(body)/2]
+	if len(body) == 0 {
+		body = []byte("{")
+	}
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Del("Content-Length")
+
+	return res, nil
+}
+
+// fault returns the fault of the first rule matching the request, nil to pass it through
+func (c *Chaos) fault(req *http.Request, op string) *Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, rule := range c.rules {
+		if rule.Operation != "" && rule.Operation != op || rule.Match != nil && !rule.Match(req) {
+			continue
+		}
+
+		var fault *Fault
+		if len(rule.Sequence) > 0 {
+			n := c.counts[i]
+			c.counts[i]++
+
+			if rule.Repeat {
+				n %= len(rule.Sequence)
+			}
+
+			if n < len(rule.Sequence) {
+				fault = rule.Sequence[n]
+			}
+		} else if c.rand.Float64() < rule.Probability {
+			fault = &rule.Fault
+		}
+
+		if fault != nil {
+			c.injected = append(c.injected, Injection{Operation: op, Method: req.Method, Path: req.URL.Path, Fault: *fault})
+		}
+
+		return fault
+	}
+
+	return nil
+}
+
+// faultResponse creates the response of a status fault
+func faultResponse(req *http.Request, fault *Fault) *http.Response {
+	body := fault.Body
+	if body == "" {
+		body = fmt.Sprintf(`{"type":"ProcessEngineException","message":"injected fault: %s"}`, http.StatusText(fault.Status))
+	}
+
+	header := http.Header{}
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		header.Set("Content-Type", "application/json")
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fault.Status, http.StatusText(fault.Status)),
+		StatusCode:    fault.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
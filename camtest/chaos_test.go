@@ -0,0 +1,157 @@
+package camtest_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+	"github.com/interticketinc/camunda/worker"
+)
+
+func TestChaos(t *testing.T) {
+	e := fakeengine.New()
+	defer e.Close()
+	e.AddExternalTask(fakeengine.ExternalTask{TopicName: "test-topic"})
+
+	chaos := camtest.NewChaos(nil, 1,
+		&camtest.ChaosRule{
+			Operation: "fetchAndLock",
+			Sequence: []*camtest.Fault{
+				{Status: http.StatusInternalServerError},
+				{Err: camtest.ErrInjected, Latency: 20 * time.Millisecond},
+				{MalformedJSON: true},
+			},
+		},
+		&camtest.ChaosRule{Operation: "complete", Probability: 1, Fault: camtest.Fault{Status: http.StatusServiceUnavailable}},
+	)
+
+	client := e.Client()
+	client.SetCustomTransport(chaos)
+	tm := client.TaskManager()
+
+	fetch := func() error {
+		_, err := tm.FetchAndLock(camunda.FetchAndLockRequest{
+			WorkerID: "test-worker",
+			MaxTasks: 1,
+			Topics:   []*camunda.TopicLockConfig{{TopicName: "test-topic", LockDuration: 60000}},
+		})
+		return err
+	}
+
+	var engineErr *camunda.Error
+	if err := fetch(); !errors.As(err, &engineErr) || engineErr.Type != "ProcessEngineException" {
+		t.Errorf("status fault: got %v, want an engine exception", err)
+	}
+
+	start := time.Now()
+	if err := fetch(); !errors.Is(err, camtest.ErrInjected) {
+		t.Errorf("connection fault: got %v, want %v", err, camtest.ErrInjected)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("latency not injected")
+	}
+
+	if err := fetch(); err == nil {
+		t.Errorf("malformed JSON fault: fetched without error")
+	}
+
+	if err := fetch(); err != nil {
+		t.Errorf("request after the sequence: %s", err)
+	}
+
+	workerID := "test-worker"
+	if err := tm.Complete(e.ExternalTasks()[0].ID, camunda.QueryComplete{WorkerID: &workerID}); err == nil {
+		t.Errorf("complete: no error injected")
+	}
+
+	injected := chaos.Injected()
+	if len(injected) != 4 || injected[0].Operation != "fetchAndLock" || injected[3].Operation != "complete" {
+		t.Errorf("unexpected injections %+v", injected)
+	}
+}
+
+// fetchObserver records the start times of the fetches and the backoff delays of a worker
+type fetchObserver struct {
+	worker.NopObserver
+
+	mu       sync.Mutex
+	fetches  []time.Time
+	backoffs []time.Duration
+}
+
+func (o *fetchObserver) FetchStarted([]string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.fetches = append(o.fetches, time.Now())
+}
+
+func (o *fetchObserver) BackoffEntered(_ []string, delay time.Duration, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.backoffs = append(o.backoffs, delay)
+}
+
+func TestChaos_workerRecovers(t *testing.T) {
+	e := fakeengine.New()
+	defer e.Close()
+
+	chaos := camtest.NewChaos(nil, 1, &camtest.ChaosRule{
+		Operation: "fetchAndLock",
+		Sequence: []*camtest.Fault{
+			{Status: http.StatusInternalServerError},
+			{Err: camtest.ErrInjected},
+		},
+	})
+
+	client := e.Client()
+	client.SetCustomTransport(chaos)
+
+	obs := &fetchObserver{}
+	w := worker.New(client, &worker.Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: 100 * time.Millisecond,
+		Observer:           obs,
+	})
+	defer w.Stop()
+
+	task := e.AddExternalTask(fakeengine.ExternalTask{TopicName: "ship"})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx worker.Context) error {
+		return ctx.Complete(&worker.TaskComplete{})
+	})
+
+	waitFor(t, "the task to be completed after the faults", func() bool {
+		for _, et := range e.ExternalTasks() {
+			if et.ID == task.ID {
+				return et.State == fakeengine.TaskCompleted
+			}
+		}
+
+		return false
+	})
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	// the delay grows with each failed fetch, and no fetch is sent before the delay is over
+	want := []time.Duration{time.Second, 2 * time.Second}
+	if len(obs.backoffs) != len(want) || obs.backoffs[0] != want[0] || obs.backoffs[1] != want[1] {
+		t.Fatalf("expected the backoffs %v, got %v", want, obs.backoffs)
+	}
+
+	for i, delay := range want {
+		if gap := obs.fetches[i+1].Sub(obs.fetches[i]); gap < delay {
+			t.Errorf("fetch %d sent %s after the failed fetch, expected a backoff of %s", i+2, gap, delay)
+		}
+	}
+
+	if injected := chaos.Injected(); len(injected) != 2 {
+		t.Errorf("expected 2 injected faults, got %+v", injected)
+	}
+}
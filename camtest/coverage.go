@@ -0,0 +1,354 @@
+package camtest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// Coverage collects the flow node and sequence flow coverage of BPMN processes from executed activity instances.
+// The engine does not record the taken sequence flows, a flow is covered if its target was entered after its source
+// ended in the same process instance, the source ended last if the target has several incoming flows
+type Coverage struct {
+	models []*coverageModel
+	// activities the activity instances by process definition key and process instance id
+	activities map[string]map[string][]activityRecord
+}
+
+// coverageModel a process and its diagram
+type coverageModel struct {
+	proc   *process
+	shapes map[string]bounds
+	edges  map[string][]point
+}
+
+// activityRecord an executed activity instance
+type activityRecord struct {
+	activityID string
+	start      time.Time
+	end        time.Time
+	canceled   bool
+}
+
+// bpmnDiagram the BPMN DI of a BPMN 2.0 XML document
+type bpmnDiagram struct {
+	Planes []struct {
+		Shapes []struct {
+			Element string `xml:"bpmnElement,attr"`
+			Bounds  bounds `xml:"Bounds"`
+		} `xml:"BPMNShape"`
+		Edges []struct {
+			Element   string  `xml:"bpmnElement,attr"`
+			Waypoints []point `xml:"waypoint"`
+		} `xml:"BPMNEdge"`
+	} `xml:"BPMNDiagram>BPMNPlane"`
+}
+
+// bounds the bounds of a shape
+type bounds struct {
+	X      float64 `xml:"x,attr"`
+	Y      float64 `xml:"y,attr"`
+	Width  float64 `xml:"width,attr"`
+	Height float64 `xml:"height,attr"`
+}
+
+// point a waypoint of an edge
+type point struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+// NewCoverage creates an empty coverage
+func NewCoverage() *Coverage {
+	return &Coverage{activities: make(map[string]map[string][]activityRecord)}
+}
+
+// AddModel adds the processes of the BPMN 2.0 XML, a process added again replaces the previous model
+func (c *Coverage) AddModel(data []byte) error {
+	procs, err := parseModel(data, "", false)
+	if err != nil {
+		return err
+	}
+
+	var diagram bpmnDiagram
+	if err := xml.Unmarshal(data, &diagram); err != nil {
+		return fmt.Errorf("cannot parse BPMN diagram: %w", err)
+	}
+
+	for _, proc := range procs {
+		m := &coverageModel{proc: proc, shapes: make(map[string]bounds), edges: make(map[string][]point)}
+		flows := make(map[string]bool, len(proc.Flows))
+		for _, f := range proc.Flows {
+			flows[f.ID] = true
+		}
+
+		for _, plane := range diagram.Planes {
+			for _, s := range plane.Shapes {
+				if proc.Nodes[s.Element] != nil {
+					m.shapes[s.Element] = s.Bounds
+				}
+			}
+
+			for _, e := range plane.Edges {
+				if flows[e.Element] {
+					m.edges[e.Element] = e.Waypoints
+				}
+			}
+		}
+
+		replaced := false
+		for i, existing := range c.models {
+			if existing.proc.ID == proc.ID {
+				c.models[i] = m
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			c.models = append(c.models, m)
+		}
+	}
+
+	return nil
+}
+
+// AddHistory adds historic activity instances of the engine, e.g. of HistoryManager.GetActivityInstances
+func (c *Coverage) AddHistory(activities []*camunda.ResHistoricActivityInstance) {
+	for _, a := range activities {
+		r := activityRecord{activityID: a.ActivityID, start: a.StartTime.Time, canceled: a.Canceled}
+		if a.EndTime != nil {
+			r.end = a.EndTime.Time
+		}
+
+		c.add(a.ProcessDefinitionKey, a.ProcessInstanceID, r)
+	}
+}
+
+// AddEngine adds the activity instances executed by the fake engine
+func (c *Coverage) AddEngine(e *fakeengine.Engine) {
+	keys := make(map[string]string)
+	for _, def := range e.ProcessDefinitions() {
+		keys[def.ID] = def.Key
+	}
+
+	for _, a := range e.Activities("") {
+		c.add(keys[a.ProcessDefinitionID], a.ProcessInstanceID, activityRecord{
+			activityID: a.ActivityID,
+			start:      a.StartTime,
+			end:        a.EndTime,
+			canceled:   a.Canceled,
+		})
+	}
+}
+
+func (c *Coverage) add(key, instanceID string, r activityRecord) {
+	instances := c.activities[key]
+	if instances == nil {
+		instances = make(map[string][]activityRecord)
+		c.activities[key] = instances
+	}
+
+	instances[instanceID] = append(instances[instanceID], r)
+}
+
+// CoverageReport the coverage of the processes
+type CoverageReport struct {
+	Processes []*ProcessCoverage `json:"processes"`
+	// Covered the covered flow nodes and sequence flows of all processes
+	Covered int `json:"covered"`
+	// Total the flow nodes and sequence flows of all processes
+	Total int `json:"total"`
+}
+
+// ProcessCoverage the coverage of a process
+type ProcessCoverage struct {
+	Key  string `json:"key"`
+	Name string `json:"name,omitempty"`
+	// Instances the number of executed process instances
+	Instances    int                `json:"instances"`
+	Nodes        []*ElementCoverage `json:"nodes"`
+	Flows        []*ElementCoverage `json:"flows"`
+	NodesCovered int                `json:"nodesCovered"`
+	FlowsCovered int                `json:"flowsCovered"`
+
+	model *coverageModel
+}
+
+// ElementCoverage the coverage of a flow node or sequence flow
+type ElementCoverage struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Type the BPMN element name, e.g. serviceTask or sequenceFlow
+	Type string `json:"type"`
+	// Source and Target the flow nodes of a sequence flow
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Count the number of executions
+	Count int `json:"count"`
+}
+
+// Ratio the covered part of all flow nodes and sequence flows, 1 without elements
+func (r *CoverageReport) Ratio() float64 {
+	return ratio(r.Covered, r.Total)
+}
+
+// Ratio the covered part of the flow nodes and sequence flows of the process
+func (p *ProcessCoverage) Ratio() float64 {
+	return ratio(p.NodesCovered+p.FlowsCovered, len(p.Nodes)+len(p.Flows))
+}
+
+func ratio(covered, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+
+	return float64(covered) / float64(total)
+}
+
+// Report computes the coverage of the added processes
+func (c *Coverage) Report() *CoverageReport {
+	report := &CoverageReport{}
+
+	for _, m := range c.models {
+		p := c.processCoverage(m)
+		report.Processes = append(report.Processes, p)
+		report.Covered += p.NodesCovered + p.FlowsCovered
+		report.Total += len(p.Nodes) + len(p.Flows)
+	}
+
+	return report
+}
+
+func (c *Coverage) processCoverage(m *coverageModel) *ProcessCoverage {
+	instances := c.activities[m.proc.ID]
+	nodes := make(map[string]int)
+	flows := make(map[string]int)
+
+	for _, records := range instances {
+		for _, r := range records {
+			n := m.proc.Nodes[r.activityID]
+			if n == nil {
+				continue
+			}
+
+			nodes[n.ID]++
+			for _, f := range takenFlows(n, r, records) {
+				flows[f.ID]++
+			}
+		}
+	}
+
+	p := &ProcessCoverage{Key: m.proc.ID, Name: m.proc.Name, Instances: len(instances), model: m}
+	for _, n := range m.proc.Order {
+		p.Nodes = append(p.Nodes, &ElementCoverage{ID: n.ID, Name: n.Name, Type: n.Kind, Count: nodes[n.ID]})
+		if nodes[n.ID] > 0 {
+			p.NodesCovered++
+		}
+	}
+
+	for _, f := range m.proc.Flows {
+		p.Flows = append(p.Flows, &ElementCoverage{
+			ID:     f.ID,
+			Type:   "sequenceFlow",
+			Source: f.Source.ID,
+			Target: f.Target.ID,
+			Count:  flows[f.ID],
+		})
+		if flows[f.ID] > 0 {
+			p.FlowsCovered++
+		}
+	}
+
+	return p
+}
+
+// takenFlows returns the incoming flows of the node taken to start the activity instance: the flows whose source
+// ended last before it, all flows with an ended source for a joining parallel gateway
+func takenFlows(n *node, r activityRecord, records []activityRecord) []*flow {
+	var taken []*flow
+	var latest time.Time
+
+	for _, f := range n.Incoming {
+		var end time.Time
+		for _, s := range records {
+			if s.activityID == f.Source.ID && !s.canceled && !s.end.IsZero() && !s.end.After(r.start) && s.end.After(end) {
+				end = s.end
+			}
+		}
+
+		switch {
+		case end.IsZero():
+		case n.Kind == "parallelGateway":
+			taken = append(taken, f)
+		case end.After(latest):
+			taken = []*flow{f}
+			latest = end
+		case end.Equal(latest):
+			taken = append(taken, f)
+		}
+	}
+
+	return taken
+}
+
+// Check returns an error if the coverage of all processes is below the threshold between 0 and 1
+func (r *CoverageReport) Check(threshold float64) error {
+	if r.Ratio() < threshold {
+		return fmt.Errorf("BPMN coverage %.1f%% is below the threshold %.1f%%", 100*r.Ratio(), 100*threshold)
+	}
+
+	return nil
+}
+
+// WriteJSON writes the report as JSON
+func (r *CoverageReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// WriteText writes the coverage of the processes and their elements not covered
+func (r *CoverageReport) WriteText(w io.Writer) error {
+	for _, p := range r.Processes {
+		fmt.Fprintf(w, "%s: %.1f%% of %d elements, flow nodes %d/%d, sequence flows %d/%d, %d instances\n",
+			p.Key, 100*p.Ratio(), len(p.Nodes)+len(p.Flows), p.NodesCovered, len(p.Nodes), p.FlowsCovered, len(p.Flows), p.Instances)
+
+		for _, e := range uncovered(p) {
+			if e.Type == "sequenceFlow" {
+				fmt.Fprintf(w, "  not covered: sequenceFlow %s (%s -> %s)\n", e.ID, e.Source, e.Target)
+			} else {
+				fmt.Fprintf(w, "  not covered: %s %s\n", e.Type, label(e))
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "total: %.1f%% (%d/%d)\n", 100*r.Ratio(), r.Covered, r.Total)
+
+	return err
+}
+
+// uncovered returns the elements of the process not covered, flow nodes first
+func uncovered(p *ProcessCoverage) []*ElementCoverage {
+	var res []*ElementCoverage
+	for _, e := range append(append([]*ElementCoverage(nil), p.Nodes...), p.Flows...) {
+		if e.Count == 0 {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// label the name and id of the element
+func label(e *ElementCoverage) string {
+	if e.Name == "" {
+		return e.ID
+	}
+
+	return fmt.Sprintf("%s (%s)", e.ID, e.Name)
+}
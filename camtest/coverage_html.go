@@ -0,0 +1,182 @@
+package camtest
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+)
+
+// coverageHTML the template of the HTML report, a diagram overlay for the processes with BPMN DI
+var coverageHTML = template.Must(template.New("coverage").Funcs(template.FuncMap{
+	"percent": func(r float64) string { return fmt.Sprintf("%.1f%%", 100*r) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>BPMN coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+svg { border: 1px solid #ddd; max-width: 100%; height: auto; }
+svg text { font-size: 11px; text-anchor: middle; dominant-baseline: middle; }
+.covered { fill: #e3f6e3; stroke: #2e7d32; }
+.missed { fill: #fde4e4; stroke: #c62828; }
+polyline.covered, polyline.missed { fill: none; stroke-width: 2; }
+polyline.missed { stroke-dasharray: 4 3; }
+table { border-collapse: collapse; margin: 1em 0; }
+td, th { border: 1px solid #ddd; padding: 0.2em 0.6em; text-align: left; }
+tr.missed td { background: #fde4e4; }
+</style>
+</head>
+<body>
+<h1>BPMN coverage {{percent .Report.Ratio}} ({{.Report.Covered}}/{{.Report.Total}})</h1>
+{{range .Processes}}
+<h2>{{.Key}}{{with .Name}} – {{.}}{{end}}: {{percent .Ratio}}</h2>
+<p>Flow nodes {{.NodesCovered}}/{{len .Nodes}}, sequence flows {{.FlowsCovered}}/{{len .Flows}}, {{.Instances}} instances</p>
+{{with .Diagram}}
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="{{.ViewBox}}" width="{{.Width}}">
+{{range .Edges}}<polyline class="{{.Class}}" points="{{.Points}}"><title>{{.Title}}</title></polyline>
+{{end}}{{range .Shapes}}<g class="{{.Class}}"><title>{{.Title}}</title>
+{{if eq .Kind "event"}}<circle class="{{.Class}}" cx="{{.CX}}" cy="{{.CY}}" r="{{.R}}"/>
+{{else if eq .Kind "gateway"}}<polygon class="{{.Class}}" points="{{.Points}}"/>
+{{else}}<rect class="{{.Class}}" x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="{{.H}}" rx="8"/>
+<text x="{{.CX}}" y="{{.CY}}" stroke="none" fill="#000">{{.Label}}</text>
+{{end}}</g>
+{{end}}</svg>
+{{end}}
+<table>
+<tr><th>Element</th><th>Type</th><th>Count</th></tr>
+{{range .Elements}}<tr class="{{if eq .Count 0}}missed{{else}}covered{{end}}"><td>{{.ID}}{{with .Name}} ({{.}}){{end}}</td><td>{{.Type}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// htmlProcess the view of a process in the HTML report
+type htmlProcess struct {
+	*ProcessCoverage
+	Diagram  *htmlDiagram
+	Elements []*ElementCoverage
+}
+
+type htmlDiagram struct {
+	ViewBox string
+	Width   float64
+	Shapes  []htmlShape
+	Edges   []htmlEdge
+}
+
+type htmlShape struct {
+	Kind, Class, Title, Label string
+	X, Y, W, H, CX, CY, R     float64
+	Points                    string
+}
+
+type htmlEdge struct {
+	Class, Title, Points string
+}
+
+// WriteHTML writes the report as HTML, the processes with BPMN DI are drawn with the covered and missed elements
+func (r *CoverageReport) WriteHTML(w io.Writer) error {
+	data := struct {
+		Report    *CoverageReport
+		Processes []htmlProcess
+	}{Report: r}
+
+	for _, p := range r.Processes {
+		data.Processes = append(data.Processes, htmlProcess{
+			ProcessCoverage: p,
+			Diagram:         p.diagram(),
+			Elements:        append(append([]*ElementCoverage(nil), p.Nodes...), p.Flows...),
+		})
+	}
+
+	return coverageHTML.Execute(w, data)
+}
+
+// diagram returns the drawing of the process, nil without BPMN DI
+func (p *ProcessCoverage) diagram() *htmlDiagram {
+	if p.model == nil || len(p.model.shapes) == 0 {
+		return nil
+	}
+
+	d := &htmlDiagram{}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	extend := func(x, y float64) {
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+
+	for _, e := range p.Flows {
+		waypoints := p.model.edges[e.ID]
+		if len(waypoints) == 0 {
+			continue
+		}
+
+		var points []string
+		for _, wp := range waypoints {
+			extend(wp.X, wp.Y)
+			points = append(points, fmt.Sprintf("%g,%g", wp.X, wp.Y))
+		}
+
+		d.Edges = append(d.Edges, htmlEdge{
+			Class:  coverageClass(e),
+			Title:  fmt.Sprintf("%s: %d", e.ID, e.Count),
+			Points: strings.Join(points, " "),
+		})
+	}
+
+	for _, e := range p.Nodes {
+		b, ok := p.model.shapes[e.ID]
+		if !ok {
+			continue
+		}
+
+		extend(b.X, b.Y)
+		extend(b.X+b.Width, b.Y+b.Height)
+
+		s := htmlShape{
+			Kind:  "task",
+			Class: coverageClass(e),
+			Title: fmt.Sprintf("%s: %d", label(e), e.Count),
+			Label: e.Name,
+			X:     b.X,
+			Y:     b.Y,
+			W:     b.Width,
+			H:     b.Height,
+			CX:    b.X + b.Width/2,
+			CY:    b.Y + b.Height/2,
+			R:     math.Min(b.Width, b.Height) / 2,
+		}
+
+		switch {
+		case strings.HasSuffix(e.Type, "Event"):
+			s.Kind = "event"
+		case strings.HasSuffix(e.Type, "Gateway"):
+			s.Kind = "gateway"
+			s.Points = fmt.Sprintf("%g,%g %g,%g %g,%g %g,%g", s.CX, b.Y, b.X+b.Width, s.CY, s.CX, b.Y+b.Height, b.X, s.CY)
+		}
+
+		if s.Label == "" {
+			s.Label = e.ID
+		}
+
+		d.Shapes = append(d.Shapes, s)
+	}
+
+	const margin = 20
+	d.ViewBox = fmt.Sprintf("%g %g %g %g", minX-margin, minY-margin, maxX-minX+2*margin, maxY-minY+2*margin)
+	d.Width = maxX - minX + 2*margin
+
+	return d
+}
+
+func coverageClass(e *ElementCoverage) string {
+	if e.Count == 0 {
+		return "missed"
+	}
+
+	return "covered"
+}
@@ -0,0 +1,92 @@
+package camtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+)
+
+func TestCoverage(t *testing.T) {
+	engine := camtest.NewEngine()
+	defer engine.Close()
+
+	model, err := ioutil.ReadFile("testdata/coverage.bpmn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Deploy("review", map[string][]byte{"coverage.bpmn": model}); err != nil {
+		t.Fatalf("cannot deploy: %s", err)
+	}
+
+	client := engine.Client()
+	_, err = client.ProcessManager().StartInstance(camunda.ProcessConfig{Key: "review"}, camunda.InstanceParams{
+		Variables: camunda.Variables{"ok": {Value: true, Type: "Boolean"}},
+	})
+	if err != nil {
+		t.Fatalf("cannot start: %s", err)
+	}
+
+	history, err := camunda.NewHistoryManager(client).GetActivityInstances(camunda.HistoricActivityInstanceQuery{})
+	if err != nil {
+		t.Fatalf("cannot get the history: %s", err)
+	}
+
+	for name, add := range map[string]func(c *camtest.Coverage){
+		"engine":  func(c *camtest.Coverage) { c.AddEngine(engine) },
+		"history": func(c *camtest.Coverage) { c.AddHistory(history) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := camtest.NewCoverage()
+			if err := c.AddModel(model); err != nil {
+				t.Fatalf("cannot add the model: %s", err)
+			}
+			add(c)
+
+			report := c.Report()
+			p := report.Processes[0]
+			if p.Instances != 1 || p.NodesCovered != 4 || p.FlowsCovered != 3 {
+				t.Fatalf("got %d instances, %d nodes, %d flows covered, want 1, 4, 3", p.Instances, p.NodesCovered, p.FlowsCovered)
+			}
+
+			for _, f := range p.Flows {
+				if covered := f.Count > 0; covered != (f.ID == "to-decide" || f.ID == "to-accept" || f.ID == "accepted") {
+					t.Errorf("flow %s covered %d times", f.ID, f.Count)
+				}
+			}
+
+			if err := report.Check(0.6); err != nil {
+				t.Errorf("check: %s", err)
+			}
+			if err := report.Check(0.8); err == nil {
+				t.Errorf("check: coverage of %.2f above 0.8", report.Ratio())
+			}
+		})
+	}
+
+	c := camtest.NewCoverage()
+	if err := c.AddModel(model); err != nil {
+		t.Fatal(err)
+	}
+	c.AddEngine(engine)
+	report := c.Report()
+
+	var text, html, js bytes.Buffer
+	if err := report.WriteText(&text); err != nil || !strings.Contains(text.String(), "not covered: task reject (Reject)") {
+		t.Errorf("text report: %s %v", text.String(), err)
+	}
+
+	if err := report.WriteHTML(&html); err != nil || !strings.Contains(html.String(), `<polyline class="missed"`) {
+		t.Errorf("HTML report without the diagram: %v", err)
+	}
+
+	var decoded camtest.CoverageReport
+	if err := report.WriteJSON(&js); err != nil || json.Unmarshal(js.Bytes(), &decoded) != nil || decoded.Covered != 7 {
+		t.Errorf("JSON report: %s %v", js.String(), err)
+	}
+}
@@ -0,0 +1,466 @@
+package camtest
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// Executor a BPMN interpreter for the fake engine, see NewEngine. It runs a subset of BPMN 2.0:
+// none and message start events, none and terminate end events, external service tasks, user tasks,
+// exclusive and parallel gateways with simple condition expressions, message catch events, receive tasks
+// and error boundary events. External tasks are fetched and completed by the REST API of the engine,
+// so real worker handlers run against it. An uncaught BPMN error ends the execution of the task.
+// An Executor serves one engine, it is called with the engine locked
+type Executor struct {
+	// processes the parsed processes by definition id
+	processes map[string]*process
+	// tokens the running executions by instance id
+	tokens map[string][]*token
+	// tasks the executions waiting for an external or user task by task id
+	tasks map[string]*token
+	// joins the executions arrived at a parallel gateway by instance and gateway id
+	joins map[string]int
+	// executions the number of concurrent executions created
+	executions int
+	// steps the number of nodes entered, orders the waiting tokens
+	steps int
+}
+
+// token an execution of a process instance
+type token struct {
+	id   string
+	inst string
+	node *node
+	// step the step the token entered the node
+	step int
+	// activity the activity the token waits in
+	activity *fakeengine.ActivityInstance
+}
+
+// NewExecutor creates a BPMN interpreter, set it with fakeengine.Engine.SetExecutor
+func NewExecutor() *Executor {
+	return &Executor{
+		processes: make(map[string]*process),
+		tokens:    make(map[string][]*token),
+		tasks:     make(map[string]*token),
+		joins:     make(map[string]int),
+	}
+}
+
+// NewEngine starts a fake engine running the deployed processes with a new Executor, call Close after the test
+func NewEngine() *fakeengine.Engine {
+	e := fakeengine.New()
+	e.SetExecutor(NewExecutor())
+
+	return e
+}
+
+// InstanceStarted runs the instance from its none start event
+func (x *Executor) InstanceStarted(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance) error {
+	proc, err := x.process(tx, inst.DefinitionID)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range proc.Starts {
+		if n.Message == "" {
+			return x.start(tx, inst, n)
+		}
+	}
+
+	return fmt.Errorf("process %s has no none start event", proc.ID)
+}
+
+// ExternalTaskFinished continues the execution of the task, by the error boundary event on a BPMN error
+func (x *Executor) ExternalTaskFinished(tx *fakeengine.Tx, t *fakeengine.ExternalTask) error {
+	tok, inst := x.waiting(tx, t.ID)
+	if tok == nil {
+		return nil
+	}
+
+	if t.State == fakeengine.TaskBPMNError {
+		return x.throwError(tx, inst, tok, t.ErrorCode)
+	}
+
+	tx.EndActivity(tok.activity, false)
+
+	return x.leave(tx, inst, tok)
+}
+
+// UserTaskCompleted continues the execution of the task
+func (x *Executor) UserTaskCompleted(tx *fakeengine.Tx, t *fakeengine.UserTask) error {
+	tok, inst := x.waiting(tx, t.ID)
+	if tok == nil {
+		return nil
+	}
+
+	tx.EndActivity(tok.activity, false)
+
+	return x.leave(tx, inst, tok)
+}
+
+// Correlate continues the executions waiting for the message, one unless All is set,
+// or starts an instance by a message start event
+func (x *Executor) Correlate(tx *fakeengine.Tx, msg *camunda.MessageRequest) error {
+	correlated := false
+
+	for _, tok := range x.messageWaits(tx, msg) {
+		inst := tx.Instance(tok.inst)
+		if inst.Ended || tok.activity == nil || !tok.activity.EndTime.IsZero() {
+			continue
+		}
+
+		for k, v := range msg.ProcessVariables {
+			inst.Variables[k] = v
+		}
+
+		tx.EndActivity(tok.activity, false)
+		if err := x.leave(tx, inst, tok); err != nil {
+			return err
+		}
+
+		correlated = true
+		if !msg.All {
+			return nil
+		}
+	}
+
+	if correlated {
+		return nil
+	}
+
+	for _, def := range tx.LatestDefinitions() {
+		if msg.TenantID != "" && def.TenantID != msg.TenantID {
+			continue
+		}
+
+		proc, err := x.process(tx, def.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, n := range proc.Starts {
+			if n.Message != msg.MessageName {
+				continue
+			}
+
+			inst, err := tx.StartInstance(def, msg.BusinessKey, msg.ProcessVariables)
+			if err != nil {
+				return err
+			}
+
+			return x.start(tx, inst, n)
+		}
+	}
+
+	return fmt.Errorf("cannot correlate message '%s': no process definition or execution matches the parameters", msg.MessageName)
+}
+
+// process returns the parsed process of the definition
+func (x *Executor) process(tx *fakeengine.Tx, definitionID string) (*process, error) {
+	if proc, ok := x.processes[definitionID]; ok {
+		return proc, nil
+	}
+
+	def := tx.Definition(definitionID)
+	if def == nil {
+		return nil, fmt.Errorf("process definition %s not found", definitionID)
+	}
+
+	proc, err := parseProcess(def.XML, def.Key)
+	if err != nil {
+		return nil, err
+	}
+	x.processes[definitionID] = proc
+
+	return proc, nil
+}
+
+// start runs the instance from the start event
+func (x *Executor) start(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, start *node) error {
+	tok := &token{id: inst.ID, inst: inst.ID}
+	x.tokens[inst.ID] = append(x.tokens[inst.ID], tok)
+
+	return x.enter(tx, inst, tok, start)
+}
+
+// waiting returns the token waiting for the task and its running instance, nil if none
+func (x *Executor) waiting(tx *fakeengine.Tx, taskID string) (*token, *fakeengine.ProcessInstance) {
+	tok, ok := x.tasks[taskID]
+	if !ok {
+		return nil, nil
+	}
+	delete(x.tasks, taskID)
+
+	inst := tx.Instance(tok.inst)
+	if inst == nil || inst.Ended {
+		return nil, nil
+	}
+
+	return tok, inst
+}
+
+// messageWaits returns the tokens waiting for the message in the matching instances
+func (x *Executor) messageWaits(tx *fakeengine.Tx, msg *camunda.MessageRequest) []*token {
+	var res []*token
+
+	for id, tokens := range x.tokens {
+		inst := tx.Instance(id)
+		if inst == nil || inst.Ended || !matchMessage(inst, msg) {
+			continue
+		}
+
+		for _, tok := range tokens {
+			if tok.activity != nil && tok.node.Message == msg.MessageName {
+				res = append(res, tok)
+			}
+		}
+	}
+
+	// Map iteration is random, the longest waiting token is correlated first
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].step < res[j].step
+	})
+
+	return res
+}
+
+// matchMessage checks the correlation parameters of the message against the instance
+func matchMessage(inst *fakeengine.ProcessInstance, msg *camunda.MessageRequest) bool {
+	switch {
+	case msg.ProcessInstanceID != "" && msg.ProcessInstanceID != inst.ID,
+		msg.BusinessKey != "" && msg.BusinessKey != inst.BusinessKey,
+		msg.TenantID != "" && msg.TenantID != inst.TenantID:
+		return false
+	}
+
+	for name, want := range msg.CorrelationKeys {
+		got, ok := inst.Variables[name]
+		if !ok || want == nil || fmt.Sprint(got.Value) != fmt.Sprint(want.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// enter moves the token into the node and runs it until it waits or ends
+func (x *Executor) enter(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, tok *token, n *node) error {
+	x.steps++
+	tok.node = n
+	tok.step = x.steps
+	activity := tx.StartActivity(inst, tok.id, n.ID, n.Name, n.ActivityType)
+
+	switch n.Kind {
+	case "serviceTask", "sendTask", "businessRuleTask":
+		t := tx.AddExternalTask(&fakeengine.ExternalTask{
+			TopicName:          n.Topic,
+			ProcessInstanceID:  inst.ID,
+			ExecutionID:        tok.id,
+			ActivityID:         n.ID,
+			ActivityInstanceID: activity.ID,
+			Priority:           n.Priority,
+		})
+		tok.activity = activity
+		x.tasks[t.ID] = tok
+
+		return nil
+	case "userTask":
+		t := tx.AddUserTask(&fakeengine.UserTask{
+			Name:              n.Name,
+			TaskDefinitionKey: n.ID,
+			Assignee:          n.Assignee,
+			ProcessInstanceID: inst.ID,
+			ExecutionID:       tok.id,
+		})
+		tok.activity = activity
+		x.tasks[t.ID] = tok
+
+		return nil
+	case "receiveTask", "intermediateCatchEvent":
+		tok.activity = activity
+		return nil
+	}
+
+	tx.EndActivity(activity, false)
+
+	switch n.Kind {
+	case "endEvent":
+		x.consume(tx, inst, tok, n.Terminate)
+		return nil
+	case "exclusiveGateway":
+		f, err := x.choose(inst, n)
+		if err != nil {
+			return err
+		}
+
+		return x.enter(tx, inst, tok, f.Target)
+	case "parallelGateway":
+		if len(n.Incoming) > 1 {
+			key := inst.ID + "/" + n.ID
+			x.joins[key]++
+			if x.joins[key] < len(n.Incoming) {
+				x.remove(tok)
+				return nil
+			}
+			delete(x.joins, key)
+		}
+
+		return x.fork(tx, inst, tok, n.Outgoing)
+	}
+
+	return x.leave(tx, inst, tok)
+}
+
+// leave takes the outgoing flows of the node of the token whose condition holds
+func (x *Executor) leave(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, tok *token) error {
+	tok.activity = nil
+
+	var flows []*flow
+	for _, f := range tok.node.Outgoing {
+		if f.Condition != "" {
+			ok, err := evalCondition(f.Condition, inst.Variables)
+			if err != nil {
+				return fmt.Errorf("sequence flow %s: %w", f.ID, err)
+			}
+
+			if !ok {
+				continue
+			}
+		}
+
+		flows = append(flows, f)
+	}
+
+	if len(tok.node.Outgoing) == 0 {
+		x.consume(tx, inst, tok, false)
+		return nil
+	}
+
+	if len(flows) == 0 {
+		return fmt.Errorf("no outgoing sequence flow of %s can be taken", tok.node.ID)
+	}
+
+	return x.fork(tx, inst, tok, flows)
+}
+
+// fork takes the flows with the token and new tokens for the other flows
+func (x *Executor) fork(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, tok *token, flows []*flow) error {
+	if len(flows) == 0 {
+		x.consume(tx, inst, tok, false)
+		return nil
+	}
+
+	tokens := []*token{tok}
+	for range flows[1:] {
+		x.executions++
+		t := &token{id: fmt.Sprintf("%s:%d", inst.ID, x.executions), inst: inst.ID}
+		x.tokens[inst.ID] = append(x.tokens[inst.ID], t)
+		tokens = append(tokens, t)
+	}
+
+	for i, f := range flows {
+		if inst.Ended {
+			return nil
+		}
+
+		if err := x.enter(tx, inst, tokens[i], f.Target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// choose returns the first outgoing flow of the exclusive gateway whose condition holds, else the default flow
+func (x *Executor) choose(inst *fakeengine.ProcessInstance, n *node) (*flow, error) {
+	for _, f := range n.Outgoing {
+		if f == n.Default {
+			continue
+		}
+
+		if f.Condition == "" {
+			return f, nil
+		}
+
+		ok, err := evalCondition(f.Condition, inst.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("sequence flow %s: %w", f.ID, err)
+		}
+
+		if ok {
+			return f, nil
+		}
+	}
+
+	if n.Default != nil {
+		return n.Default, nil
+	}
+
+	return nil, fmt.Errorf("no outgoing sequence flow of exclusive gateway %s can be taken", n.ID)
+}
+
+// throwError moves the token waiting in a task to the error boundary event catching the code.
+// The execution ends if no boundary event catches the error
+func (x *Executor) throwError(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, tok *token, code string) error {
+	var catch *node
+	for _, b := range tok.node.Boundaries {
+		if b.ErrorCode == code {
+			catch = b
+			break
+		}
+
+		if b.ErrorCode == "" && catch == nil {
+			catch = b
+		}
+	}
+
+	tx.EndActivity(tok.activity, true)
+	tok.activity = nil
+
+	if catch == nil {
+		x.consume(tx, inst, tok, false)
+		return nil
+	}
+
+	return x.enter(tx, inst, tok, catch)
+}
+
+// consume ends the token, the instance ends with its last token or at a terminate end event
+func (x *Executor) consume(tx *fakeengine.Tx, inst *fakeengine.ProcessInstance, tok *token, terminate bool) {
+	x.remove(tok)
+
+	if !terminate && len(x.tokens[inst.ID]) > 0 {
+		return
+	}
+
+	for id, t := range x.tasks {
+		if t.inst == inst.ID {
+			delete(x.tasks, id)
+		}
+	}
+
+	for key := range x.joins {
+		if len(key) > len(inst.ID) && key[:len(inst.ID)+1] == inst.ID+"/" {
+			delete(x.joins, key)
+		}
+	}
+
+	delete(x.tokens, inst.ID)
+	tx.EndInstance(inst)
+}
+
+// remove removes the token from the running tokens of its instance
+func (x *Executor) remove(tok *token) {
+	tokens := x.tokens[tok.inst][:0]
+	for _, t := range x.tokens[tok.inst] {
+		if t != tok {
+			tokens = append(tokens, t)
+		}
+	}
+
+	x.tokens[tok.inst] = tokens
+}
@@ -0,0 +1,135 @@
+package camtest_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+	"github.com/interticketinc/camunda/worker"
+)
+
+func TestExecutor(t *testing.T) {
+	engine := camtest.NewEngine()
+	defer engine.Close()
+
+	model, err := ioutil.ReadFile("testdata/order.bpmn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Deploy("order", map[string][]byte{"order.bpmn": model}); err != nil {
+		t.Fatalf("cannot deploy: %s", err)
+	}
+
+	client := engine.Client()
+	w := worker.New(client, &worker.Options{LockDuration: time.Minute, LongPollingTimeout: time.Second})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "check-stock"}}, func(ctx worker.Context) error {
+		if v := ctx.Variables()["inStock"]; v != nil && v.Value == false {
+			return ctx.ReportBPMNError(worker.NewBPMNError("out-of-stock", "no items left", nil))
+		}
+
+		return ctx.Complete(&worker.TaskComplete{})
+	})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "invoice"}, {TopicName: "ship"}}, func(ctx worker.Context) error {
+		return ctx.Complete(&worker.TaskComplete{})
+	})
+
+	start := func(businessKey string, amount int, inStock bool) string {
+		t.Helper()
+
+		res, err := client.ProcessManager().StartInstance(camunda.ProcessConfig{Key: "order"}, camunda.InstanceParams{
+			BusinessKey: businessKey,
+			Variables: camunda.Variables{
+				"amount":  {Value: amount, Type: "Integer"},
+				"inStock": {Value: inStock, Type: "Boolean"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("cannot start %s: %s", businessKey, err)
+		}
+
+		return res.Id
+	}
+
+	small := start("small", 50, true)
+	large := start("large", 500, true)
+	rejected := start("out-of-stock", 10, false)
+
+	waitFor(t, "the rejected order to end", func() bool {
+		return ended(engine, rejected)
+	})
+	waitFor(t, "the small order to wait for the payment", func() bool {
+		return waitsIn(engine, small, "payment")
+	})
+	waitFor(t, "the large order to wait for the approval", func() bool {
+		return len(engine.UserTasks()) == 1 && engine.UserTasks()[0].State == fakeengine.TaskActive
+	})
+
+	approval := engine.UserTasks()[0]
+	if approval.ProcessInstanceID != large || approval.TaskDefinitionKey != "approve" {
+		t.Fatalf("unexpected user task %+v", approval)
+	}
+
+	if _, err := client.Post("/task/"+approval.ID+"/complete", nil, &camunda.QueryUserTaskComplete{}); err != nil {
+		t.Fatalf("cannot complete the approval: %s", err)
+	}
+
+	waitFor(t, "the large order to wait for the payment", func() bool {
+		return waitsIn(engine, large, "payment")
+	})
+
+	messages := camunda.NewMessageManager(client)
+	for _, businessKey := range []string{"small", "large"} {
+		if _, err := messages.SendMessage(&camunda.MessageRequest{MessageName: "paid", BusinessKey: businessKey}); err != nil {
+			t.Fatalf("cannot correlate the payment of %s: %s", businessKey, err)
+		}
+	}
+
+	if !ended(engine, small) || !ended(engine, large) {
+		t.Errorf("orders not ended after the payment")
+	}
+
+	if _, err := messages.SendMessage(&camunda.MessageRequest{MessageName: "paid", BusinessKey: "small"}); err == nil {
+		t.Errorf("message correlated to an ended order")
+	}
+
+	for id, end := range map[string]string{small: "done", large: "done", rejected: "rejected"} {
+		activities := engine.Activities(id)
+		if last := activities[len(activities)-1]; last.ActivityID != end {
+			t.Errorf("instance %s ended at %s, want %s", id, last.ActivityID, end)
+		}
+	}
+}
+
+// waitFor waits until the condition holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+func ended(engine *fakeengine.Engine, id string) bool {
+	inst, ok := engine.Instance(id)
+	return ok && inst.Ended
+}
+
+func waitsIn(engine *fakeengine.Engine, id, activityID string) bool {
+	for _, a := range engine.Activities(id) {
+		if a.ActivityID == activityID && a.EndTime.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,311 @@
+package camtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/interticketinc/camunda"
+)
+
+// evalCondition evaluates a condition expression like ${amount > 100 && status == 'ok'} with the variables.
+// Supported are variables, string, number, boolean and null literals, parentheses, the comparison operators
+// (== != < <= > >= and eq ne lt le gt ge), !, not, empty, && and, || or
+func evalCondition(expr string, vars camunda.Variables) (bool, error) {
+	s := strings.TrimSpace(expr)
+	if !(strings.HasPrefix(s, "${") || strings.HasPrefix(s, "#{")) || !strings.HasSuffix(s, "}") {
+		return false, fmt.Errorf("condition %q is not an expression ${...}", expr)
+	}
+
+	tokens, err := tokenize(s[2 : len(s)-1])
+	if err != nil {
+		return false, fmt.Errorf("condition %q: %w", expr, err)
+	}
+
+	p := &exprParser{tokens: tokens, vars: vars}
+
+	v, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("condition %q: %w", expr, err)
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q is not a boolean: %v", expr, v)
+	}
+
+	return b, nil
+}
+
+// tokenize splits the expression into identifiers, literals and operators
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexRune(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			op := s[i : i+1]
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = two
+				}
+			}
+
+			if !strings.Contains("==!=<=>=&&||()", op) {
+				return nil, fmt.Errorf("unexpected character %q", op)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+
+	return tokens, nil
+}
+
+// exprParser a recursive descent evaluator of the tokens
+type exprParser struct {
+	tokens []string
+	pos    int
+	vars   camunda.Variables
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	for _, op := range ops {
+		if p.peek() == op {
+			p.pos++
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *exprParser) or() (interface{}, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||", "or"); !ok {
+			break
+		}
+
+		var right interface{}
+		if right, err = p.and(); err == nil {
+			left, err = logical(left, right, func(a, b bool) bool { return a || b })
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) and() (interface{}, error) {
+	left, err := p.unary()
+	for err == nil {
+		if _, ok := p.accept("&&", "and"); !ok {
+			break
+		}
+
+		var right interface{}
+		if right, err = p.unary(); err == nil {
+			left, err = logical(left, right, func(a, b bool) bool { return a && b })
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) unary() (interface{}, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %v", v)
+		}
+
+		return !b, nil
+	}
+
+	if _, ok := p.accept("empty"); ok {
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return v == nil || fmt.Sprint(v) == "", nil
+	}
+
+	return p.comparison()
+}
+
+func (p *exprParser) comparison() (interface{}, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "eq", "ne", "lt", "le", "gt", "ge")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return compare(op, left, right)
+}
+
+func (p *exprParser) primary() (interface{}, error) {
+	t := p.peek()
+	if t == "" {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	p.pos++
+
+	switch {
+	case t == "(":
+		v, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing )")
+		}
+
+		return v, nil
+	case t[0] == '\'' || t[0] == '"':
+		return t[1 : len(t)-1], nil
+	case t == "true" || t == "false":
+		return t == "true", nil
+	case t == "null":
+		return nil, nil
+	case unicode.IsDigit(rune(t[0])):
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+
+		return f, nil
+	case unicode.IsLetter(rune(t[0])) || t[0] == '_':
+		v, ok := p.vars[t]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %s", t)
+		}
+
+		if v == nil {
+			return nil, nil
+		}
+
+		return v.Value, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", t)
+}
+
+// logical applies the boolean operator
+func logical(left, right interface{}, op func(a, b bool) bool) (interface{}, error) {
+	a, ok1 := left.(bool)
+	b, ok2 := right.(bool)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("logical operator on %v and %v", left, right)
+	}
+
+	return op(a, b), nil
+}
+
+// compare compares numbers numerically, other values by their printed form
+func compare(op string, left, right interface{}) (bool, error) {
+	var c int
+
+	a, aNum := number(left)
+	b, bNum := number(right)
+
+	switch {
+	case aNum && bNum:
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case left == nil || right == nil:
+		if op != "==" && op != "eq" && op != "!=" && op != "ne" {
+			return false, fmt.Errorf("cannot compare %v and %v with %s", left, right, op)
+		}
+
+		if left != right {
+			c = 1
+		}
+	default:
+		c = strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+	}
+
+	switch op {
+	case "==", "eq":
+		return c == 0, nil
+	case "!=", "ne":
+		return c != 0, nil
+	case "<", "lt":
+		return c < 0, nil
+	case "<=", "le":
+		return c <= 0, nil
+	case ">", "gt":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// number converts a numeric value of a variable or literal
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
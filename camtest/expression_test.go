@@ -0,0 +1,48 @@
+package camtest
+
+import (
+	"testing"
+
+	"github.com/interticketinc/camunda"
+)
+
+func TestEvalCondition(t *testing.T) {
+	vars := camunda.Variables{
+		"amount":   {Value: float64(150), Type: "Integer"},
+		"status":   {Value: "ok", Type: "String"},
+		"approved": {Value: true, Type: "Boolean"},
+		"comment":  {Value: nil, Type: "Null"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"${amount > 100}", true},
+		{"${amount le 100}", false},
+		{"${status == 'ok' && approved}", true},
+		{"${!approved || amount < 10}", false},
+		{"${not (status eq \"failed\") and amount >= 150}", true},
+		{"${comment == null}", true},
+		{"${empty comment}", true},
+		{"#{status != 'ok' or approved}", true},
+	}
+
+	for _, tt := range tests {
+		got, err := evalCondition(tt.expr, vars)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"amount > 100", "${missing}", "${amount}", "${amount >}", "${(approved}"} {
+		if _, err := evalCondition(expr, vars); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
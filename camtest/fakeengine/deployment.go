@@ -0,0 +1,541 @@
+package fakeengine
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/deploy"
+)
+
+// maxDeploymentSize maximum size of a deployment request
+const maxDeploymentSize = 32 << 20
+
+func (e *Engine) registerDeploymentRoutes() {
+	e.handle(http.MethodPost, "/deployment/create", e.createDeployment)
+	e.handle(http.MethodGet, "/deployment", e.listDeployments)
+	e.handle(http.MethodGet, "/deployment/count", e.countDeployments)
+	e.handle(http.MethodGet, "/deployment/{id}", e.getDeployment)
+	e.handle(http.MethodDelete, "/deployment/{id}", e.deleteDeployment)
+	e.handle(http.MethodPost, "/deployment/{id}/redeploy", e.redeploy)
+	e.handle(http.MethodGet, "/deployment/{id}/resources", e.listResources)
+	e.handle(http.MethodGet, "/deployment/{id}/resources/{resource}", e.getResource)
+	e.handle(http.MethodGet, "/deployment/{id}/resources/{resource}/data", e.getResourceData)
+}
+
+func (e *Engine) createDeployment(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if err := r.ParseMultipartForm(maxDeploymentSize); err != nil {
+		badRequest(w, "cannot parse deployment: %s", err)
+		return
+	}
+
+	form := r.MultipartForm
+	field := func(name string) string {
+		if v := form.Value[name]; len(v) > 0 {
+			return v[0]
+		}
+
+		return ""
+	}
+
+	d := &Deployment{
+		Name:     field("deployment-name"),
+		Source:   field("deployment-source"),
+		TenantID: field("tenant-id"),
+	}
+
+	for name, values := range form.Value {
+		switch name {
+		case "deployment-name", "deployment-source", "tenant-id", "enable-duplicate-filtering", "deploy-changed-only":
+			continue
+		}
+
+		d.Resources = append(d.Resources, Resource{Name: name, Data: []byte(values[0])})
+	}
+
+	for _, files := range form.File {
+		f, err := files[0].Open()
+		if err != nil {
+			badRequest(w, "cannot read resource %s: %s", files[0].Filename, err)
+			return
+		}
+
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+
+		if err != nil {
+			badRequest(w, "cannot read resource %s: %s", files[0].Filename, err)
+			return
+		}
+
+		d.Resources = append(d.Resources, Resource{Name: files[0].Filename, Data: data})
+	}
+
+	sort.Slice(d.Resources, func(i, j int) bool {
+		return d.Resources[i].Name < d.Resources[j].Name
+	})
+
+	filter := field("enable-duplicate-filtering") == "true" || field("deploy-changed-only") == "true"
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if filter {
+		if prev := e.duplicateOf(d); prev != nil {
+			writeJSON(w, http.StatusOK, createResponse(prev, nil))
+			return
+		}
+	}
+
+	defs, err := e.deploy(d)
+	if err != nil {
+		badRequest(w, "%s", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, createResponse(d, defs))
+}
+
+func (e *Engine) redeploy(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var req deploy.RedeployRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	prev := e.deployment(params["id"])
+	if prev == nil {
+		notFound(w, "deployment %s does not exist", params["id"])
+		return
+	}
+
+	d := &Deployment{Name: prev.Name, TenantID: prev.TenantID}
+	if req.Source != nil {
+		d.Source = *req.Source
+	}
+
+	for _, res := range prev.Resources {
+		if req.ResourceIds != nil && !containsCSV(*req.ResourceIds, res.ID) {
+			continue
+		}
+
+		if req.ResourceNames != nil && !containsCSV(*req.ResourceNames, res.Name) {
+			continue
+		}
+
+		d.Resources = append(d.Resources, Resource{Name: res.Name, Data: res.Data})
+	}
+
+	defs, err := e.deploy(d)
+	if err != nil {
+		badRequest(w, "%s", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, createResponse(d, defs))
+}
+
+func (e *Engine) listDeployments(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*deploy.Deployment{}
+	for _, d := range e.filterDeployments(r.URL.Query()) {
+		res = append(res, deploymentResponse(d))
+	}
+
+	writeJSON(w, http.StatusOK, page(res, r.URL.Query()))
+}
+
+func (e *Engine) countDeployments(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &camunda.ResponseCount{Count: len(e.filterDeployments(r.URL.Query()))})
+}
+
+func (e *Engine) getDeployment(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d := e.deployment(params["id"])
+	if d == nil {
+		notFound(w, "deployment %s does not exist", params["id"])
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deploymentResponse(d))
+}
+
+func (e *Engine) deleteDeployment(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d := e.deployment(params["id"])
+	if d == nil {
+		notFound(w, "deployment %s does not exist", params["id"])
+		return
+	}
+
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	var defs []*ProcessDefinition
+	for _, def := range e.definitions {
+		if def.DeploymentID == d.ID {
+			defs = append(defs, def)
+		}
+	}
+
+	for _, def := range defs {
+		for _, inst := range e.instances {
+			if inst.DefinitionID != def.ID || inst.Ended {
+				continue
+			}
+
+			if !cascade {
+				badRequest(w, "deployment %s has running process instances", d.ID)
+				return
+			}
+
+			e.endInstance(inst)
+		}
+	}
+
+	e.removeDefinitions(func(def *ProcessDefinition) bool {
+		return def.DeploymentID == d.ID
+	})
+
+	for i := range e.deployments {
+		if e.deployments[i] == d {
+			e.deployments = append(e.deployments[:i], e.deployments[i+1:]...)
+			break
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) listResources(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d := e.deployment(params["id"])
+	if d == nil {
+		notFound(w, "deployment %s does not exist", params["id"])
+		return
+	}
+
+	res := []*deploy.ResourceResponse{}
+	for _, resource := range d.Resources {
+		res = append(res, &deploy.ResourceResponse{ID: resource.ID, Name: resource.Name, DeploymentID: d.ID})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (e *Engine) getResource(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d, resource := e.resource(params["id"], params["resource"])
+	if resource == nil {
+		notFound(w, "resource %s of deployment %s does not exist", params["resource"], params["id"])
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &deploy.ResourceResponse{ID: resource.ID, Name: resource.Name, DeploymentID: d.ID})
+}
+
+func (e *Engine) getResourceData(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, resource := e.resource(params["id"], params["resource"])
+	if resource == nil {
+		notFound(w, "resource %s of deployment %s does not exist", params["resource"], params["id"])
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(resource.Data)
+}
+
+// deploy stores the deployment and its process definitions, must be called with mu held
+func (e *Engine) deploy(d *Deployment) ([]*ProcessDefinition, error) {
+	d.ID = newID()
+	d.Time = time.Now()
+
+	var defs []*ProcessDefinition
+
+	for i := range d.Resources {
+		res := &d.Resources[i]
+		res.ID = newID()
+
+		if !isBPMN(res.Name) {
+			continue
+		}
+
+		processes, err := parseProcesses(res.Data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse resource %s: %w", res.Name, err)
+		}
+
+		for _, p := range processes {
+			version := 1
+			if latest := e.latestDefinition(p.id, d.TenantID); latest != nil {
+				version = latest.Version + 1
+			}
+
+			defs = append(defs, &ProcessDefinition{
+				ID:           fmt.Sprintf("%s:%d:%s", p.id, version, newID()),
+				Key:          p.id,
+				Name:         p.name,
+				Version:      version,
+				DeploymentID: d.ID,
+				Resource:     res.Name,
+				TenantID:     d.TenantID,
+				XML:          res.Data,
+			})
+		}
+	}
+
+	e.deployments = append(e.deployments, d)
+	e.definitions = append(e.definitions, defs...)
+
+	return defs, nil
+}
+
+// duplicateOf returns the last deployment with the same name and resources, must be called with mu held
+func (e *Engine) duplicateOf(d *Deployment) *Deployment {
+	for i := len(e.deployments) - 1; i >= 0; i-- {
+		prev := e.deployments[i]
+		if prev.Name != d.Name || prev.TenantID != d.TenantID {
+			continue
+		}
+
+		if len(prev.Resources) != len(d.Resources) {
+			return nil
+		}
+
+		data := make(map[string][]byte, len(prev.Resources))
+		for _, res := range prev.Resources {
+			data[res.Name] = res.Data
+		}
+
+		for _, res := range d.Resources {
+			if prevData, ok := data[res.Name]; !ok || !bytes.Equal(prevData, res.Data) {
+				return nil
+			}
+		}
+
+		return prev
+	}
+
+	return nil
+}
+
+// deployment returns the deployment by id, must be called with mu held
+func (e *Engine) deployment(id string) *Deployment {
+	for _, d := range e.deployments {
+		if d.ID == id {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// resource returns the resource of the deployment by id, must be called with mu held
+func (e *Engine) resource(deploymentID, id string) (*Deployment, *Resource) {
+	d := e.deployment(deploymentID)
+	if d == nil {
+		return nil, nil
+	}
+
+	for i := range d.Resources {
+		if d.Resources[i].ID == id {
+			return d, &d.Resources[i]
+		}
+	}
+
+	return d, nil
+}
+
+// filterDeployments returns the deployments matching the query, must be called with mu held
+func (e *Engine) filterDeployments(q url.Values) []*Deployment {
+	var res []*Deployment
+
+	for _, d := range e.deployments {
+		switch {
+		case q.Get("id") != "" && q.Get("id") != d.ID,
+			q.Get("name") != "" && q.Get("name") != d.Name,
+			q.Get("nameLike") != "" && !like(d.Name, q.Get("nameLike")),
+			q.Get("source") != "" && q.Get("source") != d.Source,
+			q.Get("withoutSource") == "true" && d.Source != "",
+			!matchTenant(q, d.TenantID):
+			continue
+		}
+
+		res = append(res, d)
+	}
+
+	return res
+}
+
+func deploymentResponse(d *Deployment) *deploy.Deployment {
+	return &deploy.Deployment{
+		ID:             d.ID,
+		Name:           d.Name,
+		Source:         d.Source,
+		TenantID:       d.TenantID,
+		DeploymentTime: camunda.Time{Time: d.Time},
+	}
+}
+
+func createResponse(d *Deployment, defs []*ProcessDefinition) *deploy.CreateResponse {
+	res := &deploy.CreateResponse{
+		ID:             d.ID,
+		Name:           d.Name,
+		Source:         d.Source,
+		TenantID:       d.TenantID,
+		DeploymentTime: camunda.Time{Time: d.Time},
+		Links:          []camunda.ResLink{},
+	}
+
+	if len(defs) > 0 {
+		res.DeployedProcessDefinitions = make(map[string]camunda.ProcessDefinitionResponse, len(defs))
+		for _, def := range defs {
+			res.DeployedProcessDefinitions[def.ID] = *definitionResponse(def)
+		}
+	}
+
+	return res
+}
+
+// bpmnProcess an executable process declared in a BPMN resource
+type bpmnProcess struct {
+	id   string
+	name string
+}
+
+// isBPMN reports whether the resource is deployed as BPMN by the engine
+func isBPMN(name string) bool {
+	return strings.HasSuffix(name, ".bpmn") || strings.HasSuffix(name, ".bpmn20.xml")
+}
+
+// parseProcesses returns the executable processes of a BPMN 2.0 XML
+func parseProcesses(data []byte) ([]bpmnProcess, error) {
+	var processes []bpmnProcess
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return processes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		el, ok := tok.(xml.StartElement)
+		if !ok || el.Name.Local != "process" {
+			continue
+		}
+
+		p := bpmnProcess{}
+		executable := true
+		for _, a := range el.Attr {
+			switch a.Name.Local {
+			case "id":
+				p.id = a.Value
+			case "name":
+				p.name = a.Value
+			case "isExecutable":
+				executable, _ = strconv.ParseBool(a.Value)
+			}
+		}
+
+		if p.id == "" {
+			return nil, fmt.Errorf("process without id")
+		}
+
+		if executable {
+			processes = append(processes, p)
+		}
+	}
+}
+
+// containsCSV reports whether the comma-separated list contains the value
+func containsCSV(list, value string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// like matches the value against the pattern of a like filter, % is a wildcard.
+// A pattern without wildcard matches substrings like the engine does
+func like(value, pattern string) bool {
+	if !strings.Contains(pattern, "%") {
+		return strings.Contains(value, pattern)
+	}
+
+	parts := strings.Split(pattern, "%")
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+
+	value = value[len(parts[0]):]
+	for _, p := range parts[1:] {
+		i := strings.Index(value, p)
+		if i < 0 {
+			return false
+		}
+
+		value = value[i+len(p):]
+	}
+
+	return strings.HasSuffix(pattern, "%") || value == ""
+}
+
+// matchTenant checks the tenant filters of the query
+func matchTenant(q url.Values, tenantID string) bool {
+	if q.Get("withoutTenantId") == "true" && tenantID != "" {
+		return false
+	}
+
+	return matchIn(q, "tenantIdIn", tenantID)
+}
+
+// page applies firstResult and maxResults of the query to the slice of items
+func page(items interface{}, q url.Values) interface{} {
+	v := reflect.ValueOf(items)
+
+	first, _ := strconv.Atoi(q.Get("firstResult"))
+	if first < 0 || first > v.Len() {
+		first = v.Len()
+	}
+
+	end := v.Len()
+	if max, err := strconv.Atoi(q.Get("maxResults")); err == nil && max >= 0 && first+max < end {
+		end = first + max
+	}
+
+	return v.Slice(first, end).Interface()
+}
@@ -0,0 +1,260 @@
+// Package fakeengine an in-memory fake of the Camunda engine REST API for offline tests.
+// It serves the endpoints used by this module (deployments, process definitions and instances, variables,
+// external and user tasks, messages, historic activity instances) from an httptest.Server
+package fakeengine
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// basePath the path of the REST API, the same as of the engine distribution
+const basePath = "/engine-rest"
+
+// version the engine version reported by the fake
+const version = "7.14.0-fake"
+
+// Engine an in-memory fake engine
+type Engine struct {
+	server *httptest.Server
+	routes []route
+	// closed ends the long polling requests on Close
+	closed chan struct{}
+
+	mu sync.Mutex
+	// changed closed and replaced when the external tasks change, wakes up the long polling requests
+	changed chan struct{}
+
+	deployments   []*Deployment
+	definitions   []*ProcessDefinition
+	instances     []*ProcessInstance
+	externalTasks []*ExternalTask
+	userTasks     []*UserTask
+	activities    []*ActivityInstance
+	messages      []camunda.MessageRequest
+	requests      []Request
+	// localVariables the local variables of the executions by execution id
+	localVariables map[string]camunda.Variables
+	executor       Executor
+}
+
+// Request a request received by the engine
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Time   time.Time
+}
+
+// New starts a fake engine, call Close after the test
+func New() *Engine {
+	e := &Engine{
+		changed:        make(chan struct{}),
+		closed:         make(chan struct{}),
+		localVariables: make(map[string]camunda.Variables),
+	}
+
+	e.registerRoutes()
+	e.server = httptest.NewServer(http.HandlerFunc(e.serveHTTP))
+
+	return e
+}
+
+// Close stops the server
+func (e *Engine) Close() {
+	close(e.closed)
+	e.server.Close()
+}
+
+// URL the endpoint URL of the REST API
+func (e *Engine) URL() string {
+	return e.server.URL + basePath
+}
+
+// Client creates a client of the engine
+func (e *Engine) Client() *camunda.Client {
+	return camunda.NewClient(&camunda.ClientOptions{EndpointUrl: e.URL()})
+}
+
+// Requests returns the requests received so far
+func (e *Engine) Requests() []Request {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Request(nil), e.requests...)
+}
+
+// notifyChange wakes up the long polling requests, must be called with mu held
+func (e *Engine) notifyChange() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// route a handler of a method and path pattern. Segments of the pattern in braces are parameters
+type route struct {
+	method  string
+	pattern []string
+	handle  func(w http.ResponseWriter, r *http.Request, params map[string]string)
+}
+
+// handle registers a route
+func (e *Engine) handle(method, pattern string, h func(w http.ResponseWriter, r *http.Request, params map[string]string)) {
+	e.routes = append(e.routes, route{
+		method:  method,
+		pattern: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handle:  h,
+	})
+}
+
+// match returns the parameters if the path matches the pattern
+func (rt *route) match(method string, parts []string) (map[string]string, bool) {
+	if rt.method != method || len(rt.pattern) != len(parts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, p := range rt.pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			params[p[1:len(p)-1]] = parts[i]
+			continue
+		}
+
+		if p != parts[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func (e *Engine) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.requests = append(e.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Time:   time.Now(),
+	})
+	e.mu.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+		writeError(w, http.StatusNotFound, "RestException", "unknown path "+r.URL.Path)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, basePath), "/"), "/")
+	for i := range e.routes {
+		if params, ok := e.routes[i].match(r.Method, parts); ok {
+			e.routes[i].handle(w, r, params)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotImplemented, "RestException",
+		fmt.Sprintf("%s %s is not supported by the fake engine", r.Method, r.URL.Path))
+}
+
+func (e *Engine) registerRoutes() {
+	e.handle(http.MethodGet, "/version", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		writeJSON(w, http.StatusOK, camunda.ResVersion{Version: version})
+	})
+
+	e.registerDeploymentRoutes()
+	e.registerDefinitionRoutes()
+	e.registerInstanceRoutes()
+	e.registerExternalTaskRoutes()
+	e.registerUserTaskRoutes()
+	e.registerMessageRoutes()
+	e.registerHistoryRoutes()
+}
+
+// writeJSON writes the response as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of the engine
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, camunda.Error{Type: errType, Message: message})
+}
+
+// notFound writes the error of a missing resource
+func notFound(w http.ResponseWriter, format string, args ...interface{}) {
+	writeError(w, http.StatusNotFound, "InvalidRequestException", fmt.Sprintf(format, args...))
+}
+
+// badRequest writes the error of an invalid request
+func badRequest(w http.ResponseWriter, format string, args ...interface{}) {
+	writeError(w, http.StatusBadRequest, "InvalidRequestException", fmt.Sprintf(format, args...))
+}
+
+// readJSON decodes the request body, an empty body leaves v unchanged
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Body == nil {
+		return true
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		badRequest(w, "cannot parse request body: %s", err)
+		return false
+	}
+
+	return true
+}
+
+// newID generates a random UUID like the engine does
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// formatTime formats the time like the engine does
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(camunda.DefaultDateTimeFormat)
+}
+
+// copyVariables returns a shallow copy of the variables
+func copyVariables(vars camunda.Variables) camunda.Variables {
+	res := make(camunda.Variables, len(vars))
+	for k, v := range vars {
+		if v == nil {
+			continue
+		}
+
+		c := *v
+		res[k] = &c
+	}
+
+	return res
+}
+
+// mergeVariables sets the variables of src in dst
+func mergeVariables(dst, src camunda.Variables) {
+	for k, v := range src {
+		if v == nil {
+			continue
+		}
+
+		c := *v
+		dst[k] = &c
+	}
+}
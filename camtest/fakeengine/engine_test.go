@@ -0,0 +1,91 @@
+package fakeengine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestEngine_ExternalTask(t *testing.T) {
+	e := fakeengine.New()
+	defer e.Close()
+
+	tm := e.Client().TaskManager()
+	task := e.AddExternalTask(fakeengine.ExternalTask{TopicName: "test-topic"})
+
+	fetch := func() []*camunda.ResLockedExternalTask {
+		t.Helper()
+
+		tasks, err := tm.FetchAndLock(camunda.FetchAndLockRequest{
+			WorkerID: "test-worker",
+			MaxTasks: 10,
+			Topics:   []*camunda.TopicLockConfig{{TopicName: "test-topic", LockDuration: 60000}},
+		})
+		if err != nil {
+			t.Fatalf("cannot fetch: %s", err)
+		}
+
+		return tasks
+	}
+
+	if tasks := fetch(); len(tasks) != 1 || tasks[0].ID != task.ID {
+		t.Fatalf("fetched %d tasks, want the added task", len(tasks))
+	}
+
+	if tasks := fetch(); len(tasks) != 0 {
+		t.Fatalf("fetched %d locked tasks", len(tasks))
+	}
+
+	err := tm.TaskFailed(task.ID, camunda.Failure{WorkerID: "test-worker", ErrorMessage: "failed", Retries: 1})
+	if err != nil {
+		t.Fatalf("cannot report failure: %s", err)
+	}
+
+	if tasks := fetch(); len(tasks) != 1 || tasks[0].Retries != 1 || tasks[0].ErrorMessage != "failed" {
+		t.Fatalf("failed task not fetched again with the retries and error")
+	}
+
+	workerID := "test-worker"
+	err = tm.Complete(task.ID, camunda.QueryComplete{
+		WorkerID:  &workerID,
+		Variables: camunda.Variables{"result": {Value: "ok", Type: "String"}},
+	})
+	if err != nil {
+		t.Fatalf("cannot complete: %s", err)
+	}
+
+	if got := e.ExternalTasks()[0].State; got != fakeengine.TaskCompleted {
+		t.Errorf("task state: got %s, want %s", got, fakeengine.TaskCompleted)
+	}
+
+	if err := tm.Complete(task.ID, camunda.QueryComplete{WorkerID: &workerID}); err == nil {
+		t.Errorf("completed task completed again")
+	}
+}
+
+func TestEngine_LongPolling(t *testing.T) {
+	e := fakeengine.New()
+	defer e.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		e.AddExternalTask(fakeengine.ExternalTask{TopicName: "test-topic"})
+	}()
+
+	timeout := 5000
+	tasks, err := e.Client().TaskManager().FetchAndLock(camunda.FetchAndLockRequest{
+		WorkerID:             "test-worker",
+		MaxTasks:             1,
+		AsyncResponseTimeout: &timeout,
+		Topics:               []*camunda.TopicLockConfig{{TopicName: "test-topic", LockDuration: 60000}},
+	})
+	if err != nil {
+		t.Fatalf("cannot fetch: %s", err)
+	}
+
+	if len(tasks) != 1 {
+		t.Fatalf("fetched %d tasks, want the task added while polling", len(tasks))
+	}
+}
@@ -0,0 +1,116 @@
+package fakeengine
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Executor runs the process models of the engine. Without an executor a started instance waits for the tasks
+// added by the test. The methods are called with the engine locked and change it through the Tx,
+// an error of a method fails the request of the event
+type Executor interface {
+	// InstanceStarted the process instance was started, an error removes the instance
+	InstanceStarted(tx *Tx, inst *ProcessInstance) error
+	// ExternalTaskFinished the external task was completed or a BPMN error was reported
+	ExternalTaskFinished(tx *Tx, t *ExternalTask) error
+	// UserTaskCompleted the user task was completed
+	UserTaskCompleted(tx *Tx, t *UserTask) error
+	// Correlate correlates the message to a waiting execution or a message start event
+	Correlate(tx *Tx, msg *camunda.MessageRequest) error
+}
+
+// SetExecutor sets the executor running the instances started from now on
+func (e *Engine) SetExecutor(x Executor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.executor = x
+}
+
+// execute runs the event by the executor, if any, and writes the error of the executor.
+// Must be called with mu held
+func (e *Engine) execute(w http.ResponseWriter, event func(x Executor, tx *Tx) error) bool {
+	if e.executor == nil {
+		return true
+	}
+
+	if err := event(e.executor, &Tx{e: e}); err != nil {
+		writeError(w, http.StatusInternalServerError, "ProcessEngineException", err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Tx changes the locked engine from an Executor. The returned objects are the state of the engine,
+// they must not be kept after the method of the executor returns
+type Tx struct {
+	e *Engine
+}
+
+// Definition returns the process definition by id, nil if not found
+func (tx *Tx) Definition(id string) *ProcessDefinition {
+	return tx.e.definition(id)
+}
+
+// LatestDefinitions returns the latest version of every process definition
+func (tx *Tx) LatestDefinitions() []*ProcessDefinition {
+	var res []*ProcessDefinition
+	for _, def := range tx.e.definitions {
+		if tx.e.latestDefinition(def.Key, def.TenantID) == def {
+			res = append(res, def)
+		}
+	}
+
+	return res
+}
+
+// Instance returns the process instance by id, nil if not found
+func (tx *Tx) Instance(id string) *ProcessInstance {
+	return tx.e.instance(id)
+}
+
+// StartInstance creates a process instance without notifying the executor, which runs it itself
+func (tx *Tx) StartInstance(def *ProcessDefinition, businessKey string, vars camunda.Variables) (*ProcessInstance, error) {
+	return tx.e.createInstance(def, businessKey, vars)
+}
+
+// EndInstance ends the process instance and cancels its open tasks and activities
+func (tx *Tx) EndInstance(inst *ProcessInstance) {
+	tx.e.endInstance(inst)
+}
+
+// AddExternalTask creates an external task, see Engine.AddExternalTask
+func (tx *Tx) AddExternalTask(t *ExternalTask) *ExternalTask {
+	return tx.e.addExternalTask(t)
+}
+
+// AddUserTask creates a user task, see Engine.AddUserTask
+func (tx *Tx) AddUserTask(t *UserTask) *UserTask {
+	return tx.e.addUserTask(t)
+}
+
+// StartActivity records the start of an activity of the process instance
+func (tx *Tx) StartActivity(inst *ProcessInstance, executionID, activityID, activityName, activityType string) *ActivityInstance {
+	a := &ActivityInstance{
+		ID:                  activityID + ":" + newID(),
+		ActivityID:          activityID,
+		ActivityName:        activityName,
+		ActivityType:        activityType,
+		ProcessInstanceID:   inst.ID,
+		ProcessDefinitionID: inst.DefinitionID,
+		ExecutionID:         executionID,
+		StartTime:           time.Now(),
+	}
+	tx.e.activities = append(tx.e.activities, a)
+
+	return a
+}
+
+// EndActivity records the end of the activity, canceled if it was interrupted
+func (tx *Tx) EndActivity(a *ActivityInstance, canceled bool) {
+	a.EndTime = time.Now()
+	a.Canceled = canceled
+}
@@ -0,0 +1,576 @@
+package fakeengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// maxAsyncResponseTimeout the maximum long polling timeout accepted by the engine
+const maxAsyncResponseTimeout = 30 * time.Minute
+
+func (e *Engine) registerExternalTaskRoutes() {
+	e.handle(http.MethodGet, "/external-task", e.listExternalTasks)
+	e.handle(http.MethodPost, "/external-task", e.listExternalTasks)
+	e.handle(http.MethodGet, "/external-task/count", e.countExternalTasks)
+	e.handle(http.MethodPost, "/external-task/count", e.countExternalTasks)
+	e.handle(http.MethodPost, "/external-task/fetchAndLock", e.fetchAndLock)
+
+	e.handle(http.MethodGet, "/external-task/{id}", e.externalTaskRoute(func(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+		writeJSON(w, http.StatusOK, e.externalTaskResponse(t))
+	}))
+	e.handle(http.MethodPost, "/external-task/{id}/complete", e.externalTaskRoute(e.completeExternalTask))
+	e.handle(http.MethodPost, "/external-task/{id}/failure", e.externalTaskRoute(e.failExternalTask))
+	e.handle(http.MethodPost, "/external-task/{id}/bpmnError", e.externalTaskRoute(e.externalTaskBPMNError))
+	e.handle(http.MethodPost, "/external-task/{id}/unlock", e.externalTaskRoute(func(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+		t.WorkerID = ""
+		t.LockExpiration = time.Time{}
+		e.notifyChange()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	e.handle(http.MethodPost, "/external-task/{id}/extendLock", e.externalTaskRoute(e.extendExternalTaskLock))
+	e.handle(http.MethodPut, "/external-task/{id}/retries", e.externalTaskRoute(func(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+		var req struct {
+			Retries *int `json:"retries"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if req.Retries == nil || *req.Retries < 0 {
+			badRequest(w, "retries must be a number >= 0")
+			return
+		}
+
+		t.Retries = req.Retries
+		e.notifyChange()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	e.handle(http.MethodPut, "/external-task/{id}/priority", e.externalTaskRoute(func(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+		var req struct {
+			Priority *int `json:"priority"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if req.Priority != nil {
+			t.Priority = *req.Priority
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// externalTaskRoute resolves the active external task of the path, the handler runs with mu held
+func (e *Engine) externalTaskRoute(h func(w http.ResponseWriter, r *http.Request, t *ExternalTask)) func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		t := e.externalTask(params["id"])
+		if t == nil || t.State != TaskActive {
+			notFound(w, "external task with id %s does not exist", params["id"])
+			return
+		}
+
+		h(w, r, t)
+	}
+}
+
+// lockedBy writes an error unless the task is locked by the worker
+func lockedBy(w http.ResponseWriter, t *ExternalTask, workerID string) bool {
+	if t.WorkerID == "" || t.WorkerID != workerID {
+		badRequest(w, "external task %s is not locked by worker %s", t.ID, workerID)
+		return false
+	}
+
+	return true
+}
+
+func (e *Engine) completeExternalTask(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+	var req camunda.QueryComplete
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	workerID := ""
+	if req.WorkerID != nil {
+		workerID = *req.WorkerID
+	}
+
+	if !lockedBy(w, t, workerID) {
+		return
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		mergeVariables(inst.Variables, req.Variables)
+	}
+
+	if len(req.LocalVariables) > 0 {
+		if e.localVariables[t.ExecutionID] == nil {
+			e.localVariables[t.ExecutionID] = camunda.Variables{}
+		}
+		mergeVariables(e.localVariables[t.ExecutionID], req.LocalVariables)
+	}
+
+	t.State = TaskCompleted
+	e.notifyChange()
+
+	if !e.execute(w, func(x Executor, tx *Tx) error { return x.ExternalTaskFinished(tx, t) }) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) failExternalTask(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+	var req camunda.Failure
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if !lockedBy(w, t, req.WorkerID) {
+		return
+	}
+
+	if req.Retries < 0 || req.RetryTimeout < 0 {
+		badRequest(w, "retries and retryTimeout must be >= 0")
+		return
+	}
+
+	retries := req.Retries
+	t.Retries = &retries
+	t.ErrorMessage = req.ErrorMessage
+	t.ErrorDetails = req.ErrorDetails
+	t.LockExpiration = time.Time{}
+	t.AvailableAt = time.Now().Add(time.Duration(req.RetryTimeout) * time.Millisecond)
+	e.notifyChange()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) externalTaskBPMNError(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+	var req camunda.QueryHandleBPMNError
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if !lockedBy(w, t, req.WorkerID) {
+		return
+	}
+
+	if req.ErrorCode == "" {
+		badRequest(w, "errorCode is required")
+		return
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		mergeVariables(inst.Variables, req.Variables)
+	}
+
+	t.ErrorCode = req.ErrorCode
+	t.ErrorMessage = req.ErrorMessage
+	t.State = TaskBPMNError
+	e.notifyChange()
+
+	if !e.execute(w, func(x Executor, tx *Tx) error { return x.ExternalTaskFinished(tx, t) }) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) extendExternalTaskLock(w http.ResponseWriter, r *http.Request, t *ExternalTask) {
+	var req camunda.QueryExtendLock
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if !lockedBy(w, t, req.WorkerID) {
+		return
+	}
+
+	now := time.Now()
+	if !t.locked(now) {
+		badRequest(w, "the lock of external task %s has already expired", t.ID)
+		return
+	}
+
+	if req.NewDuration <= 0 {
+		badRequest(w, "newDuration must be > 0")
+		return
+	}
+
+	t.LockExpiration = now.Add(time.Duration(req.NewDuration) * time.Millisecond)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) fetchAndLock(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var req camunda.FetchAndLockRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.WorkerID == "" {
+		badRequest(w, "workerId is required")
+		return
+	}
+
+	timeout := time.Duration(0)
+	if req.AsyncResponseTimeout != nil {
+		timeout = time.Duration(*req.AsyncResponseTimeout) * time.Millisecond
+		if timeout > maxAsyncResponseTimeout {
+			badRequest(w, "asyncResponseTimeout cannot be set larger than %d", maxAsyncResponseTimeout.Milliseconds())
+			return
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		e.mu.Lock()
+		now := time.Now()
+		locked := e.lockExternalTasks(&req, now)
+		changed := e.changed
+		next := e.nextAvailable(now)
+		e.mu.Unlock()
+
+		if len(locked) > 0 || timeout == 0 {
+			writeJSON(w, http.StatusOK, locked)
+			return
+		}
+
+		if !e.waitChange(r, changed, deadline.C, next.Sub(now)) {
+			writeJSON(w, http.StatusOK, locked)
+			return
+		}
+	}
+}
+
+// waitChange waits for a change of the tasks or until wake elapses, if positive.
+// Returns false at the deadline, when the request is cancelled or the engine is closed
+func (e *Engine) waitChange(r *http.Request, changed <-chan struct{}, deadline <-chan time.Time, wake time.Duration) bool {
+	var retry <-chan time.Time
+	if wake > 0 {
+		timer := time.NewTimer(wake)
+		defer timer.Stop()
+		retry = timer.C
+	}
+
+	select {
+	case <-changed:
+	case <-retry:
+	case <-deadline:
+		return false
+	case <-r.Context().Done():
+		return false
+	case <-e.closed:
+		return false
+	}
+
+	return true
+}
+
+// lockExternalTasks locks the tasks matching the request for the worker, must be called with mu held
+func (e *Engine) lockExternalTasks(req *camunda.FetchAndLockRequest, now time.Time) []*camunda.ResLockedExternalTask {
+	type candidate struct {
+		task  *ExternalTask
+		topic *camunda.TopicLockConfig
+	}
+
+	var candidates []candidate
+
+	for _, t := range e.externalTasks {
+		inst := e.instance(t.ProcessInstanceID)
+		if !t.fetchable(now) || (inst != nil && inst.Suspended) {
+			continue
+		}
+
+		for _, topic := range req.Topics {
+			if topic != nil && matchTopic(topic, t, inst) {
+				candidates = append(candidates, candidate{task: t, topic: topic})
+				break
+			}
+		}
+	}
+
+	if req.UsePriority != nil && *req.UsePriority {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].task.Priority > candidates[j].task.Priority
+		})
+	}
+
+	res := []*camunda.ResLockedExternalTask{}
+
+	for _, c := range candidates {
+		if len(res) >= req.MaxTasks {
+			break
+		}
+
+		c.task.WorkerID = req.WorkerID
+		c.task.LockExpiration = now.Add(time.Duration(c.topic.LockDuration) * time.Millisecond)
+
+		base := e.externalTaskResponse(c.task).TaskBase
+		res = append(res, &camunda.ResLockedExternalTask{
+			TaskBase:    &base,
+			BusinessKey: c.task.BusinessKey,
+			Variables:   e.taskVariables(c.task, c.topic),
+		})
+	}
+
+	return res
+}
+
+// nextAvailable returns the time the next task becomes fetchable by an expired lock or retry timeout,
+// zero if none, must be called with mu held
+func (e *Engine) nextAvailable(now time.Time) time.Time {
+	var next time.Time
+
+	for _, t := range e.externalTasks {
+		if t.State != TaskActive || t.Incident() {
+			continue
+		}
+
+		at := t.AvailableAt
+		if t.locked(now) && t.LockExpiration.After(at) {
+			at = t.LockExpiration
+		}
+
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+
+	return next
+}
+
+// matchTopic checks the task against the topic and its filters
+func matchTopic(topic *camunda.TopicLockConfig, t *ExternalTask, inst *ProcessInstance) bool {
+	switch {
+	case topic.TopicName != t.TopicName,
+		topic.BusinessKey != "" && topic.BusinessKey != t.BusinessKey,
+		topic.ProcessDefinitionID != "" && topic.ProcessDefinitionID != t.ProcessDefinitionID,
+		len(topic.ProcessDefinitionIDIn) > 0 && !contains(topic.ProcessDefinitionIDIn, t.ProcessDefinitionID),
+		topic.ProcessDefinitionKey != "" && topic.ProcessDefinitionKey != t.ProcessDefinitionKey,
+		len(topic.ProcessDefinitionKeyIn) > 0 && !contains(topic.ProcessDefinitionKeyIn, t.ProcessDefinitionKey),
+		topic.WithoutTenantID != nil && *topic.WithoutTenantID && t.TenantID != "",
+		len(topic.TenantIDIn) > 0 && !contains(topic.TenantIDIn, t.TenantID):
+		return false
+	}
+
+	for name, want := range topic.ProcessVariables {
+		if inst == nil || want == nil {
+			return false
+		}
+
+		got, ok := inst.Variables[name]
+		if !ok || fmt.Sprint(got.Value) != fmt.Sprint(want.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// taskVariables returns the variables of the task requested by the topic, must be called with mu held
+func (e *Engine) taskVariables(t *ExternalTask, topic *camunda.TopicLockConfig) camunda.Variables {
+	all := camunda.Variables{}
+	if topic.LocalVariables == nil || !*topic.LocalVariables {
+		if inst := e.instance(t.ProcessInstanceID); inst != nil {
+			mergeVariables(all, inst.Variables)
+		}
+	}
+	mergeVariables(all, e.localVariables[t.ExecutionID])
+
+	if topic.Variables == nil {
+		return all
+	}
+
+	res := camunda.Variables{}
+	for _, name := range topic.Variables {
+		if v, ok := all[name]; ok {
+			res[name] = v
+		}
+	}
+
+	return res
+}
+
+func (e *Engine) listExternalTasks(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q, ok := filterParams(w, r)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.ResExternalTask{}
+	for _, t := range e.filterExternalTasks(q) {
+		res = append(res, e.externalTaskResponse(t))
+	}
+
+	writeJSON(w, http.StatusOK, page(res, r.URL.Query()))
+}
+
+func (e *Engine) countExternalTasks(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q, ok := filterParams(w, r)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &camunda.ResponseCount{Count: len(e.filterExternalTasks(q))})
+}
+
+// filterParams reads the filter of the query string of a GET request or the body of a POST request.
+// The body is read with the field names of the engine, lists may be arrays or comma-separated strings
+func filterParams(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if r.Method == http.MethodGet {
+		return r.URL.Query(), true
+	}
+
+	var body map[string]json.RawMessage
+	if !readJSON(w, r, &body) {
+		return nil, false
+	}
+
+	q := url.Values{}
+	for name, raw := range body {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err == nil {
+			q.Set(name, strings.Join(list, ","))
+			continue
+		}
+
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+			continue
+		}
+		q.Set(name, fmt.Sprint(v))
+	}
+
+	return q, true
+}
+
+// filterExternalTasks returns the active tasks matching the query, must be called with mu held
+func (e *Engine) filterExternalTasks(q url.Values) []*ExternalTask {
+	var res []*ExternalTask
+
+	now := time.Now()
+	for _, t := range e.externalTasks {
+		inst := e.instance(t.ProcessInstanceID)
+		suspended := inst != nil && inst.Suspended
+
+		switch {
+		case t.State != TaskActive,
+			q.Get("externalTaskId") != "" && q.Get("externalTaskId") != t.ID,
+			!matchIn(q, "externalTaskIdIn", t.ID),
+			q.Get("topicName") != "" && q.Get("topicName") != t.TopicName,
+			q.Get("workerId") != "" && q.Get("workerId") != t.WorkerID,
+			q.Get("locked") == "true" && !t.locked(now),
+			q.Get("notLocked") == "true" && t.locked(now),
+			q.Get("withRetriesLeft") == "true" && t.Incident(),
+			q.Get("noRetriesLeft") == "true" && !t.Incident(),
+			q.Get("activityId") != "" && q.Get("activityId") != t.ActivityID,
+			!matchIn(q, "activityIdIn", t.ActivityID),
+			q.Get("executionId") != "" && q.Get("executionId") != t.ExecutionID,
+			q.Get("processInstanceId") != "" && q.Get("processInstanceId") != t.ProcessInstanceID,
+			q.Get("processDefinitionId") != "" && q.Get("processDefinitionId") != t.ProcessDefinitionID,
+			q.Get("active") == "true" && suspended,
+			q.Get("suspended") == "true" && !suspended,
+			!matchPriority(q, t.Priority),
+			!matchTenant(q, t.TenantID):
+			continue
+		}
+
+		res = append(res, t)
+	}
+
+	return res
+}
+
+// matchPriority checks the priority filters of the query
+func matchPriority(q url.Values, priority int) bool {
+	if min, err := strconv.Atoi(q.Get("priorityHigherThanOrEquals")); err == nil && priority < min {
+		return false
+	}
+
+	if max, err := strconv.Atoi(q.Get("priorityLowerThanOrEquals")); err == nil && priority > max {
+		return false
+	}
+
+	return true
+}
+
+// externalTask returns the task by id, must be called with mu held
+func (e *Engine) externalTask(id string) *ExternalTask {
+	for _, t := range e.externalTasks {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// externalTaskResponse must be called with mu held
+func (e *Engine) externalTaskResponse(t *ExternalTask) *camunda.ResExternalTask {
+	res := &camunda.ResExternalTask{
+		TaskBase: camunda.TaskBase{
+			ActivityID:           t.ActivityID,
+			ActivityInstanceID:   t.ActivityInstanceID,
+			ErrorMessage:         t.ErrorMessage,
+			ErrorDetails:         t.ErrorDetails,
+			ExecutionID:          t.ExecutionID,
+			ID:                   t.ID,
+			ProcessDefinitionID:  t.ProcessDefinitionID,
+			ProcessDefinitionKey: t.ProcessDefinitionKey,
+			ProcessInstanceID:    t.ProcessInstanceID,
+			TenantID:             t.TenantID,
+			WorkerID:             t.WorkerID,
+			Priority:             t.Priority,
+			TopicName:            t.TopicName,
+		},
+		BusinessKey: t.BusinessKey,
+	}
+
+	if t.Retries != nil {
+		res.Retries = *t.Retries
+	}
+
+	if t.WorkerID != "" {
+		res.LockExpirationTime = formatTime(t.LockExpiration)
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		res.Suspended = inst.Suspended
+	}
+
+	return res
+}
+
+// contains reports whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package fakeengine
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/interticketinc/camunda"
+)
+
+func (e *Engine) registerHistoryRoutes() {
+	e.handle(http.MethodGet, "/history/activity-instance", e.listHistoricActivities)
+	e.handle(http.MethodGet, "/history/process-instance/{id}", e.getHistoricInstance)
+	e.handle(http.MethodGet, "/history/variable-instance", e.listHistoricVariables)
+}
+
+func (e *Engine) listHistoricActivities(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q := r.URL.Query()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.ResHistoricActivityInstance{}
+	for _, a := range e.activities {
+		ended := !a.EndTime.IsZero()
+
+		switch {
+		case q.Get("activityInstanceId") != "" && q.Get("activityInstanceId") != a.ID,
+			q.Get("processInstanceId") != "" && q.Get("processInstanceId") != a.ProcessInstanceID,
+			q.Get("processDefinitionId") != "" && q.Get("processDefinitionId") != a.ProcessDefinitionID,
+			q.Get("executionId") != "" && q.Get("executionId") != a.ExecutionID,
+			q.Get("activityId") != "" && q.Get("activityId") != a.ActivityID,
+			q.Get("activityType") != "" && q.Get("activityType") != a.ActivityType,
+			q.Get("finished") == "true" && !ended,
+			q.Get("unfinished") == "true" && ended,
+			q.Get("canceled") == "true" && !a.Canceled:
+			continue
+		}
+
+		if h := e.historicActivityResponse(a); matchTenant(q, h.TenantID) {
+			res = append(res, h)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page(res, q))
+}
+
+// historicActivityResponse converts the activity instance, must be called with mu held
+func (e *Engine) historicActivityResponse(a *ActivityInstance) *camunda.ResHistoricActivityInstance {
+	res := &camunda.ResHistoricActivityInstance{
+		ID:                  a.ID,
+		ActivityID:          a.ActivityID,
+		ActivityName:        a.ActivityName,
+		ActivityType:        a.ActivityType,
+		ProcessDefinitionID: a.ProcessDefinitionID,
+		ProcessInstanceID:   a.ProcessInstanceID,
+		ExecutionID:         a.ExecutionID,
+		StartTime:           camunda.Time{Time: a.StartTime},
+		Canceled:            a.Canceled,
+	}
+
+	if def := e.definition(a.ProcessDefinitionID); def != nil {
+		res.ProcessDefinitionKey = def.Key
+		res.TenantID = def.TenantID
+	}
+
+	if !a.EndTime.IsZero() {
+		res.EndTime = &camunda.Time{Time: a.EndTime}
+		res.DurationInMillis = a.EndTime.Sub(a.StartTime).Milliseconds()
+	}
+
+	for _, t := range e.userTasks {
+		if t.ProcessInstanceID == a.ProcessInstanceID && t.TaskDefinitionKey == a.ActivityID && t.ExecutionID == a.ExecutionID {
+			res.TaskID = t.ID
+			res.Assignee = t.Assignee
+		}
+	}
+
+	return res
+}
+
+func (e *Engine) getHistoricInstance(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inst := e.instance(params["id"])
+	if inst == nil {
+		notFound(w, "historic process instance with id %s does not exist", params["id"])
+		return
+	}
+
+	res := &camunda.ResHistoricProcessInstance{
+		ID:                   inst.ID,
+		BusinessKey:          inst.BusinessKey,
+		ProcessDefinitionID:  inst.DefinitionID,
+		ProcessDefinitionKey: inst.DefinitionKey,
+		StartTime:            camunda.Time{Time: inst.StartTime},
+		TenantID:             inst.TenantID,
+	}
+
+	if def := e.definition(inst.DefinitionID); def != nil {
+		res.ProcessDefinitionName = def.Name
+	}
+
+	for _, a := range e.activities {
+		if a.ProcessInstanceID == inst.ID {
+			res.StartActivityID = a.ActivityID
+			break
+		}
+	}
+
+	switch {
+	case inst.Ended:
+		res.State = "COMPLETED"
+		res.EndTime = &camunda.Time{Time: inst.EndTime}
+		res.DurationInMillis = inst.EndTime.Sub(inst.StartTime).Milliseconds()
+	case inst.Suspended:
+		res.State = "SUSPENDED"
+	default:
+		res.State = "ACTIVE"
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// listHistoricVariables lists the current process variables of the instances, the fake keeps no variable history
+func (e *Engine) listHistoricVariables(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q := r.URL.Query()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.ResHistoricVariableInstance{}
+	for _, inst := range e.instances {
+		if q.Get("processInstanceId") != "" && q.Get("processInstanceId") != inst.ID {
+			continue
+		}
+
+		names := make([]string, 0, len(inst.Variables))
+		for name := range inst.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			v := inst.Variables[name]
+			if v == nil || q.Get("variableName") != "" && q.Get("variableName") != name {
+				continue
+			}
+
+			res = append(res, &camunda.ResHistoricVariableInstance{
+				ID:                inst.ID + ":" + name,
+				Name:              name,
+				Type:              v.Type,
+				Value:             v.Value,
+				ValueInfo:         v.ValueInfo,
+				ProcessInstanceID: inst.ID,
+				ExecutionID:       inst.ID,
+				State:             "CREATED",
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page(res, q))
+}
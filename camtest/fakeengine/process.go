@@ -0,0 +1,496 @@
+package fakeengine
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/interticketinc/camunda"
+)
+
+func (e *Engine) registerDefinitionRoutes() {
+	e.handle(http.MethodGet, "/process-definition", e.listDefinitions)
+	e.handle(http.MethodGet, "/process-definition/count", e.countDefinitions)
+	e.handle(http.MethodPut, "/process-definition/suspended", e.suspendDefinitionsByKey)
+
+	e.definitionRoute(http.MethodGet, "", func(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+		writeJSON(w, http.StatusOK, definitionResponse(def))
+	})
+	e.definitionRoute(http.MethodGet, "/xml", func(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+		writeJSON(w, http.StatusOK, &camunda.ResBPMNProcessDefinition{Id: def.ID, Bpmn20Xml: string(def.XML)})
+	})
+	e.definitionRoute(http.MethodPost, "/start", e.startDefinition)
+	e.definitionRoute(http.MethodPost, "/submit-form", e.submitStartForm)
+	e.definitionRoute(http.MethodPut, "/suspended", e.suspendDefinition)
+	e.definitionRoute(http.MethodDelete, "", e.deleteDefinition)
+}
+
+// definitionRoute registers the handler for the paths of a process definition by id, by key and by key and tenant.
+// The handler runs with mu held
+func (e *Engine) definitionRoute(method, suffix string, h func(w http.ResponseWriter, r *http.Request, def *ProcessDefinition)) {
+	handler := func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		var def *ProcessDefinition
+		if key, ok := params["key"]; ok {
+			def = e.latestDefinition(key, params["tenant"])
+		} else {
+			def = e.definition(params["id"])
+		}
+
+		if def == nil {
+			notFound(w, "no matching process definition %s", strings.TrimPrefix(r.URL.Path, basePath+"/process-definition/"))
+			return
+		}
+
+		h(w, r, def)
+	}
+
+	// The key routes are registered first, so a key is not taken for an id
+	e.handle(method, "/process-definition/key/{key}/tenant-id/{tenant}"+suffix, handler)
+	e.handle(method, "/process-definition/key/{key}"+suffix, handler)
+	e.handle(method, "/process-definition/{id}"+suffix, handler)
+}
+
+func (e *Engine) listDefinitions(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.ProcessDefinitionResponse{}
+	for _, def := range e.filterDefinitions(r.URL.Query()) {
+		res = append(res, definitionResponse(def))
+	}
+
+	writeJSON(w, http.StatusOK, page(res, r.URL.Query()))
+}
+
+func (e *Engine) countDefinitions(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &camunda.ResponseCount{Count: len(e.filterDefinitions(r.URL.Query()))})
+}
+
+func (e *Engine) startDefinition(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+	var req camunda.InstanceParams
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	inst, err := e.startInstance(def, req.BusinessKey, req.Variables)
+	if err != nil {
+		badRequest(w, "%s", err)
+		return
+	}
+
+	res := &camunda.ProcessDefinition{
+		Id:           inst.ID,
+		DefinitionId: inst.DefinitionID,
+		BusinessKey:  inst.BusinessKey,
+		TenantId:     inst.TenantID,
+		Ended:        inst.Ended,
+		Suspended:    inst.Suspended,
+		Links:        []camunda.ResLink{},
+	}
+
+	if req.WithVariablesInReturn {
+		res.Variables = make(map[string]camunda.Variable, len(inst.Variables))
+		for k, v := range inst.Variables {
+			res.Variables[k] = *v
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (e *Engine) submitStartForm(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+	var req camunda.ReqSubmitStartForm
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	vars := camunda.Variables{}
+	for k, v := range req.Variables {
+		v := v
+		vars[k] = &v
+	}
+
+	inst, err := e.startInstance(def, req.BusinessKey, vars)
+	if err != nil {
+		badRequest(w, "%s", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &camunda.ResSubmitStartForm{
+		Links:        []camunda.ResLink{},
+		Id:           inst.ID,
+		DefinitionId: inst.DefinitionID,
+		BusinessKey:  inst.BusinessKey,
+		Ended:        inst.Ended,
+		Suspended:    inst.Suspended,
+	})
+}
+
+func (e *Engine) suspendDefinition(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+	var req camunda.ReqActivateOrSuspendById
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Suspended == nil {
+		badRequest(w, "suspended is required")
+		return
+	}
+
+	e.setSuspended(def, *req.Suspended, req.IncludeProcessInstances != nil && *req.IncludeProcessInstances)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) suspendDefinitionsByKey(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var req camunda.ReqActivateOrSuspendByKey
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Suspended == nil {
+		badRequest(w, "suspended is required")
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	found := false
+	for _, def := range e.definitions {
+		if def.Key == req.ProcessDefinitionKey {
+			found = true
+			e.setSuspended(def, *req.Suspended, req.IncludeProcessInstances != nil && *req.IncludeProcessInstances)
+		}
+	}
+
+	if !found {
+		notFound(w, "no process definition with key %s", req.ProcessDefinitionKey)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) deleteDefinition(w http.ResponseWriter, r *http.Request, def *ProcessDefinition) {
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	for _, inst := range e.instances {
+		if inst.DefinitionID != def.ID || inst.Ended {
+			continue
+		}
+
+		if !cascade {
+			badRequest(w, "process definition %s has running process instances", def.ID)
+			return
+		}
+
+		e.endInstance(inst)
+	}
+
+	e.removeDefinitions(func(d *ProcessDefinition) bool {
+		return d == def
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setSuspended suspends or activates the definition, must be called with mu held
+func (e *Engine) setSuspended(def *ProcessDefinition, suspended, instances bool) {
+	def.Suspended = suspended
+
+	if !instances {
+		return
+	}
+
+	for _, inst := range e.instances {
+		if inst.DefinitionID == def.ID {
+			inst.Suspended = suspended
+		}
+	}
+
+	e.notifyChange()
+}
+
+// definition returns the process definition by id, must be called with mu held
+func (e *Engine) definition(id string) *ProcessDefinition {
+	for _, def := range e.definitions {
+		if def.ID == id {
+			return def
+		}
+	}
+
+	return nil
+}
+
+// latestDefinition returns the latest version of the process definition of the key and tenant,
+// must be called with mu held
+func (e *Engine) latestDefinition(key, tenantID string) *ProcessDefinition {
+	var latest *ProcessDefinition
+
+	for _, def := range e.definitions {
+		if def.Key != key || def.TenantID != tenantID {
+			continue
+		}
+
+		if latest == nil || def.Version > latest.Version {
+			latest = def
+		}
+	}
+
+	return latest
+}
+
+// removeDefinitions removes the matching definitions, must be called with mu held
+func (e *Engine) removeDefinitions(match func(def *ProcessDefinition) bool) {
+	kept := e.definitions[:0]
+	for _, def := range e.definitions {
+		if !match(def) {
+			kept = append(kept, def)
+		}
+	}
+
+	e.definitions = kept
+}
+
+// filterDefinitions returns the definitions matching the query, must be called with mu held
+func (e *Engine) filterDefinitions(q url.Values) []*ProcessDefinition {
+	var res []*ProcessDefinition
+
+	for _, def := range e.definitions {
+		switch {
+		case q.Get("processDefinitionId") != "" && q.Get("processDefinitionId") != def.ID,
+			!matchIn(q, "processDefinitionIdIn", def.ID),
+			q.Get("key") != "" && q.Get("key") != def.Key,
+			!matchIn(q, "keysIn", def.Key),
+			q.Get("name") != "" && q.Get("name") != def.Name,
+			q.Get("nameLike") != "" && !like(def.Name, q.Get("nameLike")),
+			q.Get("deploymentId") != "" && q.Get("deploymentId") != def.DeploymentID,
+			q.Get("version") != "" && q.Get("version") != strconv.Itoa(def.Version),
+			q.Get("latestVersion") == "true" && e.latestDefinition(def.Key, def.TenantID) != def,
+			q.Get("suspended") == "true" && !def.Suspended,
+			q.Get("active") == "true" && def.Suspended,
+			!matchTenant(q, def.TenantID):
+			continue
+		}
+
+		res = append(res, def)
+	}
+
+	return res
+}
+
+func definitionResponse(def *ProcessDefinition) *camunda.ProcessDefinitionResponse {
+	return &camunda.ProcessDefinitionResponse{
+		ID:           def.ID,
+		Key:          def.Key,
+		Name:         def.Name,
+		Version:      def.Version,
+		Resource:     def.Resource,
+		DeploymentID: def.DeploymentID,
+		Suspended:    def.Suspended,
+		TenantID:     def.TenantID,
+	}
+}
+
+func (e *Engine) registerInstanceRoutes() {
+	e.handle(http.MethodGet, "/process-instance", e.listInstances)
+	e.handle(http.MethodGet, "/process-instance/count", e.countInstances)
+	e.handle(http.MethodGet, "/process-instance/{id}", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		writeJSON(w, http.StatusOK, instanceResponse(inst))
+	}))
+	e.handle(http.MethodDelete, "/process-instance/{id}", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		e.endInstance(inst)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	e.handle(http.MethodGet, "/process-instance/{id}/variables", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		writeJSON(w, http.StatusOK, inst.Variables)
+	}))
+	e.handle(http.MethodPost, "/process-instance/{id}/variables", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		modifyVariables(w, r, inst.Variables)
+	}))
+	e.handle(http.MethodGet, "/process-instance/{id}/variables/{name}", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		name := params["name"]
+
+		v, ok := inst.Variables[name]
+		if !ok {
+			notFound(w, "variable %s of process instance %s does not exist", name, inst.ID)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, v)
+	}))
+	e.handle(http.MethodPut, "/process-instance/{id}/variables/{name}", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		v := &camunda.Variable{}
+		if !readJSON(w, r, v) {
+			return
+		}
+
+		inst.Variables[params["name"]] = v
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	e.handle(http.MethodDelete, "/process-instance/{id}/variables/{name}", e.instanceRoute(func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string) {
+		delete(inst.Variables, params["name"])
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	e.handle(http.MethodGet, "/execution/{id}/localVariables", e.executionRoute(func(w http.ResponseWriter, r *http.Request, vars camunda.Variables) {
+		writeJSON(w, http.StatusOK, vars)
+	}))
+	e.handle(http.MethodPost, "/execution/{id}/localVariables", e.executionRoute(func(w http.ResponseWriter, r *http.Request, vars camunda.Variables) {
+		modifyVariables(w, r, vars)
+	}))
+}
+
+// instanceRoute resolves the running process instance of the path, the handler runs with mu held
+func (e *Engine) instanceRoute(h func(w http.ResponseWriter, r *http.Request, inst *ProcessInstance, params map[string]string)) func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		inst := e.instance(params["id"])
+		if inst == nil || inst.Ended {
+			notFound(w, "process instance with id %s does not exist", params["id"])
+			return
+		}
+
+		h(w, r, inst, params)
+	}
+}
+
+// executionRoute resolves the local variables of the execution of the path, the handler runs with mu held
+func (e *Engine) executionRoute(h func(w http.ResponseWriter, r *http.Request, vars camunda.Variables)) func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		id := params["id"]
+		if !e.executionExists(id) {
+			notFound(w, "execution %s does not exist", id)
+			return
+		}
+
+		if e.localVariables[id] == nil {
+			e.localVariables[id] = camunda.Variables{}
+		}
+
+		h(w, r, e.localVariables[id])
+	}
+}
+
+// executionExists reports whether the execution is active, must be called with mu held
+func (e *Engine) executionExists(id string) bool {
+	if inst := e.instance(id); inst != nil {
+		return !inst.Ended
+	}
+
+	for _, t := range e.externalTasks {
+		if t.ExecutionID == id && t.State == TaskActive {
+			return true
+		}
+	}
+
+	for _, t := range e.userTasks {
+		if t.ExecutionID == id && t.State == TaskActive {
+			return true
+		}
+	}
+
+	return false
+}
+
+// modifyVariables applies the modifications and deletions of the request
+func modifyVariables(w http.ResponseWriter, r *http.Request, vars camunda.Variables) {
+	var req camunda.ReqModifyVariables
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	mergeVariables(vars, req.Modifications)
+	for _, name := range req.Deletions {
+		delete(vars, name)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) listInstances(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.ProcessInstance{}
+	for _, inst := range e.filterInstances(r.URL.Query()) {
+		res = append(res, instanceResponse(inst))
+	}
+
+	writeJSON(w, http.StatusOK, page(res, r.URL.Query()))
+}
+
+func (e *Engine) countInstances(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &camunda.ResponseCount{Count: len(e.filterInstances(r.URL.Query()))})
+}
+
+// filterInstances returns the running instances matching the query, must be called with mu held
+func (e *Engine) filterInstances(q url.Values) []*ProcessInstance {
+	var res []*ProcessInstance
+
+	for _, inst := range e.instances {
+		def := e.definition(inst.DefinitionID)
+
+		switch {
+		case inst.Ended,
+			!matchIn(q, "processInstanceIds", inst.ID),
+			q.Get("businessKey") != "" && q.Get("businessKey") != inst.BusinessKey,
+			q.Get("businessKeyLike") != "" && !like(inst.BusinessKey, q.Get("businessKeyLike")),
+			q.Get("processDefinitionId") != "" && q.Get("processDefinitionId") != inst.DefinitionID,
+			q.Get("processDefinitionKey") != "" && q.Get("processDefinitionKey") != inst.DefinitionKey,
+			!matchIn(q, "processDefinitionKeyIn", inst.DefinitionKey),
+			q.Get("deploymentId") != "" && (def == nil || q.Get("deploymentId") != def.DeploymentID),
+			q.Get("suspended") == "true" && !inst.Suspended,
+			q.Get("active") == "true" && inst.Suspended,
+			!matchTenant(q, inst.TenantID):
+			continue
+		}
+
+		res = append(res, inst)
+	}
+
+	return res
+}
+
+func instanceResponse(inst *ProcessInstance) *camunda.ProcessInstance {
+	return &camunda.ProcessInstance{
+		ID:           inst.ID,
+		DefinitionID: inst.DefinitionID,
+		BusinessKey:  inst.BusinessKey,
+		Suspended:    inst.Suspended,
+		TenantID:     inst.TenantID,
+	}
+}
+
+// matchIn checks a filter by a list of values. The list may be comma-separated or repeated
+func matchIn(q url.Values, name, value string) bool {
+	values := q[name]
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if containsCSV(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,516 @@
+package fakeengine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// TaskState a state of an external or user task
+type TaskState string
+
+const (
+	// TaskActive the task waits to be fetched or completed
+	TaskActive TaskState = "active"
+	// TaskCompleted the task was completed
+	TaskCompleted TaskState = "completed"
+	// TaskBPMNError a BPMN error was reported for the task
+	TaskBPMNError TaskState = "bpmnError"
+	// TaskCancelled the process instance of the task ended before the task
+	TaskCancelled TaskState = "cancelled"
+)
+
+// Deployment a deployment of the engine
+type Deployment struct {
+	ID        string
+	Name      string
+	Source    string
+	TenantID  string
+	Time      time.Time
+	Resources []Resource
+}
+
+// Resource a deployed resource
+type Resource struct {
+	ID   string
+	Name string
+	Data []byte
+}
+
+// ProcessDefinition a deployed process definition
+type ProcessDefinition struct {
+	ID           string
+	Key          string
+	Name         string
+	Version      int
+	DeploymentID string
+	// Resource the name of the resource containing the definition
+	Resource  string
+	TenantID  string
+	Suspended bool
+	// XML the BPMN 2.0 XML of the resource
+	XML []byte
+}
+
+// ProcessInstance a process instance, ended instances are kept for inspection
+type ProcessInstance struct {
+	ID            string
+	DefinitionID  string
+	DefinitionKey string
+	BusinessKey   string
+	TenantID      string
+	Suspended     bool
+	Ended         bool
+	Variables     camunda.Variables
+	StartTime     time.Time
+	EndTime       time.Time
+}
+
+// ExternalTask an external task, finished tasks are kept for inspection
+type ExternalTask struct {
+	ID                   string
+	TopicName            string
+	ProcessInstanceID    string
+	ProcessDefinitionID  string
+	ProcessDefinitionKey string
+	ExecutionID          string
+	ActivityID           string
+	ActivityInstanceID   string
+	BusinessKey          string
+	TenantID             string
+	Priority             int
+	// Retries nil until the first failure, an incident is created at 0 retries
+	Retries        *int
+	WorkerID       string
+	LockExpiration time.Time
+	ErrorMessage   string
+	ErrorDetails   string
+	// ErrorCode the code of the reported BPMN error
+	ErrorCode string
+	State     TaskState
+	// AvailableAt the task can not be fetched before, set by the retry timeout of a failure
+	AvailableAt time.Time
+}
+
+// Incident reports whether the task has no retries left
+func (t *ExternalTask) Incident() bool {
+	return t.Retries != nil && *t.Retries <= 0
+}
+
+// locked reports whether the task is locked at now
+func (t *ExternalTask) locked(now time.Time) bool {
+	return t.WorkerID != "" && now.Before(t.LockExpiration)
+}
+
+// fetchable reports whether the task can be fetched at now
+func (t *ExternalTask) fetchable(now time.Time) bool {
+	return t.State == TaskActive && !t.Incident() && !t.locked(now) && !now.Before(t.AvailableAt)
+}
+
+// UserTask a user task, finished tasks are kept for inspection
+type UserTask struct {
+	ID                   string
+	Name                 string
+	TaskDefinitionKey    string
+	Assignee             string
+	ProcessInstanceID    string
+	ProcessDefinitionID  string
+	ProcessDefinitionKey string
+	ExecutionID          string
+	BusinessKey          string
+	TenantID             string
+	Priority             int
+	Created              time.Time
+	State                TaskState
+	// Variables the variables passed on completion
+	Variables camunda.Variables
+}
+
+// ActivityInstance an activity run by the executor, like a historic activity instance of the engine
+type ActivityInstance struct {
+	ID                  string
+	ActivityID          string
+	ActivityName        string
+	ActivityType        string
+	ProcessInstanceID   string
+	ProcessDefinitionID string
+	ExecutionID         string
+	StartTime           time.Time
+	// EndTime zero while the activity is running
+	EndTime time.Time
+	// Canceled the activity was interrupted, e.g. by a boundary event or the end of the process instance
+	Canceled bool
+}
+
+// Deploy deploys the resources like the deployment create endpoint
+func (e *Engine) Deploy(name string, resources map[string][]byte) (Deployment, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(resources))
+	for n := range resources {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	d := &Deployment{Name: name}
+	for _, n := range names {
+		d.Resources = append(d.Resources, Resource{Name: n, Data: resources[n]})
+	}
+
+	if _, err := e.deploy(d); err != nil {
+		return Deployment{}, err
+	}
+
+	return *d, nil
+}
+
+// StartInstance starts an instance of the latest version of the process definition
+func (e *Engine) StartInstance(key, businessKey string, vars camunda.Variables) (ProcessInstance, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	def := e.latestDefinition(key, "")
+	if def == nil {
+		return ProcessInstance{}, fmt.Errorf("no process definition with key %s", key)
+	}
+
+	inst, err := e.startInstance(def, businessKey, vars)
+	if err != nil {
+		return ProcessInstance{}, err
+	}
+
+	return inst.snapshot(), nil
+}
+
+// EndInstance ends the process instance and cancels its open tasks
+func (e *Engine) EndInstance(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inst := e.instance(id)
+	if inst == nil || inst.Ended {
+		return fmt.Errorf("no running process instance %s", id)
+	}
+
+	e.endInstance(inst)
+
+	return nil
+}
+
+// AddExternalTask creates an external task. The missing IDs are generated and the process fields
+// are copied from the process instance if ProcessInstanceID is set
+func (e *Engine) AddExternalTask(t ExternalTask) ExternalTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.addExternalTask(&t).snapshot()
+}
+
+// AddUserTask creates a user task. The missing IDs are generated and the process fields
+// are copied from the process instance if ProcessInstanceID is set
+func (e *Engine) AddUserTask(t UserTask) UserTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.addUserTask(&t).snapshot()
+}
+
+// Deployments returns the deployments
+func (e *Engine) Deployments() []Deployment {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]Deployment, 0, len(e.deployments))
+	for _, d := range e.deployments {
+		res = append(res, *d)
+	}
+
+	return res
+}
+
+// ProcessDefinitions returns the deployed process definitions
+func (e *Engine) ProcessDefinitions() []ProcessDefinition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]ProcessDefinition, 0, len(e.definitions))
+	for _, d := range e.definitions {
+		res = append(res, *d)
+	}
+
+	return res
+}
+
+// Instances returns the running and ended process instances
+func (e *Engine) Instances() []ProcessInstance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]ProcessInstance, 0, len(e.instances))
+	for _, inst := range e.instances {
+		res = append(res, inst.snapshot())
+	}
+
+	return res
+}
+
+// Instance returns the process instance by id
+func (e *Engine) Instance(id string) (ProcessInstance, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inst := e.instance(id)
+	if inst == nil {
+		return ProcessInstance{}, false
+	}
+
+	return inst.snapshot(), true
+}
+
+// ExternalTasks returns the external tasks in creation order
+func (e *Engine) ExternalTasks() []ExternalTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]ExternalTask, 0, len(e.externalTasks))
+	for _, t := range e.externalTasks {
+		res = append(res, t.snapshot())
+	}
+
+	return res
+}
+
+// UserTasks returns the user tasks in creation order
+func (e *Engine) UserTasks() []UserTask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]UserTask, 0, len(e.userTasks))
+	for _, t := range e.userTasks {
+		res = append(res, t.snapshot())
+	}
+
+	return res
+}
+
+// Messages returns the messages received by the message endpoint
+func (e *Engine) Messages() []camunda.MessageRequest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]camunda.MessageRequest(nil), e.messages...)
+}
+
+// Activities returns the activity instances of the process instance in start order, of all instances if empty
+func (e *Engine) Activities(processInstanceID string) []ActivityInstance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []ActivityInstance{}
+	for _, a := range e.activities {
+		if processInstanceID == "" || a.ProcessInstanceID == processInstanceID {
+			res = append(res, *a)
+		}
+	}
+
+	return res
+}
+
+// LocalVariables returns the local variables of the execution
+func (e *Engine) LocalVariables(executionID string) camunda.Variables {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return copyVariables(e.localVariables[executionID])
+}
+
+func (inst *ProcessInstance) snapshot() ProcessInstance {
+	c := *inst
+	c.Variables = copyVariables(inst.Variables)
+
+	return c
+}
+
+func (t *ExternalTask) snapshot() ExternalTask {
+	c := *t
+	if t.Retries != nil {
+		r := *t.Retries
+		c.Retries = &r
+	}
+
+	return c
+}
+
+func (t *UserTask) snapshot() UserTask {
+	c := *t
+	c.Variables = copyVariables(t.Variables)
+
+	return c
+}
+
+// instance returns the process instance by id, must be called with mu held
+func (e *Engine) instance(id string) *ProcessInstance {
+	for _, inst := range e.instances {
+		if inst.ID == id {
+			return inst
+		}
+	}
+
+	return nil
+}
+
+// startInstance creates a process instance and runs it by the executor, must be called with mu held.
+// The instance is removed if the executor fails
+func (e *Engine) startInstance(def *ProcessDefinition, businessKey string, vars camunda.Variables) (*ProcessInstance, error) {
+	inst, err := e.createInstance(def, businessKey, vars)
+	if err != nil || e.executor == nil {
+		return inst, err
+	}
+
+	if err := e.executor.InstanceStarted(&Tx{e: e}, inst); err != nil {
+		e.removeInstance(inst)
+		return nil, err
+	}
+
+	return inst, nil
+}
+
+// createInstance creates a process instance, must be called with mu held
+func (e *Engine) createInstance(def *ProcessDefinition, businessKey string, vars camunda.Variables) (*ProcessInstance, error) {
+	if def.Suspended {
+		return nil, fmt.Errorf("process definition %s is suspended", def.ID)
+	}
+
+	inst := &ProcessInstance{
+		ID:            newID(),
+		DefinitionID:  def.ID,
+		DefinitionKey: def.Key,
+		BusinessKey:   businessKey,
+		TenantID:      def.TenantID,
+		Variables:     copyVariables(vars),
+		StartTime:     time.Now(),
+	}
+	e.instances = append(e.instances, inst)
+
+	return inst, nil
+}
+
+// endInstance ends the process instance and cancels its open tasks and activities, must be called with mu held
+func (e *Engine) endInstance(inst *ProcessInstance) {
+	inst.Ended = true
+	inst.EndTime = time.Now()
+
+	for _, a := range e.activities {
+		if a.ProcessInstanceID == inst.ID && a.EndTime.IsZero() {
+			a.Canceled = true
+			a.EndTime = inst.EndTime
+		}
+	}
+
+	for _, t := range e.externalTasks {
+		if t.ProcessInstanceID == inst.ID && t.State == TaskActive {
+			t.State = TaskCancelled
+		}
+	}
+
+	for _, t := range e.userTasks {
+		if t.ProcessInstanceID == inst.ID && t.State == TaskActive {
+			t.State = TaskCancelled
+		}
+	}
+
+	e.notifyChange()
+}
+
+// removeInstance removes the process instance with its tasks and activities, must be called with mu held
+func (e *Engine) removeInstance(inst *ProcessInstance) {
+	instances := e.instances[:0]
+	for _, i := range e.instances {
+		if i != inst {
+			instances = append(instances, i)
+		}
+	}
+	e.instances = instances
+
+	externalTasks := e.externalTasks[:0]
+	for _, t := range e.externalTasks {
+		if t.ProcessInstanceID != inst.ID {
+			externalTasks = append(externalTasks, t)
+		}
+	}
+	e.externalTasks = externalTasks
+
+	userTasks := e.userTasks[:0]
+	for _, t := range e.userTasks {
+		if t.ProcessInstanceID != inst.ID {
+			userTasks = append(userTasks, t)
+		}
+	}
+	e.userTasks = userTasks
+
+	activities := e.activities[:0]
+	for _, a := range e.activities {
+		if a.ProcessInstanceID != inst.ID {
+			activities = append(activities, a)
+		}
+	}
+	e.activities = activities
+}
+
+// addExternalTask creates the task, must be called with mu held
+func (e *Engine) addExternalTask(t *ExternalTask) *ExternalTask {
+	if t.ID == "" {
+		t.ID = newID()
+	}
+
+	if t.ExecutionID == "" {
+		t.ExecutionID = newID()
+	}
+
+	if t.ActivityInstanceID == "" {
+		t.ActivityInstanceID = t.ActivityID + ":" + newID()
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		t.ProcessDefinitionID = inst.DefinitionID
+		t.ProcessDefinitionKey = inst.DefinitionKey
+		t.BusinessKey = inst.BusinessKey
+		t.TenantID = inst.TenantID
+	}
+
+	t.State = TaskActive
+	e.externalTasks = append(e.externalTasks, t)
+	e.notifyChange()
+
+	return t
+}
+
+// addUserTask creates the task, must be called with mu held
+func (e *Engine) addUserTask(t *UserTask) *UserTask {
+	if t.ID == "" {
+		t.ID = newID()
+	}
+
+	if t.ExecutionID == "" {
+		t.ExecutionID = newID()
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		t.ProcessDefinitionID = inst.DefinitionID
+		t.ProcessDefinitionKey = inst.DefinitionKey
+		t.BusinessKey = inst.BusinessKey
+		t.TenantID = inst.TenantID
+	}
+
+	if t.Created.IsZero() {
+		t.Created = time.Now()
+	}
+
+	t.State = TaskActive
+	e.userTasks = append(e.userTasks, t)
+
+	return t
+}
@@ -0,0 +1,198 @@
+package fakeengine
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/interticketinc/camunda"
+)
+
+func (e *Engine) registerUserTaskRoutes() {
+	e.handle(http.MethodGet, "/task", e.listUserTasks)
+	e.handle(http.MethodPost, "/task", e.listUserTasks)
+	e.handle(http.MethodGet, "/task/count", e.countUserTasks)
+	e.handle(http.MethodPost, "/task/count", e.countUserTasks)
+	e.handle(http.MethodGet, "/task/{id}", e.userTaskRoute(func(w http.ResponseWriter, r *http.Request, t *UserTask) {
+		writeJSON(w, http.StatusOK, e.userTaskResponse(t))
+	}))
+	e.handle(http.MethodPost, "/task/{id}/complete", e.userTaskRoute(e.completeUserTask))
+}
+
+func (e *Engine) registerMessageRoutes() {
+	e.handle(http.MethodPost, "/message", e.correlateMessage)
+}
+
+// userTaskRoute resolves the active user task of the path, the handler runs with mu held
+func (e *Engine) userTaskRoute(h func(w http.ResponseWriter, r *http.Request, t *UserTask)) func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		t := e.userTask(params["id"])
+		if t == nil || t.State != TaskActive {
+			notFound(w, "no matching task with id %s", params["id"])
+			return
+		}
+
+		h(w, r, t)
+	}
+}
+
+func (e *Engine) completeUserTask(w http.ResponseWriter, r *http.Request, t *UserTask) {
+	var req camunda.QueryUserTaskComplete
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	vars := camunda.Variables{}
+	for k, v := range req.Variables {
+		v := v
+		vars[k] = &v
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		mergeVariables(inst.Variables, vars)
+	}
+
+	t.Variables = vars
+	t.State = TaskCompleted
+	e.notifyChange()
+
+	if !e.execute(w, func(x Executor, tx *Tx) error { return x.UserTaskCompleted(tx, t) }) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *Engine) listUserTasks(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q, ok := filterParams(w, r)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := []*camunda.UserTaskResponse{}
+	for _, t := range e.filterUserTasks(q) {
+		res = append(res, e.userTaskResponse(t))
+	}
+
+	writeJSON(w, http.StatusOK, page(res, r.URL.Query()))
+}
+
+func (e *Engine) countUserTasks(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q, ok := filterParams(w, r)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &camunda.ResponseCount{Count: len(e.filterUserTasks(q))})
+}
+
+// filterUserTasks returns the active tasks matching the query, must be called with mu held
+func (e *Engine) filterUserTasks(q url.Values) []*UserTask {
+	var res []*UserTask
+
+	for _, t := range e.userTasks {
+		inst := e.instance(t.ProcessInstanceID)
+		suspended := inst != nil && inst.Suspended
+
+		switch {
+		case t.State != TaskActive,
+			q.Get("processInstanceId") != "" && q.Get("processInstanceId") != t.ProcessInstanceID,
+			q.Get("processInstanceBusinessKey") != "" && q.Get("processInstanceBusinessKey") != t.BusinessKey,
+			!matchIn(q, "processInstanceBusinessKeyIn", t.BusinessKey),
+			q.Get("processInstanceBusinessKeyLike") != "" && !like(t.BusinessKey, q.Get("processInstanceBusinessKeyLike")),
+			q.Get("processDefinitionId") != "" && q.Get("processDefinitionId") != t.ProcessDefinitionID,
+			q.Get("processDefinitionKey") != "" && q.Get("processDefinitionKey") != t.ProcessDefinitionKey,
+			!matchIn(q, "processDefinitionKeyIn", t.ProcessDefinitionKey),
+			q.Get("executionId") != "" && q.Get("executionId") != t.ExecutionID,
+			q.Get("assignee") != "" && q.Get("assignee") != t.Assignee,
+			q.Get("assigneeLike") != "" && !like(t.Assignee, q.Get("assigneeLike")),
+			q.Get("assigned") == "true" && t.Assignee == "",
+			q.Get("unassigned") == "true" && t.Assignee != "",
+			q.Get("taskDefinitionKey") != "" && q.Get("taskDefinitionKey") != t.TaskDefinitionKey,
+			!matchIn(q, "taskDefinitionKeyIn", t.TaskDefinitionKey),
+			q.Get("taskDefinitionKeyLike") != "" && !like(t.TaskDefinitionKey, q.Get("taskDefinitionKeyLike")),
+			q.Get("name") != "" && q.Get("name") != t.Name,
+			q.Get("nameLike") != "" && !like(t.Name, q.Get("nameLike")),
+			q.Get("active") == "true" && suspended,
+			q.Get("suspended") == "true" && !suspended,
+			!matchTenant(q, t.TenantID):
+			continue
+		}
+
+		res = append(res, t)
+	}
+
+	return res
+}
+
+// userTask returns the task by id, must be called with mu held
+func (e *Engine) userTask(id string) *UserTask {
+	for _, t := range e.userTasks {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// userTaskResponse must be called with mu held
+func (e *Engine) userTaskResponse(t *UserTask) *camunda.UserTaskResponse {
+	res := &camunda.UserTaskResponse{
+		ID:                  t.ID,
+		Name:                t.Name,
+		Assignee:            t.Assignee,
+		Created:             formatTime(t.Created),
+		ExecutionID:         t.ExecutionID,
+		Priority:            int64(t.Priority),
+		ProcessDefinitionID: t.ProcessDefinitionID,
+		ProcessInstanceID:   t.ProcessInstanceID,
+		TaskDefinitionKey:   t.TaskDefinitionKey,
+	}
+
+	if t.TenantID != "" {
+		tenantID := t.TenantID
+		res.TenantID = &tenantID
+	}
+
+	if inst := e.instance(t.ProcessInstanceID); inst != nil {
+		res.Suspended = inst.Suspended
+	}
+
+	return res
+}
+
+// correlateMessage records the message, see Messages, and correlates it by the executor
+func (e *Engine) correlateMessage(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var req camunda.MessageRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.MessageName == "" {
+		badRequest(w, "messageName is required")
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.messages = append(e.messages, req)
+
+	if e.executor != nil {
+		if err := e.executor.Correlate(&Tx{e: e}, &req); err != nil {
+			badRequest(w, "%s", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
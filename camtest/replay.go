@@ -0,0 +1,91 @@
+package camtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/interticketinc/camunda/worker"
+)
+
+// Replay the result of a task dump replayed with a handler
+type Replay struct {
+	*ContextStub
+	// Dump the replayed dump
+	Dump *worker.TaskDump
+	// HandlerErr the error returned by the handler, a panic of the handler as error
+	HandlerErr error
+	// Outcome the result the worker would report: a returned *worker.BPMNError or an error mapped to one
+	// is reported as BPMN error, any other error or a panic as failure
+	Outcome worker.Outcome
+}
+
+// ReplayTask runs the handler with a test context of the task dumped by the worker (see worker.FailureDump).
+// The options are applied after the dumped task, e.g. to set the values of redacted variables
+func ReplayTask(t testing.TB, path string, handler worker.Handler, opts ...ContextOption) *Replay {
+	t.Helper()
+
+	return ReplayTaskWithErrors(t, path, handler, &worker.ErrorRegistry{}, opts...)
+}
+
+// ReplayTaskWithErrors is ReplayTask resolving the handler error with the error mappings of the registry,
+// e.g. the registry of the worker which dumped the task (see worker.Worker.BPMNErrors)
+func ReplayTaskWithErrors(t testing.TB, path string, handler worker.Handler, errs *worker.ErrorRegistry,
+	opts ...ContextOption) *Replay {
+	t.Helper()
+
+	dump, err := worker.LoadTaskDump(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Replay{
+		ContextStub: CreateTestContext(append([]ContextOption{WithTask(dump.Task)}, opts...)...),
+		Dump:        dump,
+	}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.HandlerErr = fmt.Errorf("fatal error in task: %s", rec)
+			}
+		}()
+
+		r.HandlerErr = handler(r.ContextStub)
+	}()
+
+	switch {
+	case r.HandlerErr != nil && resolves(errs, r.HandlerErr):
+		r.Outcome = worker.OutcomeBPMNError
+	case r.HandlerErr != nil, r.Failure != nil:
+		r.Outcome = worker.OutcomeFailed
+	case r.BPMNError != nil:
+		r.Outcome = worker.OutcomeBPMNError
+	case r.Completed != nil:
+		r.Outcome = worker.OutcomeCompleted
+	default:
+		r.Outcome = worker.OutcomeNone
+	}
+
+	return r
+}
+
+// resolves reports whether the error is reported as BPMN error
+func resolves(errs *worker.ErrorRegistry, err error) bool {
+	_, ok := errs.Resolve(err)
+	return ok
+}
+
+// Reproduced reports whether the replay had the dumped outcome
+func (r *Replay) Reproduced() bool {
+	return r.Outcome == r.Dump.Outcome
+}
+
+// AssertReproduced checks that the replay had the dumped outcome, e.g. when debugging a failure
+func (r *Replay) AssertReproduced(t testing.TB) {
+	t.Helper()
+
+	if !r.Reproduced() {
+		t.Errorf("replay of task %s: outcome %s, dumped %s (%s), handler error: %v",
+			r.Dump.Task.ID, r.Outcome, r.Dump.Outcome, r.Dump.Failure, r.HandlerErr)
+	}
+}
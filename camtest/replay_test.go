@@ -0,0 +1,155 @@
+package camtest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+	"github.com/interticketinc/camunda/worker"
+)
+
+func TestReplayTask(t *testing.T) {
+	engine := camtest.NewEngine()
+	defer engine.Close()
+
+	model, err := ioutil.ReadFile("testdata/order.bpmn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Deploy("order", map[string][]byte{"order.bpmn": model}); err != nil {
+		t.Fatalf("cannot deploy: %s", err)
+	}
+
+	checkStock := func(ctx worker.Context) error {
+		if v := ctx.Variables()["amount"]; v != nil && v.Value != float64(500) {
+			return errors.New("unexpected amount")
+		}
+
+		return ctx.Complete(&worker.TaskComplete{})
+	}
+
+	dir := t.TempDir()
+	client := engine.Client()
+	w := worker.New(client, &worker.Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: time.Second,
+		FailureDump:        &worker.FailureDump{Dir: dir, RedactVariables: []string{"customer"}},
+	})
+	defer w.Stop()
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "check-stock"}}, checkStock)
+
+	if _, err := client.ProcessManager().StartInstance(camunda.ProcessConfig{Key: "order"}, camunda.InstanceParams{
+		BusinessKey: "broken",
+		Variables: camunda.Variables{
+			"amount":   {Value: 50, Type: "Integer"},
+			"customer": {Value: "jane@example.com", Type: "String"},
+		},
+	}); err != nil {
+		t.Fatalf("cannot start: %s", err)
+	}
+
+	var dumps []string
+	waitFor(t, "the failed task to be dumped", func() bool {
+		dumps, _ = filepath.Glob(filepath.Join(dir, "check-stock-*.json"))
+		return len(dumps) == 1
+	})
+
+	r := camtest.ReplayTask(t, dumps[0], checkStock)
+	r.AssertReproduced(t)
+
+	if r.Dump.Outcome != worker.OutcomeFailed || r.Dump.Failure != "task error: unexpected amount" {
+		t.Errorf("unexpected dump %+v", r.Dump)
+	}
+
+	if v := r.Variables()["customer"]; v == nil || v.Value != "REDACTED" || v.Type != "String" {
+		t.Errorf("customer not redacted: %+v", v)
+	}
+
+	fixed := camtest.ReplayTask(t, dumps[0], checkStock, camtest.WithVariables(camunda.Variables{
+		"amount": {Value: float64(500), Type: "Integer"},
+	}))
+	if fixed.Reproduced() || fixed.Outcome != worker.OutcomeCompleted {
+		t.Errorf("replay with the fixed amount: outcome %s", fixed.Outcome)
+	}
+
+	panicked := camtest.ReplayTask(t, dumps[0], func(ctx worker.Context) error {
+		panic("boom")
+	})
+	if panicked.Outcome != worker.OutcomeFailed || panicked.HandlerErr == nil {
+		t.Errorf("panic not reported as failure: %s, %v", panicked.Outcome, panicked.HandlerErr)
+	}
+
+	bpmn := camtest.ReplayTask(t, dumps[0], func(ctx worker.Context) error {
+		return fmt.Errorf("check: %w", worker.NewBPMNError("out-of-stock", "no stock", nil))
+	})
+	if bpmn.Outcome != worker.OutcomeBPMNError {
+		t.Errorf("returned BPMN error not reported as BPMN error: %s", bpmn.Outcome)
+	}
+
+	errOutOfStock := errors.New("out of stock")
+	w.MapBPMNError(errOutOfStock, "out-of-stock")
+	mapped := camtest.ReplayTaskWithErrors(t, dumps[0], func(ctx worker.Context) error {
+		return errOutOfStock
+	}, w.BPMNErrors())
+	if mapped.Outcome != worker.OutcomeBPMNError {
+		t.Errorf("mapped error not reported as BPMN error: %s", mapped.Outcome)
+	}
+}
+
+// failureLost a transport losing the failures sent to the engine
+type failureLost struct{}
+
+func (failureLost) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(r.URL.Path, "/failure") {
+		return nil, errors.New("connection reset")
+	}
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestReplayTask_failureReportedByHandler(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	client := engine.Client()
+	client.SetCustomTransport(failureLost{})
+
+	// the handler reports the failure itself and the engine never receives it
+	checkStock := func(ctx worker.Context) error {
+		_ = ctx.HandleFailure(worker.TaskFailureRequest{ErrorMessage: "out of stock"})
+		return nil
+	}
+
+	dir := t.TempDir()
+	w := worker.New(client, &worker.Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: 200 * time.Millisecond,
+		FailureDump:        &worker.FailureDump{Dir: dir},
+	})
+	defer w.Stop()
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "check-stock"}}, checkStock)
+
+	engine.AddExternalTask(fakeengine.ExternalTask{TopicName: "check-stock"})
+
+	var dumps []string
+	waitFor(t, "the failed task to be dumped", func() bool {
+		dumps, _ = filepath.Glob(filepath.Join(dir, "check-stock-*.json"))
+		return len(dumps) == 1
+	})
+
+	r := camtest.ReplayTask(t, dumps[0], checkStock)
+	r.AssertReproduced(t)
+
+	if r.Dump.Outcome != worker.OutcomeFailed || r.Dump.Delivered || r.Dump.DeliveryError == "" {
+		t.Errorf("unexpected dump %+v", r.Dump)
+	}
+}
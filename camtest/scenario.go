@@ -0,0 +1,356 @@
+package camtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/worker"
+)
+
+// scenarioPollInterval the interval of polling the engine while a step waits
+const scenarioPollInterval = 50 * time.Millisecond
+
+// scenarioWorkerID the worker id locking the external tasks of a scenario
+const scenarioWorkerID = "camtest-scenario"
+
+// errNotReady the engine has not reached the step yet
+var errNotReady = errors.New("not ready")
+
+// Scenario an end-to-end test of a process: it starts an instance of the process and runs the steps in order,
+// each step waits up to the timeout for the engine. It runs against a real engine or a fake engine
+type Scenario struct {
+	client      *camunda.Client
+	key         string
+	businessKey string
+	variables   camunda.Variables
+	timeout     time.Duration
+	errors      *worker.ErrorRegistry
+	steps       []scenarioStep
+}
+
+// scenarioStep a step of a scenario, run returns errNotReady until the engine reached the step
+type scenarioStep struct {
+	name string
+	run  func(r *scenarioRun) error
+	// retry retries the step on errors until the timeout
+	retry bool
+}
+
+// scenarioRun the state of a running scenario
+type scenarioRun struct {
+	client      *camunda.Client
+	instanceID  string
+	businessKey string
+	lock        time.Duration
+}
+
+// NewScenario creates a scenario of the process definition key, the steps wait 10 seconds by default
+func NewScenario(client *camunda.Client, key string) *Scenario {
+	return &Scenario{client: client, key: key, timeout: 10 * time.Second}
+}
+
+// WithBusinessKey sets the business key of the instance, a unique key is generated by default.
+// The external tasks are fetched by the business key
+func (s *Scenario) WithBusinessKey(businessKey string) *Scenario {
+	s.businessKey = businessKey
+	return s
+}
+
+// WithVariables sets the variables the instance is started with
+func (s *Scenario) WithVariables(vars camunda.Variables) *Scenario {
+	s.variables = vars
+	return s
+}
+
+// WithErrors sets the registry mapping the errors of the handlers to BPMN errors,
+// e.g. the registry of the worker under test (see worker.Worker.BPMNErrors)
+func (s *Scenario) WithErrors(registry *worker.ErrorRegistry) *Scenario {
+	s.errors = registry
+	return s
+}
+
+// WithTimeout sets the time each step waits for the engine
+func (s *Scenario) WithTimeout(timeout time.Duration) *Scenario {
+	s.timeout = timeout
+	return s
+}
+
+// ExpectExternalTask waits for an external task of the topic in the instance, locks it and runs the handler
+// with a worker context reporting to the engine. An error of the handler is reported like the worker does:
+// a *worker.BPMNError or an error mapped to one (see WithErrors) as BPMN error, e.g. to reach an error
+// boundary event, any other error as failure creating an incident
+func (s *Scenario) ExpectExternalTask(topic string, handler worker.Handler) *Scenario {
+	return s.step(fmt.Sprintf("expect external task %q", topic), false, func(r *scenarioRun) error {
+		tasks, err := r.client.TaskManager().FetchAndLock(camunda.FetchAndLockRequest{
+			WorkerID: scenarioWorkerID,
+			MaxTasks: 1,
+			Topics: []*camunda.TopicLockConfig{{
+				TopicName:            topic,
+				LockDuration:         int(r.lock / time.Millisecond),
+				BusinessKey:          r.businessKey,
+				ProcessDefinitionKey: s.key,
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot fetch: %w", err)
+		}
+
+		if len(tasks) == 0 {
+			return errNotReady
+		}
+
+		ctx := worker.NewContext(r.client, tasks[0], scenarioWorkerID)
+		if err := s.reportError(ctx, handler(ctx)); err != nil {
+			return fmt.Errorf("cannot report the error of the handler of task %s: %w", tasks[0].ID, err)
+		}
+
+		return nil
+	})
+}
+
+// ExpectUserTask waits for the user task of the task definition key in the instance and completes it
+// with the variables
+func (s *Scenario) ExpectUserTask(taskDefinitionKey string, vars camunda.Variables) *Scenario {
+	return s.step(fmt.Sprintf("expect user task %q", taskDefinitionKey), false, func(r *scenarioRun) error {
+		res, err := r.client.Post("/task", map[string]string{}, &camunda.UserTaskGetListQuery{
+			ProcessInstanceID: r.instanceID,
+			TaskDefinitionKey: taskDefinitionKey,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot list user tasks: %w", err)
+		}
+
+		var tasks []camunda.UserTaskResponse
+		if err := r.client.Marshal(res, &tasks); err != nil {
+			return fmt.Errorf("cannot read user tasks: %w", err)
+		}
+
+		if len(tasks) == 0 {
+			return errNotReady
+		}
+
+		complete := camunda.QueryUserTaskComplete{Variables: map[string]camunda.Variable{}}
+		for name, v := range vars {
+			if v != nil {
+				complete.Variables[name] = *v
+			}
+		}
+
+		if _, err := r.client.Post("/task/"+tasks[0].ID+"/complete", map[string]string{}, complete); err != nil {
+			return fmt.Errorf("cannot complete user task %s: %w", tasks[0].ID, err)
+		}
+
+		return nil
+	})
+}
+
+// CorrelateMessage correlates the message with the variables to the instance.
+// The correlation is retried until the instance waits for the message
+func (s *Scenario) CorrelateMessage(name string, vars camunda.Variables) *Scenario {
+	return s.step(fmt.Sprintf("correlate message %q", name), true, func(r *scenarioRun) error {
+		_, err := camunda.NewMessageManager(r.client).SendMessage(&camunda.MessageRequest{
+			MessageName:       name,
+			ProcessInstanceID: r.instanceID,
+			ProcessVariables:  vars,
+		})
+
+		return err
+	})
+}
+
+// ExpectEnded waits for the end of the instance and checks that it ended at the end event with the variables.
+// Other variables of the instance are allowed
+func (s *Scenario) ExpectEnded(endEventID string, vars camunda.Variables) *Scenario {
+	return s.step(fmt.Sprintf("expect end at %q", endEventID), false, func(r *scenarioRun) error {
+		history := camunda.NewHistoryManager(r.client)
+
+		inst, err := history.GetProcessInstance(r.instanceID)
+		if err != nil {
+			return fmt.Errorf("cannot get the instance: %w", err)
+		}
+
+		if inst.State == "ACTIVE" || inst.State == "SUSPENDED" {
+			return errNotReady
+		}
+
+		activities, err := history.GetActivityInstances(camunda.HistoricActivityInstanceQuery{
+			ProcessInstanceID: r.instanceID,
+			Finished:          true,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot get the activities: %w", err)
+		}
+
+		var ends []string
+		for _, a := range activities {
+			if strings.HasSuffix(a.ActivityType, "EndEvent") {
+				ends = append(ends, a.ActivityID)
+			}
+		}
+
+		if !contains(ends, endEventID) {
+			return fmt.Errorf("instance %s at %v, want %s", strings.ToLower(inst.State), ends, endEventID)
+		}
+
+		variables, err := history.GetVariableInstances(camunda.HistoricVariableInstanceQuery{ProcessInstanceID: r.instanceID})
+		if err != nil {
+			return fmt.Errorf("cannot get the variables: %w", err)
+		}
+
+		actual := camunda.Variables{}
+		for _, v := range variables {
+			actual[v.Name] = &camunda.Variable{Value: v.Value, Type: v.Type}
+		}
+
+		if diff := diffVariables(vars, actual); diff != "" {
+			return fmt.Errorf("unexpected variables:\n%s", diff)
+		}
+
+		return nil
+	})
+}
+
+// reportError reports the error of a handler like the worker does: as BPMN error if it is a *worker.BPMNError
+// or it is mapped to one (see WithErrors), otherwise as failure without retries. Returns the error of sending it
+func (s *Scenario) reportError(ctx worker.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	registry := s.errors
+	if registry == nil {
+		registry = &worker.ErrorRegistry{}
+	}
+
+	if bpmnErr, ok := registry.Resolve(err); ok {
+		return ctx.ReportBPMNError(bpmnErr)
+	}
+
+	var details string
+
+	var detailed interface{ ErrorDetails() string }
+	if errors.As(err, &detailed) {
+		details = detailed.ErrorDetails()
+	}
+
+	return ctx.HandleFailure(worker.TaskFailureRequest{
+		ErrorMessage: fmt.Sprintf("task error: %s", err),
+		ErrorDetails: details,
+	})
+}
+
+func (s *Scenario) step(name string, retry bool, run func(r *scenarioRun) error) *Scenario {
+	s.steps = append(s.steps, scenarioStep{name: name, run: run, retry: retry})
+	return s
+}
+
+// Run runs the scenario and fails the test with a report of the steps if a step fails.
+// It returns the id of the process instance
+func (s *Scenario) Run(t testing.TB) string {
+	t.Helper()
+
+	id, err := s.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// Execute runs the scenario, the error reports the steps and the activities the instance waits in.
+// It returns the id of the process instance
+func (s *Scenario) Execute() (string, error) {
+	r := &scenarioRun{client: s.client, businessKey: s.businessKey, lock: s.timeout}
+	if r.businessKey == "" {
+		r.businessKey = fmt.Sprintf("scenario-%s-%d", s.key, time.Now().UnixNano())
+	}
+
+	inst, err := s.client.ProcessManager().StartInstance(camunda.ProcessConfig{Key: s.key}, camunda.InstanceParams{
+		BusinessKey: r.businessKey,
+		Variables:   s.variables,
+	})
+	if err != nil {
+		return "", fmt.Errorf("scenario %s: cannot start the instance: %w", s.key, err)
+	}
+	r.instanceID = inst.Id
+
+	for i, step := range s.steps {
+		if err := s.await(r, step); err != nil {
+			return r.instanceID, s.report(r, i, err)
+		}
+	}
+
+	return r.instanceID, nil
+}
+
+// await runs the step until it is done, fails or times out
+func (s *Scenario) await(r *scenarioRun, step scenarioStep) error {
+	deadline := time.Now().Add(s.timeout)
+
+	for {
+		err := step.run(r)
+		if err == nil || err != errNotReady && !step.retry {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			if err == errNotReady {
+				return fmt.Errorf("timeout after %s", s.timeout)
+			}
+
+			return fmt.Errorf("timeout after %s: %w", s.timeout, err)
+		}
+
+		time.Sleep(scenarioPollInterval)
+	}
+}
+
+// report describes the steps run until the failed step and the activities the instance waits in
+func (s *Scenario) report(r *scenarioRun, failed int, err error) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "scenario %s (instance %s, business key %s) failed:\n", s.key, r.instanceID, r.businessKey)
+	for i, step := range s.steps {
+		switch {
+		case i < failed:
+			fmt.Fprintf(&b, "  ok    %d. %s\n", i+1, step.name)
+		case i == failed:
+			fmt.Fprintf(&b, "  FAIL  %d. %s: %s\n", i+1, step.name, strings.ReplaceAll(err.Error(), "\n", "\n        "))
+		default:
+			fmt.Fprintf(&b, "  -     %d. %s\n", i+1, step.name)
+		}
+	}
+
+	activities, herr := camunda.NewHistoryManager(r.client).GetActivityInstances(camunda.HistoricActivityInstanceQuery{
+		ProcessInstanceID: r.instanceID,
+		Unfinished:        true,
+	})
+	if herr == nil {
+		var waiting []string
+		for _, a := range activities {
+			waiting = append(waiting, fmt.Sprintf("%s (%s)", a.ActivityID, a.ActivityType))
+		}
+
+		if len(waiting) > 0 {
+			fmt.Fprintf(&b, "  the instance waits in %s\n", strings.Join(waiting, ", "))
+		} else {
+			fmt.Fprintf(&b, "  the instance waits in no activity\n")
+		}
+	}
+
+	return errors.New(strings.TrimSuffix(b.String(), "\n"))
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
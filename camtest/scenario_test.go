@@ -0,0 +1,81 @@
+package camtest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/worker"
+)
+
+func TestScenario(t *testing.T) {
+	engine := camtest.NewEngine()
+	defer engine.Close()
+
+	model, err := ioutil.ReadFile("testdata/order.bpmn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := engine.Deploy("order", map[string][]byte{"order.bpmn": model}); err != nil {
+		t.Fatalf("cannot deploy: %s", err)
+	}
+
+	complete := func(ctx worker.Context) error {
+		return ctx.Complete(&worker.TaskComplete{})
+	}
+
+	camtest.NewScenario(engine.Client(), "order").
+		WithVariables(camunda.Variables{
+			"amount":  {Value: 500, Type: "Integer"},
+			"inStock": {Value: true, Type: "Boolean"},
+		}).
+		ExpectExternalTask("check-stock", complete).
+		ExpectUserTask("approve", camunda.Variables{"approved": {Value: true, Type: "Boolean"}}).
+		ExpectExternalTask("invoice", complete).
+		ExpectExternalTask("ship", complete).
+		CorrelateMessage("paid", nil).
+		ExpectEnded("done", camunda.Variables{
+			"amount":   {Value: 500, Type: "Integer"},
+			"approved": {Value: true, Type: "Boolean"},
+		}).
+		Run(t)
+
+	_, err = camtest.NewScenario(engine.Client(), "order").
+		WithTimeout(200*time.Millisecond).
+		WithVariables(camunda.Variables{
+			"amount":  {Value: 50, Type: "Integer"},
+			"inStock": {Value: true, Type: "Boolean"},
+		}).
+		ExpectExternalTask("check-stock", complete).
+		ExpectUserTask("approve", nil).
+		ExpectEnded("done", nil).
+		Execute()
+
+	errOutOfStock := errors.New("out of stock")
+	registry := &worker.ErrorRegistry{}
+	registry.Register(errOutOfStock, "out-of-stock")
+
+	camtest.NewScenario(engine.Client(), "order").
+		WithErrors(registry).
+		WithVariables(camunda.Variables{
+			"amount":  {Value: 500, Type: "Integer"},
+			"inStock": {Value: false, Type: "Boolean"},
+		}).
+		ExpectExternalTask("check-stock", func(ctx worker.Context) error {
+			return fmt.Errorf("check: %w", errOutOfStock)
+		}).
+		ExpectEnded("rejected", nil).
+		Run(t)
+
+	for _, want := range []string{"ok    1. expect external task", "FAIL  2. expect user task \"approve\": timeout", "-     3.", "waits in invoice (serviceTask)"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("report does not contain %q:\n%v", want, err)
+		}
+	}
+}
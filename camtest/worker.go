@@ -1,47 +1,343 @@
 package camtest
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
 	"github.com/interticketinc/camunda"
 	"github.com/interticketinc/camunda/worker"
 )
 
+// ContextStub a worker.Context for handler tests. It records the outcomes reported by the handler
+// instead of sending them to the engine
 type ContextStub struct {
 	*worker.ContextImpl
+
+	mu sync.Mutex
+	// Err returned by the reporting methods to simulate a failing engine
+	Err error
+
+	// Completed the completion reported by the handler
+	Completed *worker.TaskComplete
+	// Failure the failure reported by the handler
+	Failure *worker.TaskFailureRequest
+	// BPMNError the BPMN error reported by the handler
+	BPMNError *worker.BPMNError
+	// ProcessVariables the variables set in the process instance while running
+	ProcessVariables camunda.Variables
+	// LocalVariables the variables set in the execution of the task while running
+	LocalVariables camunda.Variables
+	// LockExtensions the durations of the lock extensions
+	LockExtensions []int
+	// ExtenderStarted the lock extender was started
+	ExtenderStarted bool
+	// ExtenderStopped the lock extender was stopped
+	ExtenderStopped bool
+	// Calls the names of the called methods reporting to the engine, in order
+	Calls []string
+}
+
+// ContextOption presets the task of a test context
+type ContextOption func(task *camunda.ResLockedExternalTask)
+
+// WithVariables presets the variables of the task
+func WithVariables(vars camunda.Variables) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.Variables = vars
+	}
+}
+
+// WithTopic presets the topic of the task
+func WithTopic(name string) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.TopicName = name
+	}
+}
+
+// WithRetries presets the retries left of the task
+func WithRetries(n int) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.Retries = n
+	}
+}
+
+// WithBusinessKey presets the business key of the task
+func WithBusinessKey(key string) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.BusinessKey = key
+	}
+}
+
+// WithTaskID presets the ID of the task
+func WithTaskID(id string) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.ID = id
+	}
+}
+
+// WithProcessInstanceID presets the process instance ID of the task
+func WithProcessInstanceID(id string) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.ProcessInstanceID = id
+	}
+}
+
+// WithExecutionID presets the execution ID of the task
+func WithExecutionID(id string) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		task.ExecutionID = id
+	}
 }
 
-func CreateTestContext() *ContextStub {
-	vars := camunda.Variables{}
+// WithTask presets the whole task, e.g. a payload captured from the engine.
+// The task is copied, the handler does not change the task of the caller
+func WithTask(t *camunda.ResLockedExternalTask) ContextOption {
+	return func(task *camunda.ResLockedExternalTask) {
+		*task = *t
 
+		task.TaskBase = &camunda.TaskBase{}
+		if t.TaskBase != nil {
+			*task.TaskBase = *t.TaskBase
+		}
+
+		task.Variables = make(camunda.Variables, len(t.Variables))
+		for name, v := range t.Variables {
+			if v != nil {
+				c := *v
+				task.Variables[name] = &c
+			}
+		}
+	}
+}
+
+// CreateTestContext creates a recording test context
+func CreateTestContext(opts ...ContextOption) *ContextStub {
 	task := &camunda.ResLockedExternalTask{
-		Variables:   vars,
+		TaskBase: &camunda.TaskBase{
+			ID:                "test-task-id",
+			TopicName:         "test-topic",
+			ProcessInstanceID: "test-process-instance-id",
+			ExecutionID:       "test-execution-id",
+			WorkerID:          "test-context-worker",
+		},
+		Variables:   camunda.Variables{},
 		BusinessKey: "test-business-key",
 	}
 
+	for _, opt := range opts {
+		opt(task)
+	}
+
 	return &ContextStub{
 		ContextImpl: worker.NewContext(nil, task, "test-context-worker"),
 	}
 }
 
-func (w ContextStub) Complete(tc *worker.TaskComplete) error {
-	panic("implement me")
+// record records a call
+func (w *ContextStub) record(name string) {
+	w.Calls = append(w.Calls, name)
+}
+
+func (w *ContextStub) Complete(tc *worker.TaskComplete) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("Complete")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	if tc == nil {
+		tc = &worker.TaskComplete{}
+	}
+	w.Completed = tc
+
+	return nil
+}
+
+func (w *ContextStub) HandleFailure(query worker.TaskFailureRequest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("HandleFailure")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	w.Failure = &query
+
+	return nil
+}
+
+func (w *ContextStub) HandleBPMNError(code int, message string) error {
+	return w.ReportBPMNError(&worker.BPMNError{
+		Code:    strconv.Itoa(code),
+		Message: message,
+	})
+}
+
+func (w *ContextStub) ReportBPMNError(e *worker.BPMNError) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("ReportBPMNError")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	w.BPMNError = e
+
+	return nil
+}
+
+func (w *ContextStub) SetVariables(vars camunda.Variables) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("SetVariables")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	w.ProcessVariables = merge(w.ProcessVariables, vars)
+
+	return nil
+}
+
+func (w *ContextStub) SetLocalVariables(vars camunda.Variables) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("SetLocalVariables")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	w.LocalVariables = merge(w.LocalVariables, vars)
+
+	return nil
+}
+
+func (w *ContextStub) ExtendLock(id string, duration int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("ExtendLock")
+	if w.Err != nil {
+		return w.Err
+	}
+
+	w.LockExtensions = append(w.LockExtensions, duration)
+
+	return nil
+}
+
+func (w *ContextStub) StartLockExtender() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("StartLockExtender")
+	w.ExtenderStarted = true
+}
+
+func (w *ContextStub) StopExtender() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.record("StopExtender")
+	w.ExtenderStopped = true
 }
 
-func (w ContextStub) HandleFailure(query worker.TaskFailureRequest) error {
-	panic("implement me")
+// AssertCompletedWith checks that the task was completed with the variables.
+// Other variables of the completion are allowed
+func (w *ContextStub) AssertCompletedWith(t testing.TB, vars camunda.Variables) {
+	t.Helper()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.Completed == nil {
+		t.Fatalf("task not completed, calls: %v", w.Calls)
+	}
+
+	if diff := diffVariables(vars, w.Completed.Variables); diff != "" {
+		t.Errorf("task completed with unexpected variables:\n%s", diff)
+	}
 }
 
-func (w ContextStub) HandleBPMNError(code int, message string) error {
-	panic("implement me")
+// AssertBPMNError checks that a BPMN error with the code was reported
+func (w *ContextStub) AssertBPMNError(t testing.TB, code string) {
+	t.Helper()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.BPMNError == nil {
+		t.Fatalf("no BPMN error reported, calls: %v", w.Calls)
+	}
+
+	if w.BPMNError.Code != code {
+		t.Errorf("BPMN error code: got %q, want %q", w.BPMNError.Code, code)
+	}
 }
 
-func (w ContextStub) ExtendLock(id string, duration int) error {
-	panic("implement me")
+// AssertFailedWithRetries checks that a failure with the retries was reported
+func (w *ContextStub) AssertFailedWithRetries(t testing.TB, retries int) {
+	t.Helper()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.Failure == nil {
+		t.Fatalf("no failure reported, calls: %v", w.Calls)
+	}
+
+	if w.Failure.Retries != retries {
+		t.Errorf("failure retries: got %d, want %d (message: %s)", w.Failure.Retries, retries, w.Failure.ErrorMessage)
+	}
 }
 
-func (w ContextStub) StartLockExtender() {
-	panic("implement me")
+// merge sets the variables of src in dst
+func merge(dst, src camunda.Variables) camunda.Variables {
+	if dst == nil {
+		dst = camunda.Variables{}
+	}
+
+	for k, v := range src {
+		dst[k] = v
+	}
+
+	return dst
 }
 
-func (w ContextStub) StopExtender() {
-	panic("implement me")
+// diffVariables describes the expected variables missing or different in actual, empty if none.
+// Values are compared by their printed form, so an int matches an int64 of the same value
+func diffVariables(expected, actual camunda.Variables) string {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var diff string
+
+	for _, name := range names {
+		want, got := expected[name], actual[name]
+		switch {
+		case want == nil:
+			continue
+		case got == nil:
+			diff += fmt.Sprintf("  %s: missing, want %v\n", name, want.Value)
+		case want.Type != "" && want.Type != got.Type:
+			diff += fmt.Sprintf("  %s: type %s, want %s\n", name, got.Type, want.Type)
+		case !reflect.DeepEqual(want.Value, got.Value) && fmt.Sprint(want.Value) != fmt.Sprint(got.Value):
+			diff += fmt.Sprintf("  %s: %v, want %v\n", name, got.Value, want.Value)
+		}
+	}
+
+	return diff
 }
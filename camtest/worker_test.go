@@ -0,0 +1,200 @@
+package camtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/worker"
+)
+
+// fakeTB records the failures of an assertion instead of failing the test
+type fakeTB struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Fatalf(format string, args ...interface{}) {
+	tb.Errorf(format, args...)
+	tb.fatal = true
+	runtime.Goexit()
+}
+
+// assert runs the assertion in its own goroutine, so Fatalf can stop it
+func assert(t *testing.T, f func(tb testing.TB)) *fakeTB {
+	tb := &fakeTB{TB: t}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(tb)
+	}()
+	<-done
+
+	return tb
+}
+
+func TestContextStub(t *testing.T) {
+	ctx := CreateTestContext(WithTopic("ship"), WithRetries(2))
+
+	if err := ctx.SetVariables(camunda.Variables{"status": {Value: "packing", Type: "String"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.SetVariables(camunda.Variables{"parcel": {Value: "P-1", Type: "String"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.SetLocalVariables(camunda.Variables{"attempt": {Value: 1, Type: "Integer"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.Complete(&worker.TaskComplete{Variables: camunda.Variables{
+		"tracking": {Value: int64(42), Type: "Long"},
+		"carrier":  {Value: "DHL", Type: "String"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.AssertCompletedWith(t, camunda.Variables{"tracking": {Value: 42, Type: "Long"}})
+
+	if want := []string{"SetVariables", "SetVariables", "SetLocalVariables", "Complete"}; !reflect.DeepEqual(ctx.Calls, want) {
+		t.Errorf("expected calls %v, got %v", want, ctx.Calls)
+	}
+
+	if len(ctx.ProcessVariables) != 2 || ctx.LocalVariables["attempt"] == nil {
+		t.Errorf("unexpected variables %v, %v", ctx.ProcessVariables, ctx.LocalVariables)
+	}
+
+	if ctx.TopicName() != "ship" || ctx.Retries() != 2 {
+		t.Errorf("unexpected task %s, %d", ctx.TopicName(), ctx.Retries())
+	}
+}
+
+func TestContextStub_failures(t *testing.T) {
+	ctx := CreateTestContext()
+	if err := ctx.HandleFailure(worker.TaskFailureRequest{ErrorMessage: "out of stock", Retries: 3}); err != nil {
+		t.Fatal(err)
+	}
+	ctx.AssertFailedWithRetries(t, 3)
+
+	ctx = CreateTestContext()
+	if err := ctx.HandleBPMNError(42, "rejected"); err != nil {
+		t.Fatal(err)
+	}
+	ctx.AssertBPMNError(t, "42")
+
+	// a failing engine
+	errEngine := errors.New("engine down")
+	ctx = CreateTestContext()
+	ctx.Err = errEngine
+
+	if err := ctx.Complete(&worker.TaskComplete{}); err != errEngine {
+		t.Errorf("expected the engine error, got %v", err)
+	}
+
+	if err := ctx.ReportBPMNError(&worker.BPMNError{Code: "rejected"}); err != errEngine {
+		t.Errorf("expected the engine error, got %v", err)
+	}
+
+	if ctx.Completed != nil || ctx.BPMNError != nil {
+		t.Error("expected no outcome recorded when the engine fails")
+	}
+}
+
+func TestContextStub_failingAssertions(t *testing.T) {
+	ctx := CreateTestContext()
+
+	tests := []struct {
+		name   string
+		assert func(tb testing.TB)
+	}{
+		{"not completed", func(tb testing.TB) { ctx.AssertCompletedWith(tb, nil) }},
+		{"no BPMN error", func(tb testing.TB) { ctx.AssertBPMNError(tb, "rejected") }},
+		{"no failure", func(tb testing.TB) { ctx.AssertFailedWithRetries(tb, 0) }},
+	}
+
+	for _, tt := range tests {
+		if tb := assert(t, tt.assert); len(tb.errors) != 1 || !tb.fatal {
+			t.Errorf("%s: expected a fatal failure, got %v", tt.name, tb.errors)
+		}
+	}
+
+	ctx = CreateTestContext()
+	_ = ctx.Complete(&worker.TaskComplete{Variables: camunda.Variables{"carrier": {Value: "UPS", Type: "String"}}})
+	_ = ctx.ReportBPMNError(&worker.BPMNError{Code: "out-of-stock"})
+	_ = ctx.HandleFailure(worker.TaskFailureRequest{Retries: 1})
+
+	tb := assert(t, func(tb testing.TB) {
+		ctx.AssertCompletedWith(tb, camunda.Variables{"carrier": {Value: "DHL", Type: "String"}})
+		ctx.AssertBPMNError(tb, "rejected")
+		ctx.AssertFailedWithRetries(tb, 2)
+	})
+
+	if len(tb.errors) != 3 || tb.fatal {
+		t.Fatalf("expected 3 failures, got %v", tb.errors)
+	}
+
+	if !strings.Contains(tb.errors[0], "carrier: UPS, want DHL") {
+		t.Errorf("unexpected failure %s", tb.errors[0])
+	}
+}
+
+func TestDiffVariables(t *testing.T) {
+	actual := camunda.Variables{
+		"amount": {Value: int64(10), Type: "Long"},
+		"status": {Value: "ok", Type: "String"},
+	}
+
+	tests := []struct {
+		expected camunda.Variables
+		diff     string
+	}{
+		{camunda.Variables{"amount": {Value: 10}}, ""},
+		{camunda.Variables{"amount": {Value: 10, Type: "Long"}, "status": nil}, ""},
+		{camunda.Variables{"amount": {Value: 11}}, "  amount: 10, want 11\n"},
+		{camunda.Variables{"amount": {Value: 10, Type: "Integer"}}, "  amount: type Long, want Integer\n"},
+		{camunda.Variables{"missing": {Value: true}}, "  missing: missing, want true\n"},
+	}
+
+	for _, tt := range tests {
+		if diff := diffVariables(tt.expected, actual); diff != tt.diff {
+			t.Errorf("expected diff %q, got %q", tt.diff, diff)
+		}
+	}
+}
+
+func TestWithTask(t *testing.T) {
+	task := &camunda.ResLockedExternalTask{
+		TaskBase:  &camunda.TaskBase{ID: "task-1", TopicName: "ship"},
+		Variables: camunda.Variables{"status": {Value: "new", Type: "String"}},
+	}
+
+	ctx := CreateTestContext(WithTask(task))
+	ctx.Task.TopicName = "bill"
+	ctx.Task.Variables["status"].Value = "packed"
+	ctx.Task.Variables["parcel"] = &camunda.Variable{Value: "P-1", Type: "String"}
+
+	if task.TopicName != "ship" || task.Variables["status"].Value != "new" || len(task.Variables) != 1 {
+		t.Errorf("expected the task of the caller to be unchanged, got %+v, %v", task.TaskBase, task.Variables)
+	}
+
+	if ctx.TaskID() != "task-1" {
+		t.Errorf("expected the task to be copied, got %s", ctx.TaskID())
+	}
+
+	if ctx := CreateTestContext(WithTask(&camunda.ResLockedExternalTask{})); ctx.Task.TaskBase == nil {
+		t.Error("expected a task base")
+	}
+}
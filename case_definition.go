@@ -11,7 +11,7 @@ type CaseDefinition struct {
 	// The name of the case definition
 	Name string `json:"name"`
 	// The version of the case definition that the engine assigned to it
-	Version int `json:"Version"`
+	Version int `json:"version"`
 	// The file name of the case definition
 	Resource string `json:"resource"`
 	// The deployment id of the case definition
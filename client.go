@@ -102,6 +102,13 @@ func (c *Client) ProcessManager() *ProcessManager {
 	}
 }
 
+// ExecutionManager returns the client of the execution API
+func (c *Client) ExecutionManager() *ExecutionManager {
+	return &ExecutionManager{
+		client: c,
+	}
+}
+
 // SetCustomTransport set new custom transport
 func (c *Client) SetCustomTransport(customHTTPTransport http.RoundTripper) {
 	if c.httpClient != nil {
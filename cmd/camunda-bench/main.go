@@ -0,0 +1,310 @@
+// Command camunda-bench measures how many process starts and external tasks per second an engine and a worker
+// sustain. It deploys a model of a chain of external tasks, starts instances at a fixed rate and completes
+// the tasks with a worker, then reports the throughput, the latency percentiles and the error rates:
+//
+//	camunda-bench -endpoint http://localhost:8080/engine-rest -rate 100 -duration 1m -tasks 3 -delay 20ms
+//
+// Without an endpoint it runs against an in-memory fake engine, which measures the overhead of the worker
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+	"github.com/interticketinc/camunda/deploy"
+	"github.com/interticketinc/camunda/worker"
+)
+
+// processKey the key of the deployed benchmark process
+const processKey = "camunda-bench"
+
+// errInjected the error returned by the handlers failing on purpose
+var errInjected = errors.New("injected failure")
+
+// config the parameters of a benchmark run
+type config struct {
+	Rate      float64       `json:"rate"`
+	Duration  time.Duration `json:"duration"`
+	Tasks     int           `json:"tasks"`
+	Delay     time.Duration `json:"delay"`
+	Jitter    time.Duration `json:"jitter"`
+	FailRatio float64       `json:"failRatio"`
+	Parallel  int           `json:"parallel"`
+	Inflight  int           `json:"inflight"`
+	Drain     time.Duration `json:"drain"`
+}
+
+func main() {
+	endpoint := flag.String("endpoint", "", "the engine REST API (default: an in-memory fake engine)")
+	user := flag.String("user", "", "the API user")
+	password := flag.String("password", "", "the API password")
+	format := flag.String("format", "text", "the report format: text or json")
+
+	var cfg config
+	flag.Float64Var(&cfg.Rate, "rate", 50, "the process instances started per second")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "how long instances are started")
+	flag.IntVar(&cfg.Tasks, "tasks", 1, "the number of external tasks per instance")
+	flag.DurationVar(&cfg.Delay, "delay", 0, "the time a handler works on a task")
+	flag.DurationVar(&cfg.Jitter, "jitter", 0, "a random time added to the delay of a handler, up to the value")
+	flag.Float64Var(&cfg.FailRatio, "fail", 0, "the ratio of the tasks failed by the handlers (0-1), their instances stay pending")
+	flag.IntVar(&cfg.Parallel, "parallel", 10, "the parallel tasks per topic of the worker")
+	flag.IntVar(&cfg.Inflight, "inflight", 100, "the maximum pending start requests, further starts are dropped")
+	flag.DurationVar(&cfg.Drain, "drain", 30*time.Second, "how long to wait for the started instances to end")
+	flag.Parse()
+
+	if cfg.Rate <= 0 || cfg.Tasks < 1 || cfg.Parallel < 1 || cfg.Inflight < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	var client *camunda.Client
+	if *endpoint == "" {
+		engine := camtest.NewEngine()
+		defer engine.Close()
+		client = engine.Client()
+	} else {
+		client = camunda.NewClient(&camunda.ClientOptions{EndpointUrl: *endpoint, ApiUser: *user, ApiPassword: *password})
+	}
+
+	res, err := run(client, cfg)
+	if err == nil {
+		switch *format {
+		case "text":
+			err = res.writeText(os.Stdout)
+		case "json":
+			err = res.writeJSON(os.Stdout)
+		default:
+			err = fmt.Errorf("unknown format %s", *format)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// bench the state of a running benchmark
+type bench struct {
+	cfg   config
+	runID int64
+
+	// started the start time of the pending instances by business key
+	started sync.Map
+	pending int64
+
+	starts    *latencies
+	handlers  *latencies
+	endToEnd  *latencies
+	startErrs int64
+	dropped   int64
+	completed int64
+	failed    int64
+	// reportErrs the errors of reporting a result to the engine
+	reportErrs int64
+	fetchErrs  int64
+	lastEnd    int64
+}
+
+func run(client *camunda.Client, cfg config) (*result, error) {
+	b := &bench{
+		cfg:      cfg,
+		runID:    time.Now().Unix(),
+		starts:   &latencies{},
+		handlers: &latencies{},
+		endToEnd: &latencies{},
+	}
+
+	if _, err := deploy.NewManager(client).Create(&deploy.CreateRequest{
+		DeploymentName:           processKey,
+		EnableDuplicateFiltering: true,
+		Resources:                map[string]io.Reader{processKey + ".bpmn": strings.NewReader(model(cfg.Tasks))},
+	}); err != nil {
+		return nil, fmt.Errorf("cannot deploy the benchmark process: %w", err)
+	}
+
+	w := worker.New(client, &worker.Options{
+		WorkerID:                  fmt.Sprintf("%s-%d", processKey, b.runID),
+		LockDuration:              time.Minute,
+		LongPollingTimeout:        5 * time.Second,
+		MaxParallelTaskPerHandler: cfg.Parallel,
+		Observer:                  &observer{b: b},
+	})
+	for i := 1; i <= cfg.Tasks; i++ {
+		w.AddHandler([]*camunda.TopicLockConfig{{TopicName: topic(i)}}, b.handle)
+	}
+
+	began := time.Now()
+	b.generate(client)
+	generated := time.Since(began)
+
+	for deadline := time.Now().Add(cfg.Drain); atomic.LoadInt64(&b.pending) > 0 && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	w.Stop()
+
+	return b.result(began, generated), nil
+}
+
+// generate starts instances at the rate for the duration, the starts exceeding the pending requests are dropped
+func (b *bench) generate(client *camunda.Client) {
+	slots := make(chan struct{}, b.cfg.Inflight)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / b.cfg.Rate))
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	stop := time.After(b.cfg.Duration)
+	for n := 0; ; n++ {
+		select {
+		case <-stop:
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			atomic.AddInt64(&b.dropped, 1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(n int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			b.start(client, fmt.Sprintf("%s-%d-%d", processKey, b.runID, n))
+		}(n)
+	}
+}
+
+func (b *bench) start(client *camunda.Client, businessKey string) {
+	began := time.Now()
+	b.started.Store(businessKey, began)
+	atomic.AddInt64(&b.pending, 1)
+
+	_, err := client.ProcessManager().StartInstance(camunda.ProcessConfig{Key: processKey}, camunda.InstanceParams{
+		BusinessKey: businessKey,
+	})
+	if err != nil {
+		b.started.Delete(businessKey)
+		atomic.AddInt64(&b.pending, -1)
+		atomic.AddInt64(&b.startErrs, 1)
+		return
+	}
+
+	b.starts.add(time.Since(began))
+}
+
+// handle works for the delay and completes the task, or fails it at the fail ratio
+func (b *bench) handle(ctx worker.Context) error {
+	delay := b.cfg.Delay
+	if b.cfg.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(b.cfg.Jitter)))
+	}
+	time.Sleep(delay)
+
+	if b.cfg.FailRatio > 0 && rand.Float64() < b.cfg.FailRatio {
+		return errInjected
+	}
+
+	return ctx.Complete(&worker.TaskComplete{})
+}
+
+// ended records the end-to-end latency of the instance of the business key
+func (b *bench) ended(businessKey string) {
+	began, ok := b.started.LoadAndDelete(businessKey)
+	if !ok {
+		return
+	}
+
+	atomic.AddInt64(&b.pending, -1)
+	atomic.StoreInt64(&b.lastEnd, time.Now().UnixNano())
+	b.endToEnd.add(time.Since(began.(time.Time)))
+}
+
+// observer records the results of the worker
+type observer struct {
+	worker.NopObserver
+	b *bench
+}
+
+func (o *observer) FetchFinished(_ []string, _ int, err error) {
+	if err != nil {
+		atomic.AddInt64(&o.b.fetchErrs, 1)
+	}
+}
+
+func (o *observer) HandlerFinished(_ *camunda.ResLockedExternalTask, outcome worker.Outcome, duration time.Duration) {
+	o.b.handlers.add(duration)
+	if outcome == worker.OutcomeFailed {
+		atomic.AddInt64(&o.b.failed, 1)
+	}
+}
+
+func (o *observer) CompleteSent(task *camunda.ResLockedExternalTask, err error) {
+	if err != nil {
+		atomic.AddInt64(&o.b.reportErrs, 1)
+		return
+	}
+
+	atomic.AddInt64(&o.b.completed, 1)
+	if task.TopicName == topic(o.b.cfg.Tasks) {
+		o.b.ended(task.BusinessKey)
+	}
+}
+
+func (o *observer) FailureSent(_ *camunda.ResLockedExternalTask, _ worker.TaskFailureRequest, err error) {
+	if err != nil {
+		atomic.AddInt64(&o.b.reportErrs, 1)
+	}
+}
+
+func topic(i int) string {
+	return fmt.Sprintf("%s-%d", processKey, i)
+}
+
+// model a process of a chain of n external tasks
+func model(n int) string {
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"
+                  xmlns:camunda="http://camunda.org/schema/1.0/bpmn" id="` + processKey + `-definitions"
+                  targetNamespace="http://bpmn.io/schema/bpmn">
+  <bpmn:process id="` + processKey + `" isExecutable="true" camunda:historyTimeToLive="1">
+    <bpmn:startEvent id="start" />
+`)
+
+	prev := "start"
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("task-%d", i)
+		fmt.Fprintf(&b, "    <bpmn:serviceTask id=%q camunda:type=\"external\" camunda:topic=%q />\n", id, topic(i))
+		fmt.Fprintf(&b, "    <bpmn:sequenceFlow id=\"flow-%d\" sourceRef=%q targetRef=%q />\n", i, prev, id)
+		prev = id
+	}
+
+	fmt.Fprintf(&b, "    <bpmn:endEvent id=\"end\" />\n")
+	fmt.Fprintf(&b, "    <bpmn:sequenceFlow id=\"flow-end\" sourceRef=%q targetRef=\"end\" />\n", prev)
+	b.WriteString("  </bpmn:process>\n</bpmn:definitions>\n")
+
+	return b.String()
+}
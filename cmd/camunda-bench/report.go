@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencies the recorded durations of an operation
+type latencies struct {
+	mu     sync.Mutex
+	values []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.values = append(l.values, d)
+	l.mu.Unlock()
+}
+
+// summary the percentiles of the recorded durations
+func (l *latencies) summary() latencySummary {
+	l.mu.Lock()
+	values := append([]time.Duration(nil), l.values...)
+	l.mu.Unlock()
+
+	if len(values) == 0 {
+		return latencySummary{}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// percentile the nearest-rank percentile p
+	percentile := func(p float64) time.Duration {
+		i := int(p*float64(len(values))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(values) {
+			i = len(values) - 1
+		}
+
+		return values[i]
+	}
+
+	return latencySummary{
+		Count: len(values),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   values[len(values)-1],
+	}
+}
+
+// latencySummary the percentiles of a latency
+type latencySummary struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+func (s latencySummary) String() string {
+	if s.Count == 0 {
+		return "no samples"
+	}
+
+	return fmt.Sprintf("p50 %s  p90 %s  p99 %s  max %s", round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+}
+
+// result the report of a benchmark run
+type result struct {
+	Config  config        `json:"config"`
+	Elapsed time.Duration `json:"elapsed"`
+
+	Started      int64   `json:"started"`
+	StartErrors  int64   `json:"startErrors"`
+	Dropped      int64   `json:"dropped"`
+	StartsPerSec float64 `json:"startsPerSec"`
+
+	Completed   int64   `json:"completed"`
+	Failed      int64   `json:"failed"`
+	TasksPerSec float64 `json:"tasksPerSec"`
+
+	Ended         int64   `json:"ended"`
+	Pending       int64   `json:"pending"`
+	EndedPerSec   float64 `json:"endedPerSec"`
+	ReportErrors  int64   `json:"reportErrors"`
+	FetchErrors   int64   `json:"fetchErrors"`
+	StartErrRate  float64 `json:"startErrorRate"`
+	TaskErrRate   float64 `json:"taskErrorRate"`
+	ReportErrRate float64 `json:"reportErrorRate"`
+
+	StartLatency    latencySummary `json:"startLatency"`
+	HandlerLatency  latencySummary `json:"handlerLatency"`
+	EndToEndLatency latencySummary `json:"endToEndLatency"`
+}
+
+// result summarizes the run, the rates of the tasks and the ended instances are measured until the last end
+func (b *bench) result(began time.Time, generated time.Duration) *result {
+	r := &result{
+		Config:          b.cfg,
+		Elapsed:         time.Since(began),
+		StartErrors:     atomic.LoadInt64(&b.startErrs),
+		Dropped:         atomic.LoadInt64(&b.dropped),
+		Completed:       atomic.LoadInt64(&b.completed),
+		Failed:          atomic.LoadInt64(&b.failed),
+		Pending:         atomic.LoadInt64(&b.pending),
+		ReportErrors:    atomic.LoadInt64(&b.reportErrs),
+		FetchErrors:     atomic.LoadInt64(&b.fetchErrs),
+		StartLatency:    b.starts.summary(),
+		HandlerLatency:  b.handlers.summary(),
+		EndToEndLatency: b.endToEnd.summary(),
+	}
+	r.Started = int64(r.StartLatency.Count)
+	r.Ended = int64(r.EndToEndLatency.Count)
+
+	r.StartsPerSec = perSec(r.Started, generated)
+	if last := atomic.LoadInt64(&b.lastEnd); last > 0 {
+		window := time.Unix(0, last).Sub(began)
+		r.TasksPerSec = perSec(r.Completed, window)
+		r.EndedPerSec = perSec(r.Ended, window)
+	}
+
+	r.StartErrRate = ratio(r.StartErrors, r.Started+r.StartErrors)
+	r.TaskErrRate = ratio(r.Failed, r.Completed+r.Failed)
+	r.ReportErrRate = ratio(r.ReportErrors, r.Completed+r.Failed+r.ReportErrors)
+
+	return r
+}
+
+func (r *result) writeText(w io.Writer) error {
+	c := r.Config
+	_, err := fmt.Fprintf(w, `run        %s at %g/s, %d task(s) per instance, handler delay %s (+%s jitter), fail ratio %g
+starts     %d ok, %d failed, %d dropped, %.1f/s
+           latency %s
+tasks      %d completed, %d failed, %.1f/s
+           handler %s
+instances  %d ended, %d pending, %.1f/s
+           end-to-end %s
+errors     start %.2f%%, task %.2f%%, report %.2f%%, fetch %d
+`,
+		c.Duration, c.Rate, c.Tasks, c.Delay, c.Jitter, c.FailRatio,
+		r.Started, r.StartErrors, r.Dropped, r.StartsPerSec,
+		r.StartLatency,
+		r.Completed, r.Failed, r.TasksPerSec,
+		r.HandlerLatency,
+		r.Ended, r.Pending, r.EndedPerSec,
+		r.EndToEndLatency,
+		r.StartErrRate*100, r.TaskErrRate*100, r.ReportErrRate*100, r.FetchErrors)
+
+	return err
+}
+
+func (r *result) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+func perSec(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(n) / d.Seconds()
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(n) / float64(total)
+}
+
+// round rounds a latency for display
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,107 @@
+// Command camunda-coverage reports the flow node and sequence flow coverage of BPMN processes from the historic
+// activity instances of an engine, e.g. after an integration test run:
+//
+//	camunda-coverage -endpoint http://localhost:8080/engine-rest -format html -out coverage.html -threshold 80 order.bpmn
+//
+// It exits with status 1 if the coverage of all processes is below the threshold
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest"
+)
+
+// pageSize the number of historic activity instances fetched at once
+const pageSize = 1000
+
+func main() {
+	endpoint := flag.String("endpoint", camunda.DefaultEndpointUrl, "the engine REST API")
+	user := flag.String("user", "", "the API user")
+	password := flag.String("password", "", "the API password")
+	format := flag.String("format", "text", "the report format: text, json or html")
+	out := flag.String("out", "", "the report file (default: stdout)")
+	threshold := flag.Float64("threshold", 0, "the minimum coverage in percent")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] model.bpmn...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*endpoint, *user, *password, *format, *out, *threshold/100, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(endpoint, user, password, format, out string, threshold float64, models []string) error {
+	coverage := camtest.NewCoverage()
+	for _, name := range models {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		if err := coverage.AddModel(data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	client := camunda.NewClient(&camunda.ClientOptions{EndpointUrl: endpoint, ApiUser: user, ApiPassword: password})
+	history := camunda.NewHistoryManager(client)
+	for first := 0; ; first += pageSize {
+		activities, err := history.GetActivityInstances(camunda.HistoricActivityInstanceQuery{
+			SortBy:      "startTime",
+			SortOrder:   "asc",
+			FirstResult: first,
+			MaxResults:  pageSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		coverage.AddHistory(activities)
+		if len(activities) < pageSize {
+			break
+		}
+	}
+
+	report := coverage.Report()
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var err error
+	switch format {
+	case "text":
+		err = report.WriteText(w)
+	case "json":
+		err = report.WriteJSON(w)
+	case "html":
+		err = report.WriteHTML(w)
+	default:
+		err = fmt.Errorf("unknown format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return report.Check(threshold)
+}
@@ -0,0 +1,626 @@
+package camunda_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/deploy"
+)
+
+// defaultOpenAPISpec the spec downloaded by make update-openapi, CAMUNDA_OPENAPI overrides it
+const defaultOpenAPISpec = "camunda/openapi.json"
+
+// openAPISpec the parts of the OpenAPI spec of the engine checked by the contract tests
+type openAPISpec struct {
+	Paths      map[string]*openAPIPath `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// openAPIPath the operations of a path
+type openAPIPath struct {
+	Get    *openAPIOperation `json:"get"`
+	Post   *openAPIOperation `json:"post"`
+	Put    *openAPIOperation `json:"put"`
+	Delete *openAPIOperation `json:"delete"`
+}
+
+type openAPIOperation struct {
+	Parameters []*openAPIParameter `json:"parameters"`
+}
+
+type openAPIParameter struct {
+	Name   string         `json:"name"`
+	In     string         `json:"in"`
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Format     string                    `json:"format"`
+	Items      *openAPISchema            `json:"items"`
+	Properties map[string]*openAPISchema `json:"properties"`
+	AllOf      []*openAPISchema          `json:"allOf"`
+}
+
+// schemaContract a type sent or received as a JSON body of the schema
+type schemaContract struct {
+	value  interface{}
+	schema string
+}
+
+// queryContract a type sent as the query parameters of the operation
+type queryContract struct {
+	value  interface{}
+	method string
+	path   string
+}
+
+var schemaContracts = []schemaContract{
+	{camunda.QueryGetListPost{}, "ExternalTaskQueryDto"},
+	{camunda.ResExternalTask{}, "ExternalTaskDto"},
+	{camunda.FetchAndLockRequest{}, "FetchExternalTasksDto"},
+	{camunda.TopicLockConfig{}, "FetchExternalTaskTopicDto"},
+	{camunda.ResLockedExternalTask{}, "LockedExternalTaskDto"},
+	{camunda.Variable{}, "VariableValueDto"},
+	{camunda.QueryComplete{}, "CompleteExternalTaskDto"},
+	{camunda.QueryHandleBPMNError{}, "ExternalTaskBpmnError"},
+	{camunda.Failure{}, "ExternalTaskFailureDto"},
+	{camunda.QueryExtendLock{}, "ExtendLockOnExternalTaskDto"},
+	{camunda.QuerySetRetriesAsync{}, "SetRetriesForExternalTasksDto"},
+	{camunda.QuerySetRetriesSync{}, "SetRetriesForExternalTasksDto"},
+	{camunda.ResBatch{}, "BatchDto"},
+	{camunda.ProcessInstance{}, "ProcessInstanceDto"},
+	{camunda.ProcessDefinition{}, "ProcessInstanceWithVariablesDto"},
+	{camunda.ProcessDefinitionResponse{}, "ProcessDefinitionDto"},
+	{camunda.InstanceParams{}, "StartProcessInstanceDto"},
+	{camunda.RestartInstanceRequest{}, "RestartProcessInstanceDto"},
+	{camunda.StartInstructionsRequest{}, "ProcessInstanceModificationInstructionDto"},
+	{camunda.ResActivityInstanceStatistics{}, "ActivityStatisticsResultDto"},
+	{camunda.ResInstanceStatistics{}, "ProcessDefinitionStatisticsResultDto"},
+	{camunda.ResActivityInstanceStatisticsIncident{}, "IncidentStatisticsResultDto"},
+	{camunda.ResGetStartFormKey{}, "FormDto"},
+	{camunda.ResBPMNProcessDefinition{}, "ProcessDefinitionDiagramDto"},
+	{camunda.ReqSubmitStartForm{}, "StartProcessInstanceFormDto"},
+	{camunda.ResSubmitStartForm{}, "ProcessInstanceDto"},
+	{camunda.ReqActivateOrSuspendById{}, "ProcessDefinitionSuspensionStateDto"},
+	{camunda.ReqActivateOrSuspendByKey{}, "ProcessDefinitionSuspensionStateDto"},
+	{camunda.CaseDefinition{}, "CaseDefinitionDto"},
+	{camunda.DecisionDefinition{}, "DecisionDefinitionDto"},
+	{camunda.ResDecisionRequirementsDefinition{}, "DecisionRequirementsDefinitionDto"},
+	{camunda.MessageRequest{}, "CorrelationMessageDto"},
+	{camunda.SendMessageResponse{}, "MessageCorrelationResultWithVariableDto"},
+	{camunda.ReqModifyVariables{}, "PatchVariablesDto"},
+	{camunda.ResHistoricActivityInstance{}, "HistoricActivityInstanceDto"},
+	{camunda.ResHistoricProcessInstance{}, "HistoricProcessInstanceDto"},
+	{camunda.ResHistoricVariableInstance{}, "HistoricVariableInstanceDto"},
+	{camunda.UserTaskResponse{}, "TaskDto"},
+	{camunda.UserTaskGetListQuery{}, "TaskQueryDto"},
+	{camunda.QueryUserTaskComplete{}, "CompleteTaskDto"},
+	{camunda.ResponseCount{}, "CountResultDto"},
+	{camunda.ResLink{}, "AtomLink"},
+	{camunda.ResVersion{}, "VersionDto"},
+	{camunda.Error{}, "ExceptionDto"},
+	{deploy.Deployment{}, "DeploymentDto"},
+	{deploy.CreateResponse{}, "DeploymentWithDefinitionsDto"},
+	{deploy.ResourceResponse{}, "DeploymentResourceDto"},
+	{deploy.RedeployRequest{}, "RedeploymentDto"},
+}
+
+var queryContracts = []queryContract{
+	{camunda.TaskFilter{}, "get", "/external-task"},
+	{camunda.ProcessInstanceQuery{}, "get", "/process-instance"},
+	{camunda.FormVariableFilter{}, "get", "/process-definition/{id}/form-variables"},
+	{camunda.HistoricActivityInstanceQuery{}, "get", "/history/activity-instance"},
+	{camunda.HistoricVariableInstanceQuery{}, "get", "/history/variable-instance"},
+	{deploy.ListOptions{}, "get", "/deployment"},
+	{deploy.DeleteOptions{}, "delete", "/deployment/{id}"},
+}
+
+// TestContract checks the request, response and query types against the OpenAPI spec of the engine.
+// The spec is downloaded in CI, so a missing spec fails the test there
+func TestContract(t *testing.T) {
+	path := os.Getenv("CAMUNDA_OPENAPI")
+	if path == "" {
+		path = defaultOpenAPISpec
+	}
+
+	spec, err := loadOpenAPISpec(path)
+	if os.IsNotExist(err) {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("no OpenAPI spec at %s, run make update-openapi before the tests", path)
+		}
+
+		t.Skipf("no OpenAPI spec at %s, run make update-openapi", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range schemaContracts {
+		c := c
+		typ := reflect.TypeOf(c.value)
+		t.Run(typ.String(), func(t *testing.T) {
+			if spec.Components.Schemas[c.schema] == nil {
+				t.Errorf("schema %s not in the spec", c.schema)
+				return
+			}
+
+			if diff := spec.checkSchema(typ, c.schema); len(diff) > 0 {
+				t.Errorf("%s does not match schema %s:\n  %s", typ, c.schema, strings.Join(diff, "\n  "))
+			}
+		})
+	}
+
+	for _, c := range queryContracts {
+		c := c
+		typ := reflect.TypeOf(c.value)
+		t.Run(typ.String(), func(t *testing.T) {
+			op := spec.operation(c.method, c.path)
+			if op == nil {
+				t.Errorf("operation %s %s not in the spec", strings.ToUpper(c.method), c.path)
+				return
+			}
+
+			if diff := spec.checkQuery(typ, op); len(diff) > 0 {
+				t.Errorf("%s does not match the query parameters of %s %s:\n  %s",
+					typ, strings.ToUpper(c.method), c.path, strings.Join(diff, "\n  "))
+			}
+		})
+	}
+}
+
+// TestContractCoverage checks that every exported type with json or url tags is in the contracts,
+// directly or as the type of a field of a contract, so a new request or response type cannot skip the contract tests
+func TestContractCoverage(t *testing.T) {
+	covered := map[string]bool{}
+	for _, c := range schemaContracts {
+		coverType(reflect.TypeOf(c.value), covered)
+	}
+	for _, c := range queryContracts {
+		coverType(reflect.TypeOf(c.value), covered)
+	}
+
+	for _, dir := range []string{".", "deploy"} {
+		types, err := taggedTypes(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range types {
+			if !covered[name] {
+				t.Errorf("%s has json or url tags but no contract, add it to schemaContracts or queryContracts", name)
+			}
+		}
+	}
+}
+
+// coverType marks the type and the types of its fields as covered
+func coverType(typ reflect.Type, covered map[string]bool) {
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		coverType(typ.Elem(), covered)
+	case reflect.Struct:
+		if covered[typ.String()] {
+			return
+		}
+		covered[typ.String()] = true
+
+		for i := 0; i < typ.NumField(); i++ {
+			coverType(typ.Field(i).Type, covered)
+		}
+	}
+}
+
+// taggedTypes returns the exported struct types of the package in dir with a field tagged json or url
+func taggedTypes(dir string) ([]string, error) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []string
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if ok && ts.Name.IsExported() && hasContractTag(st) {
+						types = append(types, pkg.Name+"."+ts.Name.Name)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+func hasContractTag(st *ast.StructType) bool {
+	for _, f := range st.Fields.List {
+		if f.Tag == nil {
+			continue
+		}
+
+		tag := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+		if _, ok := tag.Lookup("json"); ok {
+			return true
+		}
+		if _, ok := tag.Lookup("url"); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestContractCheck checks that the contract tests report the drifts of a type
+func TestContractCheck(t *testing.T) {
+	var spec openAPISpec
+	if err := json.Unmarshal([]byte(`{
+		"paths": {"/item": {"get": {"parameters": [
+			{"name": "id", "in": "query", "schema": {"type": "string"}},
+			{"name": "tenantIdIn", "in": "query", "schema": {"type": "string"}},
+			{"name": "active", "in": "query", "schema": {"type": "boolean"}},
+			{"name": "maxResults", "in": "query", "schema": {"type": "integer"}}
+		]}}},
+		"components": {"schemas": {
+			"ItemDto": {"allOf": [{"$ref": "#/components/schemas/BaseDto"}, {"properties": {
+				"workerId": {"type": "string"},
+				"sorting": {"type": "array", "items": {"$ref": "#/components/schemas/SortingDto"}},
+				"created": {"type": "string", "format": "date-time"}
+			}}]},
+			"BaseDto": {"type": "object", "properties": {"retries": {"type": "integer"}}},
+			"SortingDto": {"type": "object", "properties": {"sortBy": {"type": "string"}}}
+		}}
+	}`), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	type sorting struct {
+		SortBy  string `json:"sortBy"`
+		SortDir string `json:"sortDir"`
+	}
+	type item struct {
+		WorkerID string        `json:"workerID"`
+		Retries  string        `json:"retries"`
+		Sorting  *sorting      `json:"sorting"`
+		Created  *camunda.Time `json:"created"`
+		Ignored  string        `json:"-"`
+	}
+	type itemQuery struct {
+		ID         string   `url:"id,omitempty"`
+		TenantIDIn []string `url:"tenantIdIn,omitempty"`
+		Active     bool     `json:"active"`
+		MaxResults string   `url:"maxResults,omitempty"`
+		First      int      `url:"firstResult,omitempty"`
+	}
+
+	checks := []struct {
+		diff []string
+		want []string
+	}{
+		{
+			diff: spec.checkSchema(reflect.TypeOf(item{}), "ItemDto"),
+			want: []string{
+				`WorkerID: key "workerID" not in the schema, did you mean "workerId"?`,
+				`Retries: type string, the spec has integer`,
+				`Sorting: type object, the spec has array`,
+			},
+		},
+		{
+			diff: spec.checkQuery(reflect.TypeOf(itemQuery{}), spec.operation("get", "/item")),
+			want: []string{
+				`TenantIDIn: sent as repeated parameters, the spec has a comma-separated string (add the comma option)`,
+				`Active: not sent as a query parameter, it has no url tag (json:"active")`,
+				`First: parameter "firstResult" not in the operation`,
+			},
+		},
+	}
+
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.diff, c.want) {
+			t.Errorf("unexpected diff:\n  %s\nwant:\n  %s", strings.Join(c.diff, "\n  "), strings.Join(c.want, "\n  "))
+		}
+	}
+}
+
+func loadOpenAPISpec(path string) (*openAPISpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec openAPISpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("cannot parse OpenAPI spec %s: %w", path, err)
+	}
+
+	return &spec, nil
+}
+
+func (s *openAPISpec) operation(method, path string) *openAPIOperation {
+	p := s.Paths[path]
+	if p == nil {
+		return nil
+	}
+
+	switch method {
+	case "get":
+		return p.Get
+	case "post":
+		return p.Post
+	case "put":
+		return p.Put
+	case "delete":
+		return p.Delete
+	}
+
+	return nil
+}
+
+// resolve follows the references of the schema and merges the properties of allOf
+func (s *openAPISpec) resolve(schema *openAPISchema) *openAPISchema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+
+	if schema == nil || len(schema.AllOf) == 0 {
+		return schema
+	}
+
+	merged := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, part := range append([]*openAPISchema{{Properties: schema.Properties}}, schema.AllOf...) {
+		if part = s.resolve(part); part != nil {
+			for name, p := range part.Properties {
+				merged.Properties[name] = p
+			}
+		}
+	}
+
+	return merged
+}
+
+// checkSchema compares the JSON fields of the type with the properties of the schema
+func (s *openAPISpec) checkSchema(typ reflect.Type, name string) []string {
+	var diff []string
+	s.compare(typ, &openAPISchema{Ref: "#/components/schemas/" + name}, "", map[string]bool{}, &diff)
+
+	return diff
+}
+
+func (s *openAPISpec) compare(typ reflect.Type, schema *openAPISchema, path string, seen map[string]bool, diff *[]string) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if schema.Ref != "" {
+		key := typ.String() + schema.Ref
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+	}
+
+	schema = s.resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	want := schemaType(schema)
+	if got := goSchemaType(typ); got != "" && want != "" && !compatible(got, want) {
+		*diff = append(*diff, fmt.Sprintf("%s: type %s, the spec has %s", strings.TrimPrefix(path, "."), got, want))
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		if schema.Items != nil {
+			s.compare(typ.Elem(), schema.Items, path+"[]", seen, diff)
+		}
+	case reflect.Struct:
+		if typ == reflect.TypeOf(camunda.Time{}) || len(schema.Properties) == 0 {
+			return
+		}
+
+		for _, f := range jsonFields(typ) {
+			prop := schema.Properties[f.key]
+			if prop == nil {
+				*diff = append(*diff, fmt.Sprintf("%s: key %q not in the schema%s",
+					strings.TrimPrefix(path+"."+f.name, "."), f.key, suggest(f.key, schema.Properties)))
+				continue
+			}
+
+			s.compare(f.typ, prop, path+"."+f.name, seen, diff)
+		}
+	}
+}
+
+// checkQuery compares the fields of the type encoded by go-querystring with the query parameters of the operation
+func (s *openAPISpec) checkQuery(typ reflect.Type, op *openAPIOperation) []string {
+	params := map[string]*openAPISchema{}
+	for _, p := range op.Parameters {
+		if p.In == "query" {
+			params[p.Name] = s.resolve(p.Schema)
+		}
+	}
+
+	var diff []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag, ok := f.Tag.Lookup("url")
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s: not sent as a query parameter, it has no url tag (%s)", f.Name, f.Tag))
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		if opts[0] == "-" {
+			continue
+		}
+
+		name := opts[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		param, ok := params[name]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s: parameter %q not in the operation%s", f.Name, name, suggest(name, params)))
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		want := schemaType(param)
+		got := goSchemaType(ft)
+		switch {
+		case want == "" || got == "":
+		case got == "array" && want == "string":
+			if !contains(opts[1:], "comma") {
+				diff = append(diff, fmt.Sprintf("%s: sent as repeated parameters, the spec has a comma-separated string (add the comma option)", f.Name))
+			}
+		case got == "string" && want != "array" && want != "object":
+			// query values are text, a string holds any scalar parameter
+		case !compatible(got, want):
+			diff = append(diff, fmt.Sprintf("%s: type %s, the spec has %s", f.Name, got, want))
+		}
+	}
+
+	return diff
+}
+
+// jsonField a field encoded by encoding/json
+type jsonField struct {
+	name string
+	key  string
+	typ  reflect.Type
+}
+
+// jsonFields lists the fields of the struct encoded by encoding/json, the fields of embedded structs included
+func jsonFields(typ reflect.Type) []jsonField {
+	var fields []jsonField
+
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(ft)...)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+
+		if tag == "" {
+			tag = f.Name
+		}
+
+		fields = append(fields, jsonField{name: f.Name, key: tag, typ: f.Type})
+	}
+
+	return fields
+}
+
+// schemaType the type of the schema, object for a schema with properties only
+func schemaType(schema *openAPISchema) string {
+	if schema.Type == "" && len(schema.Properties) > 0 {
+		return "object"
+	}
+
+	return schema.Type
+}
+
+// goSchemaType the JSON schema type of a Go type, empty for any type
+func goSchemaType(typ reflect.Type) string {
+	if typ == reflect.TypeOf(camunda.Time{}) {
+		return "string"
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+
+	return ""
+}
+
+// compatible reports whether a value of the Go type holds values of the spec type
+func compatible(got, want string) bool {
+	return got == want || got == "number" && want == "integer"
+}
+
+// suggest proposes a key differing only in case
+func suggest(key string, keys map[string]*openAPISchema) string {
+	var names []string
+	for k := range keys {
+		if strings.EqualFold(k, key) {
+			names = append(names, k)
+		}
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf(", did you mean %q?", names[0])
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
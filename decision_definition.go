@@ -11,7 +11,7 @@ type DecisionDefinition struct {
 	// The name of the decision definition
 	Name string `json:"name"`
 	// The version of the decision definition that the engine assigned to it
-	Version int `json:"Version"`
+	Version int `json:"version"`
 	// The file name of the decision definition
 	Resource string `json:"resource"`
 	// The deployment id of the decision definition
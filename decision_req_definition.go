@@ -12,7 +12,7 @@ type ResDecisionRequirementsDefinition struct {
 	// The name of the decision requirements definition
 	Name string `json:"name"`
 	// The version of the decision requirements definition that the engine assigned to it
-	Version int `json:"Version"`
+	Version int `json:"version"`
 	// The file name of the decision requirements definition
 	Resource string `json:"resource"`
 	// The deployment id of the decision requirements definition
@@ -0,0 +1,37 @@
+package camunda
+
+import "fmt"
+
+// ExecutionManager a client for Execution API
+type ExecutionManager struct {
+	client *Client
+}
+
+// GetLocalVars retrieves all variables of a given execution by id
+func (e *ExecutionManager) GetLocalVars(id string) (Variables, error) {
+	res, err := e.client.Get("/execution/"+id+"/localVariables",
+		map[string]string{"deserializeValues": "false"})
+	if err != nil {
+		return nil, fmt.Errorf("cannot invoke client: %w", err)
+	}
+
+	var vars Variables
+
+	err = e.client.Marshal(res, &vars)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal variables: %w", err)
+	}
+
+	return vars, nil
+}
+
+// ModifyLocalVars updates or deletes the variables in the context of an execution by id.
+// The updates do not propagate upwards in the execution hierarchy
+func (e *ExecutionManager) ModifyLocalVars(id string, req ReqModifyVariables) error {
+	_, err := e.client.Post("/execution/"+id+"/localVariables", nil, &req)
+	if err != nil {
+		return fmt.Errorf("cannot modify local variables: %w", err)
+	}
+
+	return nil
+}
@@ -14,18 +14,18 @@ type QueryGetListPost struct {
 	// Filter by an external task topic
 	TopicName *string `json:"topicName,omitempty"`
 	// Filter by the id of the worker that the task was most recently Locked by
-	WorkerID *string `json:"workerID,omitempty"`
+	WorkerID *string `json:"workerId,omitempty"`
 	// Only include external tasks that are currently Locked (i.e., they have a lock time and it has not expired).
 	// Value may only be true, as false matches any external task
-	Locked *bool `json:"Locked,omitempty"`
+	Locked *bool `json:"locked,omitempty"`
 	// Only include external tasks that are currently not Locked (i.e., they have no lock or it has expired).
 	// Value may only be true, as false matches any external task
-	NotLocked *bool `json:"NotLocked,omitempty"`
+	NotLocked *bool `json:"notLocked,omitempty"`
 	// Only include external tasks that have a positive (> 0) number of retries (or null). Value may only be true,
 	// as false matches any external task
-	WithRetriesLeft *bool `json:"WithRetriesLeft,omitempty"`
+	WithRetriesLeft *bool `json:"withRetriesLeft,omitempty"`
 	// Only include external tasks that have 0 retries. Value may only be true, as false matches any external task
-	NoRetriesLeft *bool `json:"NoRetriesLeft,omitempty"`
+	NoRetriesLeft *bool `json:"noRetriesLeft,omitempty"`
 	// Restrict to external tasks that have a lock that expires after a given date. By default*,
 	// the date must have the format yyyy-MM-dd'T'HH:mm:ss.SSSZ, e.g., 2013-01-23T14:42:45.000+0200
 	LockExpirationAfter *Time `json:"lockExpirationAfter,omitempty"`
@@ -92,11 +92,11 @@ type TopicLockConfig struct {
 	// Filter tasks based on process definition id
 	ProcessDefinitionID string `json:"processDefinitionId,omitempty"`
 	// Filter tasks based on process definition ids
-	ProcessDefinitionIDIn string `json:"processDefinitionIdIn,omitempty"`
+	ProcessDefinitionIDIn []string `json:"processDefinitionIdIn,omitempty"`
 	// Filter tasks based on process definition key
 	ProcessDefinitionKey string `json:"processDefinitionKey,omitempty"`
 	// Filter tasks based on process definition keys
-	ProcessDefinitionKeyIn *string `json:"processDefinitionKeyIn,omitempty"`
+	ProcessDefinitionKeyIn []string `json:"processDefinitionKeyIn,omitempty"`
 	// 	Filter tasks without tenant id
 	WithoutTenantID *bool `json:"withoutTenantId,omitempty"`
 	// Filter tasks based on tenant ids
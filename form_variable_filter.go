@@ -10,7 +10,7 @@ type FormVariableFilter struct {
 	// fetching of data.If the query parameter is omitted all variables are
 	// fetched.If the query parameter contains non-existent variable names,
 	// the variable names are ignored.
-	VariableNames string `query:"variableNames,omitempty"`
+	VariableNames string `url:"variableNames,omitempty"`
 
 	// DeserializeValues Determines whether serializable variable values
 	// (typically variables that store custom Java objects) should be deserialized
@@ -28,5 +28,5 @@ type FormVariableFilter struct {
 	// Note: While true is the default value for reasons of backward compatibility,
 	// we recommend setting this parameter to false when developing web applications
 	// that are independent of the Java process applications deployed to the engine.
-	DeserializeValues bool `query:"deserializeValues,omitempty"`
+	DeserializeValues bool `url:"deserializeValues,omitempty"`
 }
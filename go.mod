@@ -6,4 +6,5 @@ require (
 	github.com/google/go-querystring v1.0.0
 	github.com/mitchellh/mapstructure v1.4.1
 	github.com/rs/zerolog v1.20.0
+	gopkg.in/yaml.v3 v3.0.1
 )
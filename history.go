@@ -0,0 +1,207 @@
+package camunda
+
+import "fmt"
+
+// HistoryManager a client of the history of the engine
+type HistoryManager struct {
+	client *Client
+}
+
+// NewHistoryManager initializes the history manager
+func NewHistoryManager(client *Client) *HistoryManager {
+	return &HistoryManager{client: client}
+}
+
+// HistoricActivityInstanceQuery query struct for historic activity instances
+type HistoricActivityInstanceQuery struct {
+	// ActivityInstanceID Filter by activity instance id.
+	ActivityInstanceID string `url:"activityInstanceId,omitempty"`
+	// ProcessInstanceID Filter by process instance id.
+	ProcessInstanceID string `url:"processInstanceId,omitempty"`
+	// ProcessDefinitionID Filter by process definition id.
+	ProcessDefinitionID string `url:"processDefinitionId,omitempty"`
+	// ExecutionID Filter by the id of the execution that executed the activity instance.
+	ExecutionID string `url:"executionId,omitempty"`
+	// ActivityID Filter by the activity id (according to BPMN 2.0 XML).
+	ActivityID string `url:"activityId,omitempty"`
+	// ActivityType Filter by activity type.
+	ActivityType string `url:"activityType,omitempty"`
+	// Finished Only include finished activity instances. Value may only be true, as false is the default behavior.
+	Finished bool `url:"finished,omitempty"`
+	// Unfinished Only include unfinished activity instances. Value may only be true, as false is the default behavior.
+	Unfinished bool `url:"unfinished,omitempty"`
+	// Canceled Only include canceled activity instances. Value may only be true, as false is the default behavior.
+	Canceled bool `url:"canceled,omitempty"`
+	// TenantIDIn Filter by a comma-separated list of tenant ids.
+	TenantIDIn string `url:"tenantIdIn,omitempty"`
+	// SortBy Sort the results by a given criterion. Valid values are activityInstanceId, instanceId, executionId,
+	// activityId, activityName, activityType, startTime, endTime, duration, definitionId, occurrence and tenantId.
+	// Must be used in conjunction with the sortOrder parameter.
+	SortBy string `url:"sortBy,omitempty"`
+	// SortOrder Sort the results in a given order. Values may be asc for ascending order or desc for descending
+	// order. Must be used in conjunction with the sortBy parameter.
+	SortOrder string `url:"sortOrder,omitempty"`
+	// FirstResult Pagination of results. Specifies the index of the first result to return.
+	FirstResult int `url:"firstResult,omitempty"`
+	// MaxResults Pagination of results. Specifies the maximum number of results to return.
+	MaxResults int `url:"maxResults,omitempty"`
+}
+
+// ResHistoricActivityInstance a response object of a historic activity instance
+type ResHistoricActivityInstance struct {
+	// ID The id of the activity instance.
+	ID string `json:"id"`
+	// ParentActivityInstanceID The id of the parent activity instance, for example a sub process instance.
+	ParentActivityInstanceID string `json:"parentActivityInstanceId"`
+	// ActivityID The id of the activity that this object is an instance of.
+	ActivityID string `json:"activityId"`
+	// ActivityName The name of the activity that this object is an instance of.
+	ActivityName string `json:"activityName"`
+	// ActivityType The type of the activity that this object is an instance of.
+	ActivityType string `json:"activityType"`
+	// ProcessDefinitionKey The key of the process definition that this activity instance belongs to.
+	ProcessDefinitionKey string `json:"processDefinitionKey"`
+	// ProcessDefinitionID The id of the process definition that this activity instance belongs to.
+	ProcessDefinitionID string `json:"processDefinitionId"`
+	// ProcessInstanceID The id of the process instance that this activity instance belongs to.
+	ProcessInstanceID string `json:"processInstanceId"`
+	// ExecutionID The id of the execution that executed this activity instance.
+	ExecutionID string `json:"executionId"`
+	// TaskID The id of the task that is associated to this activity instance. Is only set if the activity is a user task.
+	TaskID string `json:"taskId"`
+	// Assignee The assignee of the task that is associated to this activity instance.
+	Assignee string `json:"assignee"`
+	// CalledProcessInstanceID The id of the called process instance. Is only set if the activity is a call activity.
+	CalledProcessInstanceID string `json:"calledProcessInstanceId"`
+	// StartTime The time the instance was started.
+	StartTime Time `json:"startTime"`
+	// EndTime The time the instance ended, nil if the instance is running.
+	EndTime *Time `json:"endTime"`
+	// DurationInMillis The time the instance took to finish (in milliseconds).
+	DurationInMillis int64 `json:"durationInMillis"`
+	// Canceled If true, this activity instance is canceled.
+	Canceled bool `json:"canceled"`
+	// CompleteScope If true, this activity instance did complete a BPMN 2.0 scope.
+	CompleteScope bool `json:"completeScope"`
+	// TenantID The tenant id of the activity instance.
+	TenantID string `json:"tenantId"`
+}
+
+// GetActivityInstances queries for historic activity instances that fulfill the given parameters
+// https://docs.camunda.org/manual/latest/reference/rest/history/activity-instance/get-activity-instance-query/
+func (h *HistoryManager) GetActivityInstances(query HistoricActivityInstanceQuery) ([]*ResHistoricActivityInstance, error) {
+	var activities []*ResHistoricActivityInstance
+
+	res, err := h.client.Get("/history/activity-instance", query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get historic activity instances: %w", err)
+	}
+
+	if err := h.client.Marshal(res, &activities); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal historic activity instances: %w", err)
+	}
+
+	return activities, nil
+}
+
+// ResHistoricProcessInstance a response object of a historic process instance
+type ResHistoricProcessInstance struct {
+	// ID The id of the process instance.
+	ID string `json:"id"`
+	// BusinessKey The business key of the process instance.
+	BusinessKey string `json:"businessKey"`
+	// ProcessDefinitionID The id of the process definition that this process instance belongs to.
+	ProcessDefinitionID string `json:"processDefinitionId"`
+	// ProcessDefinitionKey The key of the process definition that this process instance belongs to.
+	ProcessDefinitionKey string `json:"processDefinitionKey"`
+	// ProcessDefinitionName The name of the process definition that this process instance belongs to.
+	ProcessDefinitionName string `json:"processDefinitionName"`
+	// StartTime The time the instance was started.
+	StartTime Time `json:"startTime"`
+	// EndTime The time the instance ended, nil if the instance is running.
+	EndTime *Time `json:"endTime"`
+	// DurationInMillis The time the instance took to finish (in milliseconds).
+	DurationInMillis int64 `json:"durationInMillis"`
+	// StartActivityID The id of the initial activity that was executed (e.g., a start event).
+	StartActivityID string `json:"startActivityId"`
+	// DeleteReason The provided delete reason in case the process instance was canceled during execution.
+	DeleteReason string `json:"deleteReason"`
+	// TenantID The tenant id of the process instance.
+	TenantID string `json:"tenantId"`
+	// State last state of the process instance, possible values are: ACTIVE, SUSPENDED, COMPLETED,
+	// EXTERNALLY_TERMINATED and INTERNALLY_TERMINATED
+	State string `json:"state"`
+}
+
+// HistoricVariableInstanceQuery query struct for historic variable instances
+type HistoricVariableInstanceQuery struct {
+	// VariableName Filter by variable name.
+	VariableName string `url:"variableName,omitempty"`
+	// ProcessInstanceID Filter by the process instance the variable belongs to.
+	ProcessInstanceID string `url:"processInstanceId,omitempty"`
+	// ExecutionIDIn Only include historic variable instances which belong to one of the passed and comma-separated
+	// execution ids.
+	ExecutionIDIn string `url:"executionIdIn,omitempty"`
+	// DeserializeValues Determines whether serializable variable values (typically variables that store custom Java
+	// objects) should be deserialized on server side (default true).
+	DeserializeValues *bool `url:"deserializeValues,omitempty"`
+	// FirstResult Pagination of results. Specifies the index of the first result to return.
+	FirstResult int `url:"firstResult,omitempty"`
+	// MaxResults Pagination of results. Specifies the maximum number of results to return.
+	MaxResults int `url:"maxResults,omitempty"`
+}
+
+// ResHistoricVariableInstance a response object of a historic variable instance
+type ResHistoricVariableInstance struct {
+	// ID The id of the variable instance.
+	ID string `json:"id"`
+	// Name The name of the variable instance.
+	Name string `json:"name"`
+	// Type The value type of the variable.
+	Type string `json:"type"`
+	// Value The variable's value.
+	Value interface{} `json:"value"`
+	// ValueInfo A JSON object containing additional, value-type-dependent properties.
+	ValueInfo *ValueInfo `json:"valueInfo,omitempty"`
+	// ProcessInstanceID The id the process instance belongs to.
+	ProcessInstanceID string `json:"processInstanceId"`
+	// ExecutionID The id of the execution the variable instance belongs to.
+	ExecutionID string `json:"executionId"`
+	// ActivityInstanceID The id of the activity instance in which the variable is valid.
+	ActivityInstanceID string `json:"activityInstanceId"`
+	// State The current state of the variable. Can be 'CREATED' or 'DELETED'.
+	State string `json:"state"`
+}
+
+// GetProcessInstance retrieves a historic process instance by id
+// https://docs.camunda.org/manual/latest/reference/rest/history/process-instance/get-process-instance/
+func (h *HistoryManager) GetProcessInstance(id string) (*ResHistoricProcessInstance, error) {
+	res, err := h.client.Get("/history/process-instance/"+id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get historic process instance: %w", err)
+	}
+
+	var instance ResHistoricProcessInstance
+	if err := h.client.Marshal(res, &instance); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal historic process instance: %w", err)
+	}
+
+	return &instance, nil
+}
+
+// GetVariableInstances queries for historic variable instances that fulfill the given parameters
+// https://docs.camunda.org/manual/latest/reference/rest/history/variable-instance/get-variable-instance-query/
+func (h *HistoryManager) GetVariableInstances(query HistoricVariableInstanceQuery) ([]*ResHistoricVariableInstance, error) {
+	var variables []*ResHistoricVariableInstance
+
+	res, err := h.client.Get("/history/variable-instance", query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get historic variable instances: %w", err)
+	}
+
+	if err := h.client.Marshal(res, &variables); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal historic variable instances: %w", err)
+	}
+
+	return variables, nil
+}
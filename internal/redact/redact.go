@@ -0,0 +1,89 @@
+// Package redact replaces sensitive values in the task dumps of the worker and the cassettes of camtest
+package redact
+
+import (
+	"net/http"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Value replaces the redacted values
+const Value = "REDACTED"
+
+// sensitiveHeaders the headers always redacted
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Match reports whether the variable is one of the names, "*" matches all variables
+func Match(names []string, name string) bool {
+	for _, n := range names {
+		if n == "*" || n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Variables returns a copy of the variables with the values of the redacted variables replaced,
+// the types are kept
+func Variables(vars camunda.Variables, names []string) camunda.Variables {
+	res := make(camunda.Variables, len(vars))
+	for name, v := range vars {
+		if v == nil {
+			continue
+		}
+
+		c := *v
+		if Match(names, name) {
+			c.Value = Value
+		}
+		res[name] = &c
+	}
+
+	return res
+}
+
+// JSONVariables replaces the values of the redacted variables in a decoded JSON value. A variable is
+// a property whose value is an object with a type and a value, like the variables of the engine
+func JSONVariables(v interface{}, names []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, child := range v {
+			if variable, ok := child.(map[string]interface{}); ok && isVariable(variable) && Match(names, name) {
+				variable["value"] = Value
+				continue
+			}
+
+			JSONVariables(child, names)
+		}
+	case []interface{}:
+		for _, child := range v {
+			JSONVariables(child, names)
+		}
+	}
+}
+
+// isVariable reports whether the JSON object is a variable
+func isVariable(m map[string]interface{}) bool {
+	_, hasValue := m["value"]
+	_, hasType := m["type"]
+
+	return hasValue && hasType
+}
+
+// Headers returns a copy of the headers with the values of Authorization, Cookie, Set-Cookie
+// and the named headers replaced
+func Headers(h http.Header, names []string) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+
+	res := h.Clone()
+	for _, name := range append(append([]string(nil), sensitiveHeaders...), names...) {
+		if res.Get(name) != "" {
+			res.Set(name, Value)
+		}
+	}
+
+	return res
+}
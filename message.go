@@ -103,5 +103,5 @@ type SendMessageResponse struct {
 	Execution interface{} `json:"execution,omitempty"`
 	// Variables This property is returned if the variablesInResultEnabled is set to true.
 	// Contains a list of the process variables.
-	Variables Variables
+	Variables Variables `json:"variables,omitempty"`
 }
@@ -15,7 +15,7 @@ type ProcessDefinitionResponse struct {
 	// The name of the process definition
 	Name string `json:"name"`
 	// The version of the process definition that the engine assigned to it
-	Version int `json:"Version"`
+	Version int `json:"version"`
 	// The file name of the process definition
 	Resource string `json:"resource"`
 	// The deployment id of the process definition
@@ -3,7 +3,7 @@ package camunda
 // ProcessInstanceQuery query struct for process instance
 type ProcessInstanceQuery struct {
     // ProcessInstanceIDs	Filter by a comma-separated list of process instance ids.
-    ProcessInstanceIDs []string `url:"processInstanceIds,omitempty"`
+    ProcessInstanceIDs []string `url:"processInstanceIds,comma,omitempty"`
     // BusinessKey	Filter by process instance business key.
     BusinessKey string `url:"businessKey,omitempty"`
     // BusinessKeyLike	Filter by process instance business key that the parameter is a substring of.
@@ -27,7 +27,7 @@ type ProcessInstanceQuery struct {
     //incidentMessage	Filter by the incident message. Exact match.
     //incidentMessageLike	Filter by the incident message that the parameter is a substring of.
     //tenantIdIn	Filter by a comma-separated list of tenant ids. A process instance must have one of the given tenant ids.
-    TenantIDIn []string `json:"tenantIdIn"`
+    TenantIDIn []string `url:"tenantIdIn,comma,omitempty"`
     //withoutTenantId	Only include process instances which belong to no tenant. Value may only be true, as false is the default behavior.
     //activityIdIn	Filter by a comma-separated list of activity ids. A process instance must currently wait in a leaf activity with one of the given activity ids.
     //rootProcessInstances	Restrict the query to all process instances that are top level process instances.
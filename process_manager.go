@@ -282,3 +282,14 @@ func (p *ProcessManager) GetInstanceVars(instanceId string) (Variables, error) {
 
 	return vars, nil
 }
+
+// ModifyInstanceVars updates or deletes the variables of a process instance by id.
+// Updates precede deletions, so if a variable is updated AND deleted, the deletion overrides the update
+func (p *ProcessManager) ModifyInstanceVars(instanceId string, req ReqModifyVariables) error {
+	_, err := p.client.Post(fmt.Sprintf("/process-instance/%s/variables", instanceId), nil, &req)
+	if err != nil {
+		return fmt.Errorf("cannot modify variables: %w", err)
+	}
+
+	return nil
+}
@@ -1,21 +1,38 @@
-package camunda
+package camunda_test
 
 import (
 	"encoding/json"
+	"io"
+	"strings"
 	"testing"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+	"github.com/interticketinc/camunda/deploy"
 )
 
-func createTestClient() *Client {
-	c := NewClient(&ClientOptions{EndpointUrl: DefaultEndpointUrl})
-	//dm := deploy.NewManager(c)
-	//dm.Create(&deploy.CreateRequest{
-	//    DeploymentName:           "",
-	//    EnableDuplicateFiltering: false,
-	//    DeployChangedOnly:        false,
-	//    DeploymentSource:         "",
-	//    TenantID:                 "",
-	//    Resources:                nil,
-	//})
+const testProcess = `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" id="Definitions_1">
+  <bpmn:process id="test-key" name="Test process" isExecutable="true">
+    <bpmn:startEvent id="start" />
+  </bpmn:process>
+</bpmn:definitions>`
+
+func createTestClient(t *testing.T) *camunda.Client {
+	engine := fakeengine.New()
+	t.Cleanup(engine.Close)
+
+	c := engine.Client()
+	dm := deploy.NewManager(c)
+	_, err := dm.Create(&deploy.CreateRequest{
+		DeploymentName: "test",
+		Resources: map[string]io.Reader{
+			"test.bpmn": strings.NewReader(testProcess),
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot deploy test process: %s", err)
+	}
 
 	return c
 }
@@ -30,7 +47,7 @@ func TestProcessManager_GetInstanceVars(t *testing.T) {
         }
       }}`
 
-	m := make(map[string]Variable)
+	m := make(map[string]camunda.Variable)
 	err := json.Unmarshal([]byte(ret), &m)
 	if err != nil {
 		t.Fatalf("cannot unmarshal %s", err.Error())
@@ -40,23 +57,34 @@ func TestProcessManager_GetInstanceVars(t *testing.T) {
 }
 
 func TestProcessManager_ListInstances(t *testing.T) {
-	pm := createTestClient().ProcessManager()
+	pm := createTestClient(t).ProcessManager()
 
-	//_, _ = pm.StartInstance(ProcessConfig{Key: "test-key", TenantId: "test"}, InstanceParams{
-	//    BusinessKey: "test-instance-key",
-	//})
+	_, err := pm.StartInstance(camunda.ProcessConfig{Key: "test-key"}, camunda.InstanceParams{
+		BusinessKey: "test-instance-key",
+	})
+	if err != nil {
+		t.Fatalf("cannot start instance: %s", err.Error())
+	}
 
-	instances, err := pm.ListInstances(ProcessInstanceQuery{
+	_, err = pm.StartInstance(camunda.ProcessConfig{Key: "test-key"}, camunda.InstanceParams{
+		BusinessKey: "other-instance-key",
+	})
+	if err != nil {
+		t.Fatalf("cannot start instance: %s", err.Error())
+	}
+
+	instances, err := pm.ListInstances(camunda.ProcessInstanceQuery{
 		BusinessKey: "test-instance-key",
 	})
 	if err != nil {
 		t.Fatalf("cannot list instances: %s", err.Error())
 	}
 
-	t.Logf("Instance list size: %d", len(instances))
+	if len(instances) != 1 {
+		t.Fatalf("Instance list size: got %d, want 1", len(instances))
+	}
 
-	for _, instance := range instances {
-		t.Logf("%s", instance.BusinessKey)
+	if instances[0].BusinessKey != "test-instance-key" {
+		t.Errorf("business key: got %s, want test-instance-key", instances[0].BusinessKey)
 	}
-	t.Logf("Instances: %+v", instances)
 }
@@ -0,0 +1,94 @@
+// Command openapi downloads the OpenAPI spec of the REST API of the engine for the contract tests.
+// The spec is published in a jar, which is read with archive/zip so the build needs no unzip:
+//
+//	go run ./tools/openapi -version 7.14.0 -out camunda/openapi.json
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// jarURL the URL of the jar with the spec of a version of the engine
+const jarURL = "https://app.camunda.com/nexus/repository/camunda-bpm/org/camunda/bpm/camunda-engine-rest-openapi/%[1]s/camunda-engine-rest-openapi-%[1]s.jar"
+
+// specName the name of the spec in the jar
+const specName = "openapi.json"
+
+func main() {
+	version := flag.String("version", "", "version of the engine")
+	out := flag.String("out", "camunda/openapi.json", "path of the extracted spec")
+	flag.Parse()
+
+	if *version == "" {
+		fmt.Fprintln(os.Stderr, "openapi: -version is required")
+		os.Exit(2)
+	}
+
+	if err := download(fmt.Sprintf(jarURL, *version), *out); err != nil {
+		fmt.Fprintf(os.Stderr, "openapi: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// download fetches the jar and writes the spec it contains to out
+func download(url, out string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download %s: %s", url, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot download %s: %w", url, err)
+	}
+
+	jar, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", url, err)
+	}
+
+	for _, f := range jar.File {
+		if f.Name == specName {
+			return extract(f, out)
+		}
+	}
+
+	return fmt.Errorf("no %s in %s", specName, url)
+}
+
+func extract(f *zip.File, out string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
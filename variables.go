@@ -10,6 +10,14 @@ import (
 
 type Variables map[string]*Variable
 
+// ReqModifyVariables a request to update or delete variables
+type ReqModifyVariables struct {
+	// A JSON object containing variable key-value pairs to update
+	Modifications Variables `json:"modifications,omitempty"`
+	// An array of names of variables to delete
+	Deletions []string `json:"deletions,omitempty"`
+}
+
 func (v Variables) String(name string) (string, error) {
 	if _, ok := v[name]; !ok {
 		return "", fmt.Errorf("variable '%s' not found", name)
@@ -0,0 +1,23 @@
+package camunda
+
+// ResVersion a version of the REST API
+type ResVersion struct {
+	// The version of the REST API
+	Version string `json:"version"`
+}
+
+// Version retrieves the version of the REST API.
+// It can be used to check whether the engine is reachable
+func (c *Client) Version() (*ResVersion, error) {
+	resp := &ResVersion{}
+	res, err := c.Get("/version", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Marshal(res, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+const (
+	// defaultBatchSize default maximum number of tasks of a batch
+	defaultBatchSize = 10
+	// defaultBatchWindow default time collecting the tasks of a batch
+	defaultBatchWindow = time.Second
+)
+
+// BatchHandler a handler for several external tasks of the same topics handled together.
+// It returns a result for each task, in the order of the tasks
+type BatchHandler func(tasks []Context) []BatchResult
+
+// BatchResult a result of a task of a batch, reported by the worker to the engine
+type BatchResult struct {
+	// Complete the variables completing the task when Err is nil
+	Complete *TaskComplete
+	// Err fails the task, or reports a BPMN error if it is a *BPMNError or mapped to one
+	Err error
+}
+
+// BatchOptions options for a batch handler
+type BatchOptions struct {
+	HandlerOptions
+
+	// MaxSize maximum number of tasks of a batch (default: 10)
+	MaxSize int
+	// Window maximum time to wait for MaxSize tasks after the first task of a batch is received (default: 1s)
+	Window time.Duration
+}
+
+// AddBatchHandler adds a handler receiving the tasks of the topics in batches.
+// HandlerOptions.Concurrency is the number of batches handled in parallel, the worker locks
+// at most Concurrency * MaxSize tasks at the same time. Idempotency is not applied to batch handlers
+func (p *Worker) AddBatchHandler(topics []*camunda.TopicLockConfig, handler BatchHandler, opts BatchOptions) {
+	if opts.MaxSize < 1 {
+		opts.MaxSize = defaultBatchSize
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = defaultBatchWindow
+	}
+
+	if opts.Concurrency < 1 {
+		opts.Concurrency = p.options.MaxParallelTaskPerHandler
+	}
+
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	b := &batcher{
+		worker:      p,
+		handler:     handler,
+		opts:        opts,
+		tasks:       make(chan fetchedTask, opts.MaxSize),
+		concurrency: int32(opts.Concurrency),
+		finished:    make(chan struct{}),
+		wake:        make(chan struct{}, 1),
+	}
+
+	hOpts := opts.HandlerOptions
+	hOpts.Concurrency = opts.Concurrency * opts.MaxSize
+
+	b.route = p.addRoute(topics, nil, b, hOpts)
+}
+
+// batcher collects the tasks of a batch handler
+type batcher struct {
+	worker  *Worker
+	route   *route
+	handler BatchHandler
+	opts    BatchOptions
+	tasks   chan fetchedTask
+
+	// concurrency maximum number of batches handled in parallel, changed by setConcurrency
+	concurrency int32
+	// finished receives a signal when a batch is handled
+	finished chan struct{}
+	// wake wakes up the collector when the concurrency changed
+	wake chan struct{}
+}
+
+// setConcurrency changes the maximum number of batches handled in parallel
+func (b *batcher) setConcurrency(n int) {
+	atomic.StoreInt32(&b.concurrency, int32(n))
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// add passes a task with a reserved slot to the batcher
+func (b *batcher) add(t fetchedTask) {
+	b.tasks <- t
+}
+
+// collect groups the received tasks into batches of MaxSize tasks or the tasks received within Window,
+// and handles at most Concurrency batches in parallel, the other batches wait for their turn.
+// It returns when the tasks channel is closed by Worker.Stop, after handling the collected tasks
+func (b *batcher) collect() {
+	defer b.worker.running.Done()
+
+	var (
+		batch []fetchedTask
+		timer *time.Timer
+		flush <-chan time.Time
+		// ready the batches waiting for a free turn, running the number of batches being handled
+		ready   [][]fetchedTask
+		running int
+	)
+
+	tasks := b.tasks
+
+	enqueue := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+
+		ready = append(ready, batch)
+
+		batch = nil
+		timer = nil
+		flush = nil
+	}
+
+	start := func() {
+		for len(ready) > 0 && running < int(atomic.LoadInt32(&b.concurrency)) {
+			running++
+
+			b.worker.running.Add(1)
+			go func(batch []fetchedTask) {
+				defer b.worker.running.Done()
+				b.run(batch)
+				b.finished <- struct{}{}
+			}(ready[0])
+
+			ready = ready[1:]
+		}
+	}
+
+	for tasks != nil || len(ready) > 0 || running > 0 {
+		select {
+		case task, ok := <-tasks:
+			if !ok {
+				tasks = nil
+				if len(batch) > 0 {
+					enqueue()
+				}
+
+				break
+			}
+
+			batch = append(batch, task)
+			if len(batch) == 1 {
+				timer = time.NewTimer(b.opts.Window)
+				flush = timer.C
+			}
+
+			if len(batch) >= b.opts.MaxSize {
+				enqueue()
+			}
+		case <-flush:
+			enqueue()
+		case <-b.finished:
+			running--
+		case <-b.wake:
+		}
+
+		start()
+	}
+}
+
+// run handles a batch and reports the result of every task individually,
+// so a task failing to report does not affect the others
+func (b *batcher) run(tasks []fetchedTask) {
+	p := b.worker
+	r := b.route
+
+	contexts := make([]*ContextImpl, len(tasks))
+	handlerContexts := make([]Context, len(tasks))
+
+	for i, t := range tasks {
+		r.track(t)
+
+		ctx := p.newContext(r, t)
+		if r.options.LockExtension {
+			ctx.StartLockExtender()
+		}
+
+		contexts[i] = ctx
+		handlerContexts[i] = ctx
+
+		p.options.Observer.HandlerStarted(t.task)
+	}
+
+	started := time.Now()
+	results := b.call(handlerContexts)
+
+	for i, ctx := range contexts {
+		if r.options.LockExtension {
+			ctx.StopExtender()
+		}
+		ctx.cancel()
+
+		b.report(ctx, results[i])
+
+		tasks[i].engine.stats.outcome(ctx.outcome)
+		p.options.Observer.HandlerFinished(ctx.Task, ctx.outcome, time.Since(started))
+		r.untrack(ctx.Task.ID)
+		r.slots.finish(tasks[i].engine.index)
+	}
+}
+
+// call runs the handler, a panic or a missing result fails the tasks
+func (b *batcher) call(contexts []Context) (results []BatchResult) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err := fmt.Errorf("fatal error in batch: %s", rec)
+
+			b.worker.log.Error().Err(err).Msg(string(debug.Stack()))
+
+			results = make([]BatchResult, len(contexts))
+			for i := range results {
+				results[i].Err = err
+			}
+		}
+	}()
+
+	results = b.handler(contexts)
+
+	for len(results) < len(contexts) {
+		results = append(results, BatchResult{
+			Err: fmt.Errorf("no result returned for task %s", contexts[len(results)].TaskID()),
+		})
+	}
+
+	return results
+}
+
+// report reports the result of a task, unless the handler already did it through the context
+func (b *batcher) report(ctx *ContextImpl, res BatchResult) {
+	if ctx.outcome != OutcomeNone {
+		return
+	}
+
+	if res.Err != nil {
+		b.worker.report(ctx, timeoutError(ctx, res.Err), b.route.options.RetryPolicy)
+		return
+	}
+
+	tc := res.Complete
+	if tc == nil {
+		tc = &TaskComplete{}
+	}
+
+	if err := ctx.Complete(tc); err != nil {
+		b.worker.log.Error().
+			Err(err).
+			Str("task", ctx.TaskID()).
+			Msg("error send complete")
+	}
+}
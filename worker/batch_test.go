@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// batchWorker starts a worker with the batch handler of the topic ship
+func batchWorker(engine *fakeengine.Engine, handler BatchHandler, opts BatchOptions) *Worker {
+	w := New(engine.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	w.AddBatchHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, handler, opts)
+
+	return w
+}
+
+// failed returns the error messages of the failed tasks of the topic
+func failed(e *fakeengine.Engine, topic string) []string {
+	var messages []string
+	for _, t := range e.ExternalTasks() {
+		if t.TopicName == topic && t.ErrorMessage != "" {
+			messages = append(messages, t.ErrorMessage)
+		}
+	}
+
+	return messages
+}
+
+// batchSizes a batch handler recording the sizes of the batches and completing every task
+type batchSizes struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (b *batchSizes) handle(tasks []Context) []BatchResult {
+	b.mu.Lock()
+	b.sizes = append(b.sizes, len(tasks))
+	b.mu.Unlock()
+
+	return make([]BatchResult, len(tasks))
+}
+
+func (b *batchSizes) get() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]int(nil), b.sizes...)
+}
+
+func TestBatchHandler_fullBatch(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	// a full batch is handled without waiting for the window
+	addTasks(engine, "ship", 3)
+	b := &batchSizes{}
+	w := batchWorker(engine, b.handle, BatchOptions{MaxSize: 3, Window: time.Hour})
+	defer w.Stop()
+
+	waitFor(t, "the batch to be completed", func() bool {
+		return completed(engine, "ship") == 3
+	})
+
+	if sizes := b.get(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Errorf("expected a batch of 3 tasks, got %v", sizes)
+	}
+}
+
+func TestBatchHandler_window(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	// a partial batch is handled when the window elapsed
+	addTasks(engine, "ship", 2)
+	b := &batchSizes{}
+	w := batchWorker(engine, b.handle, BatchOptions{MaxSize: 10, Window: 50 * time.Millisecond})
+	defer w.Stop()
+
+	waitFor(t, "the batch to be completed", func() bool {
+		return completed(engine, "ship") == 2
+	})
+
+	if sizes := b.get(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("expected a batch of 2 tasks, got %v", sizes)
+	}
+}
+
+func TestBatchHandler_missingResult(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	addTasks(engine, "ship", 2)
+	w := batchWorker(engine, func(tasks []Context) []BatchResult {
+		return make([]BatchResult, 1)
+	}, BatchOptions{MaxSize: 2, Window: time.Hour})
+	defer w.Stop()
+
+	waitFor(t, "the tasks to be reported", func() bool {
+		return completed(engine, "ship") == 1 && len(failed(engine, "ship")) == 1
+	})
+
+	if msg := failed(engine, "ship")[0]; !strings.Contains(msg, "no result returned") {
+		t.Errorf("unexpected failure %s", msg)
+	}
+}
+
+func TestBatchHandler_panic(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	addTasks(engine, "ship", 2)
+	w := batchWorker(engine, func(tasks []Context) []BatchResult {
+		panic("boom")
+	}, BatchOptions{MaxSize: 2, Window: time.Hour})
+	defer w.Stop()
+
+	waitFor(t, "the tasks to be failed", func() bool {
+		return len(failed(engine, "ship")) == 2
+	})
+
+	for _, msg := range failed(engine, "ship") {
+		if !strings.Contains(msg, "fatal error in batch: boom") {
+			t.Errorf("unexpected failure %s", msg)
+		}
+	}
+}
+
+func TestBatchHandler_concurrency(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	var running, peak int64
+	w := batchWorker(engine, func(tasks []Context) []BatchResult {
+		n := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+
+		if n > atomic.LoadInt64(&peak) {
+			atomic.StoreInt64(&peak, n)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		return make([]BatchResult, len(tasks))
+	}, BatchOptions{HandlerOptions: HandlerOptions{Concurrency: 1}, MaxSize: 5, Window: 10 * time.Millisecond})
+	defer w.Stop()
+
+	// the tasks arrive one by one, so every window closes a partial batch
+	for i := 0; i < 5; i++ {
+		addTasks(engine, "ship", 1)
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	waitFor(t, "the tasks to be completed", func() bool {
+		return completed(engine, "ship") == 5
+	})
+
+	if peak != 1 {
+		t.Errorf("expected one batch at a time, got %d", peak)
+	}
+
+	if err := w.SetConcurrency("ship", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if limit := w.Status().Handlers[0].Concurrency; limit != 15 {
+		t.Errorf("expected 15 slots for 3 batches of 5 tasks, got %d", limit)
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/interticketinc/camunda"
+)
+
+// BPMNError a business error returned by a handler. The worker reports it to the engine as BPMN error
+// instead of a task failure, so it can be caught by an error boundary event of the process
+type BPMNError struct {
+	// Code identifies the BPMN error handler
+	Code string
+	// Message describes the error
+	Message string
+	// Variables passed to the execution
+	Variables camunda.Variables
+}
+
+// NewBPMNError creates a new BPMN error
+func NewBPMNError(code, message string, variables camunda.Variables) *BPMNError {
+	return &BPMNError{
+		Code:      code,
+		Message:   message,
+		Variables: variables,
+	}
+}
+
+// Error error message
+func (e *BPMNError) Error() string {
+	return fmt.Sprintf("bpmn error %s: %s", e.Code, e.Message)
+}
+
+// errorMapping a mapping of matching errors to BPMN error code
+type errorMapping struct {
+	match func(err error) bool
+	code  string
+}
+
+// ErrorRegistry maps Go errors returned by the handlers to BPMN error codes
+type ErrorRegistry struct {
+	mu       sync.RWMutex
+	mappings []errorMapping
+}
+
+// Register maps the errors matching target (see errors.Is) to the BPMN error code
+func (r *ErrorRegistry) Register(target error, code string) {
+	r.add(errorMapping{
+		match: func(err error) bool {
+			return errors.Is(err, target)
+		},
+		code: code,
+	})
+}
+
+// RegisterType maps the errors having the same type as example anywhere in their chain to the BPMN error code
+func (r *ErrorRegistry) RegisterType(example error, code string) {
+	t := reflect.TypeOf(example)
+
+	r.add(errorMapping{
+		match: func(err error) bool {
+			for ; err != nil; err = errors.Unwrap(err) {
+				if reflect.TypeOf(err) == t {
+					return true
+				}
+			}
+
+			return false
+		},
+		code: code,
+	})
+}
+
+func (r *ErrorRegistry) add(m errorMapping) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mappings = append(r.mappings, m)
+}
+
+// Resolve returns the BPMN error for err. A *BPMNError in the chain of err is returned as is,
+// otherwise the first registered mapping matching err is used
+func (r *ErrorRegistry) Resolve(err error) (*BPMNError, bool) {
+	var bpmnErr *BPMNError
+	if errors.As(err, &bpmnErr) {
+		return bpmnErr, true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, m := range r.mappings {
+		if m.match(err) {
+			return &BPMNError{
+				Code:    m.code,
+				Message: err.Error(),
+			}, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+var errOutOfStock = errors.New("out of stock")
+
+type paymentError struct {
+	reason string
+}
+
+func (e *paymentError) Error() string {
+	return "payment declined: " + e.reason
+}
+
+func TestErrorRegistry_Resolve(t *testing.T) {
+	r := &ErrorRegistry{}
+	r.Register(errOutOfStock, "OUT_OF_STOCK")
+	r.RegisterType(&paymentError{}, "PAYMENT_DECLINED")
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+		ok   bool
+	}{
+		{"bpmn error", fmt.Errorf("wrapped: %w", NewBPMNError("CUSTOM", "custom", nil)), "CUSTOM", true},
+		{"sentinel", fmt.Errorf("reserve: %w", errOutOfStock), "OUT_OF_STOCK", true},
+		{"type", fmt.Errorf("charge: %w", &paymentError{reason: "expired"}), "PAYMENT_DECLINED", true},
+		{"unmapped", errors.New("connection reset"), "", false},
+	}
+
+	for _, tt := range tests {
+		bpmnErr, ok := r.Resolve(tt.err)
+		if ok != tt.ok {
+			t.Fatalf("%s: expected resolved %v, got %v", tt.name, tt.ok, ok)
+		}
+
+		if ok && bpmnErr.Code != tt.code {
+			t.Errorf("%s: expected code %s, got %s", tt.name, tt.code, bpmnErr.Code)
+		}
+	}
+}
+
+func TestWorker_reportBPMNErrors(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	w.MapBPMNError(errOutOfStock, "OUT_OF_STOCK")
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "reserve"}}, func(ctx Context) error {
+		switch taskOf(ctx).BusinessKey {
+		case "returned":
+			return fmt.Errorf("reserve: %w", NewBPMNError("NO_ADDRESS", "no address", nil))
+		case "mapped":
+			return fmt.Errorf("reserve: %w", errOutOfStock)
+		default:
+			return errors.New("connection reset")
+		}
+	})
+
+	for _, key := range []string{"returned", "mapped", "unmapped"} {
+		engine.AddExternalTask(fakeengine.ExternalTask{TopicName: "reserve", BusinessKey: key})
+	}
+
+	waitFor(t, "the results to be reported", func() bool {
+		for _, task := range engine.ExternalTasks() {
+			if task.State == fakeengine.TaskActive && task.ErrorMessage == "" {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	codes := map[string]string{"returned": "NO_ADDRESS", "mapped": "OUT_OF_STOCK"}
+	for _, task := range engine.ExternalTasks() {
+		code, bpmn := codes[task.BusinessKey]
+
+		switch {
+		case bpmn && (task.State != fakeengine.TaskBPMNError || task.ErrorCode != code):
+			t.Errorf("%s: expected BPMN error %s, got state %v, code %q", task.BusinessKey, code, task.State, task.ErrorCode)
+		case !bpmn && (task.State != fakeengine.TaskActive || !task.Incident()):
+			t.Errorf("%s: expected a failure, got state %v", task.BusinessKey, task.State)
+		}
+	}
+}
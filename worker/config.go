@@ -0,0 +1,331 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Duration a time.Duration read from strings like "30s" or "5m"
+type Duration time.Duration
+
+// UnmarshalText parses the duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// MarshalText formats the duration
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config a declarative configuration of a worker
+type Config struct {
+	// Engine the connection to the engine
+	Engine EngineConfig `json:"engine" yaml:"engine"`
+	// Engines the engines served by the worker instead of Engine, the same topics are fetched from all of them
+	Engines []EngineConfig `json:"engines" yaml:"engines"`
+	// WorkerID for all request (default: `worker-{random_int}`)
+	WorkerID string `json:"workerId" yaml:"workerId"`
+	// MaxTasks maximum tasks to receive for 1 request to camunda
+	MaxTasks int `json:"maxTasks" yaml:"maxTasks"`
+	// LockDuration default lock duration of the topics
+	LockDuration Duration `json:"lockDuration" yaml:"lockDuration"`
+	// LongPollingTimeout long polling timeout
+	LongPollingTimeout Duration `json:"longPollingTimeout" yaml:"longPollingTimeout"`
+	// SharedFetch fetch the tasks of all topics with a single request
+	SharedFetch bool `json:"sharedFetch" yaml:"sharedFetch"`
+	// Shard distributes the tasks between the replicas by business key
+	Shard *ShardConfig `json:"shard" yaml:"shard"`
+	// Topics the handled topics
+	Topics []TopicConfig `json:"topics" yaml:"topics"`
+}
+
+// EngineConfig a connection to the engine
+type EngineConfig struct {
+	// Name identifies the engine in the logs and the status, used with Engines
+	Name        string   `json:"name" yaml:"name"`
+	EndpointURL string   `json:"endpointUrl" yaml:"endpointUrl"`
+	User        string   `json:"user" yaml:"user"`
+	Password    string   `json:"password" yaml:"password"`
+	Timeout     Duration `json:"timeout" yaml:"timeout"`
+}
+
+// TopicConfig a topic bound to a handler registered by name
+type TopicConfig struct {
+	// Name the topic's name
+	Name string `json:"name" yaml:"name"`
+	// Handler the name of the handler in the handlers passed to Config.NewWorker
+	Handler string `json:"handler" yaml:"handler"`
+	// LockDuration lock duration of the tasks (default: Config.LockDuration)
+	LockDuration Duration `json:"lockDuration" yaml:"lockDuration"`
+	// Variables names of the variables to fetch (default: all)
+	Variables []string `json:"variables" yaml:"variables"`
+	// LocalVariables fetch only local variables
+	LocalVariables bool `json:"localVariables" yaml:"localVariables"`
+	// TenantIDs fetch only tasks of the tenants
+	TenantIDs []string `json:"tenantIds" yaml:"tenantIds"`
+	// WithoutTenantID fetch only tasks without tenant
+	WithoutTenantID bool `json:"withoutTenantId" yaml:"withoutTenantId"`
+	// ProcessDefinitionKeys fetch only tasks of the process definitions
+	ProcessDefinitionKeys []string `json:"processDefinitionKeys" yaml:"processDefinitionKeys"`
+	// Concurrency maximum running parallel task of the handler (default: 1)
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+	// Retry retry policy of the failed tasks (default: no retry)
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+	// LockExtension extends the lock of the tasks while the handler runs
+	LockExtension bool `json:"lockExtension" yaml:"lockExtension"`
+}
+
+// RetryConfig a retry policy
+type RetryConfig struct {
+	Retries int      `json:"retries" yaml:"retries"`
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+// ShardConfig the shard of the replica
+type ShardConfig struct {
+	// Index the shard of the replica, from 0 to Count-1
+	Index int `json:"index" yaml:"index"`
+	// Count number of shards
+	Count int `json:"count" yaml:"count"`
+	// Serialize runs the tasks of a business key one at a time
+	Serialize bool `json:"serialize" yaml:"serialize"`
+}
+
+// LoadConfig reads the configuration from a YAML or JSON file (by the .json extension),
+// then applies the overrides of the environment variables:
+// CAMUNDA_ENDPOINT_URL, CAMUNDA_USER, CAMUNDA_PASSWORD, CAMUNDA_TIMEOUT, CAMUNDA_WORKER_ID,
+// CAMUNDA_MAX_TASKS, CAMUNDA_LOCK_DURATION, CAMUNDA_LONG_POLLING_TIMEOUT, CAMUNDA_SHARD_INDEX,
+// CAMUNDA_SHARD_COUNT and CAMUNDA_TOPIC_<NAME>_CONCURRENCY, where <NAME> is the upper-cased topic name with '-' and '.' replaced by '_'.
+// The CAMUNDA_ENDPOINT_URL, CAMUNDA_USER, CAMUNDA_PASSWORD and CAMUNDA_TIMEOUT variables override Engine, the engines of Engines
+// are overridden by CAMUNDA_ENGINE_<NAME>_ENDPOINT_URL, CAMUNDA_ENGINE_<NAME>_USER, CAMUNDA_ENGINE_<NAME>_PASSWORD and
+// CAMUNDA_ENGINE_<NAME>_TIMEOUT, where <NAME> is the name of the engine (default: engine-{index}) in the same form
+func LoadConfig(path string) (*Config, error) {
+	bb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(bb, cfg)
+	} else {
+		err = yaml.Unmarshal(bb, cfg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid environment override: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration from the environment
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"CAMUNDA_WORKER_ID": &c.WorkerID,
+	}
+
+	durations := map[string]*Duration{
+		"CAMUNDA_LOCK_DURATION":        &c.LockDuration,
+		"CAMUNDA_LONG_POLLING_TIMEOUT": &c.LongPollingTimeout,
+	}
+
+	engines := map[string]*EngineConfig{"CAMUNDA_": &c.Engine}
+	for i := range c.Engines {
+		name := c.Engines[i].Name
+		if name == "" {
+			name = fmt.Sprintf("engine-%d", i)
+		}
+
+		engines["CAMUNDA_ENGINE_"+envName(name)+"_"] = &c.Engines[i]
+	}
+
+	for prefix, e := range engines {
+		strs[prefix+"ENDPOINT_URL"] = &e.EndpointURL
+		strs[prefix+"USER"] = &e.User
+		strs[prefix+"PASSWORD"] = &e.Password
+		durations[prefix+"TIMEOUT"] = &e.Timeout
+	}
+
+	for name, dst := range strs {
+		if v, ok := lookup(name); ok {
+			*dst = v
+		}
+	}
+
+	for name, dst := range durations {
+		if v, ok := lookup(name); ok {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"CAMUNDA_MAX_TASKS": &c.MaxTasks,
+	}
+	for _, name := range []string{"CAMUNDA_SHARD_INDEX", "CAMUNDA_SHARD_COUNT"} {
+		if _, ok := lookup(name); ok && c.Shard == nil {
+			c.Shard = &ShardConfig{}
+		}
+	}
+	if c.Shard != nil {
+		ints["CAMUNDA_SHARD_INDEX"] = &c.Shard.Index
+		ints["CAMUNDA_SHARD_COUNT"] = &c.Shard.Count
+	}
+	for i := range c.Topics {
+		ints["CAMUNDA_TOPIC_"+envName(c.Topics[i].Name)+"_CONCURRENCY"] = &c.Topics[i].Concurrency
+	}
+
+	for name, dst := range ints {
+		if v, ok := lookup(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			*dst = n
+		}
+	}
+
+	return nil
+}
+
+// envName returns the name in the form used in the names of environment variables
+func envName(name string) string {
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name))
+}
+
+// Client creates the client of the configured engine
+func (c *Config) Client() *camunda.Client {
+	return c.Engine.Client()
+}
+
+// Client creates the client of the engine
+func (e *EngineConfig) Client() *camunda.Client {
+	return camunda.NewClient(&camunda.ClientOptions{
+		EndpointUrl: e.EndpointURL,
+		ApiUser:     e.User,
+		ApiPassword: e.Password,
+		Timeout:     time.Duration(e.Timeout),
+	})
+}
+
+// engines returns the configured engines, Engine if Engines is empty
+func (c *Config) engines() []Engine {
+	if len(c.Engines) == 0 {
+		return []Engine{{Name: defaultEngine, Client: c.Client()}}
+	}
+
+	engines := make([]Engine, 0, len(c.Engines))
+	for i := range c.Engines {
+		engines = append(engines, Engine{Name: c.Engines[i].Name, Client: c.Engines[i].Client()})
+	}
+
+	return engines
+}
+
+// NewWorker creates a worker of the configured engine and binds each topic to the handler registered
+// by name in handlers. No handler is started if a topic refers to an unknown handler
+func (c *Config) NewWorker(handlers map[string]Handler) (*Worker, error) {
+	type binding struct {
+		topic   *camunda.TopicLockConfig
+		handler Handler
+		opts    HandlerOptions
+	}
+
+	var sharding *Sharding
+	if c.Shard != nil {
+		sharding = &Sharding{Index: c.Shard.Index, Count: c.Shard.Count, Serialize: c.Shard.Serialize}
+		if err := sharding.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings := make([]binding, 0, len(c.Topics))
+
+	for i := range c.Topics {
+		t := &c.Topics[i]
+
+		h, ok := handlers[t.Handler]
+		if !ok {
+			return nil, fmt.Errorf("topic %s: unknown handler %q", t.Name, t.Handler)
+		}
+
+		b := binding{
+			topic:   t.lockConfig(),
+			handler: h,
+			opts: HandlerOptions{
+				Concurrency:   t.Concurrency,
+				LockExtension: t.LockExtension,
+			},
+		}
+
+		if t.Retry != nil {
+			b.opts.RetryPolicy = &RetryPolicy{
+				Retries: t.Retry.Retries,
+				Timeout: time.Duration(t.Retry.Timeout),
+			}
+		}
+
+		bindings = append(bindings, b)
+	}
+
+	w := NewWithEngines(c.engines(), &Options{
+		WorkerID:           c.WorkerID,
+		LockDuration:       time.Duration(c.LockDuration),
+		MaxTasks:           c.MaxTasks,
+		LongPollingTimeout: time.Duration(c.LongPollingTimeout),
+		SharedFetch:        c.SharedFetch,
+		Sharding:           sharding,
+	})
+
+	for _, b := range bindings {
+		w.AddHandlerWithOptions([]*camunda.TopicLockConfig{b.topic}, b.handler, b.opts)
+	}
+
+	return w, nil
+}
+
+// lockConfig builds the fetch configuration of the topic
+func (t *TopicConfig) lockConfig() *camunda.TopicLockConfig {
+	tc := &camunda.TopicLockConfig{
+		TopicName:              t.Name,
+		LockDuration:           int(time.Duration(t.LockDuration) / time.Millisecond),
+		Variables:              t.Variables,
+		TenantIDIn:             t.TenantIDs,
+		ProcessDefinitionKeyIn: t.ProcessDefinitionKeys,
+	}
+
+	if t.LocalVariables {
+		tc.LocalVariables = &t.LocalVariables
+	}
+
+	if t.WithoutTenantID {
+		tc.WithoutTenantID = &t.WithoutTenantID
+	}
+
+	return tc
+}
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+const yamlConfig = `
+engine:
+  endpointUrl: http://localhost:8080/engine-rest
+  user: demo
+lockDuration: 1m
+longPollingTimeout: 20s
+topics:
+  - name: ship-order
+    handler: ship
+    concurrency: 2
+    processDefinitionKeys: [order, return]
+    retry:
+      retries: 3
+      timeout: 10s
+`
+
+const jsonConfig = `{
+  "engines": [{"name": "east", "endpointUrl": "http://east/engine-rest"}, {"endpointUrl": "http://west/engine-rest"}],
+  "maxTasks": 5,
+  "topics": [{"name": "ship-order", "handler": "ship"}]
+}`
+
+// writeConfig writes the configuration to a file of the name
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig_YAML(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "worker.yaml", yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Engine.EndpointURL != "http://localhost:8080/engine-rest" || cfg.Engine.User != "demo" {
+		t.Errorf("unexpected engine %+v", cfg.Engine)
+	}
+
+	if time.Duration(cfg.LockDuration) != time.Minute || time.Duration(cfg.LongPollingTimeout) != 20*time.Second {
+		t.Errorf("unexpected durations %s, %s", time.Duration(cfg.LockDuration), time.Duration(cfg.LongPollingTimeout))
+	}
+
+	topic := cfg.Topics[0]
+	if topic.Concurrency != 2 || topic.Retry == nil || time.Duration(topic.Retry.Timeout) != 10*time.Second {
+		t.Errorf("unexpected topic %+v", topic)
+	}
+
+	if lc := topic.lockConfig(); len(lc.ProcessDefinitionKeyIn) != 2 || lc.ProcessDefinitionKeyIn[1] != "return" {
+		t.Errorf("unexpected process definition keys %v", lc.ProcessDefinitionKeyIn)
+	}
+}
+
+func TestLoadConfig_JSON(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "worker.json", jsonConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Engines) != 2 || cfg.Engines[0].Name != "east" || cfg.MaxTasks != 5 || cfg.Topics[0].Handler != "ship" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "worker.json", yamlConfig)); err == nil {
+		t.Error("expected an error parsing YAML as JSON")
+	}
+}
+
+func TestConfig_applyEnv(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "worker.json", jsonConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"CAMUNDA_ENDPOINT_URL":                 "http://default/engine-rest",
+		"CAMUNDA_ENGINE_EAST_PASSWORD":         "secret",
+		"CAMUNDA_ENGINE_ENGINE_1_ENDPOINT_URL": "http://west-2/engine-rest",
+		"CAMUNDA_ENGINE_EAST_TIMEOUT":          "5s",
+		"CAMUNDA_LOCK_DURATION":                "2m",
+		"CAMUNDA_MAX_TASKS":                    "7",
+		"CAMUNDA_SHARD_INDEX":                  "1",
+		"CAMUNDA_SHARD_COUNT":                  "3",
+		"CAMUNDA_TOPIC_SHIP_ORDER_CONCURRENCY": "4",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	if err := cfg.applyEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Engine.EndpointURL != "http://default/engine-rest" {
+		t.Errorf("unexpected engine %+v", cfg.Engine)
+	}
+
+	if east := cfg.Engines[0]; east.Password != "secret" || time.Duration(east.Timeout) != 5*time.Second {
+		t.Errorf("unexpected engine east %+v", east)
+	}
+
+	if west := cfg.Engines[1]; west.EndpointURL != "http://west-2/engine-rest" {
+		t.Errorf("unexpected engine engine-1 %+v", west)
+	}
+
+	if time.Duration(cfg.LockDuration) != 2*time.Minute || cfg.MaxTasks != 7 || cfg.Topics[0].Concurrency != 4 {
+		t.Errorf("unexpected overrides %+v", cfg)
+	}
+
+	if cfg.Shard == nil || cfg.Shard.Index != 1 || cfg.Shard.Count != 3 {
+		t.Errorf("unexpected shard %+v", cfg.Shard)
+	}
+
+	env = map[string]string{"CAMUNDA_MAX_TASKS": "many"}
+	if err := cfg.applyEnv(lookup); err == nil {
+		t.Error("expected an error for an invalid number")
+	}
+}
+
+func TestConfig_NewWorker(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	handlers := map[string]Handler{"ship": func(ctx Context) error { return nil }}
+
+	cfg := &Config{
+		Engine:             EngineConfig{EndpointURL: engine.URL()},
+		LongPollingTimeout: Duration(200 * time.Millisecond),
+		Topics:             []TopicConfig{{Name: "ship-order", Handler: "unknown"}},
+	}
+	if _, err := cfg.NewWorker(handlers); err == nil {
+		t.Error("expected an error for an unknown handler")
+	}
+
+	cfg.Topics[0].Handler = "ship"
+	cfg.Shard = &ShardConfig{Index: 2, Count: 2}
+	if _, err := cfg.NewWorker(handlers); err == nil {
+		t.Error("expected an error for an invalid shard")
+	}
+
+	cfg.Shard = nil
+	w, err := cfg.NewWorker(handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if st := w.Status(); len(st.Handlers) != 1 || st.Handlers[0].Topics[0] != "ship-order" {
+		t.Errorf("unexpected handlers %+v", st.Handlers)
+	}
+}
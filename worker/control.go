@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownTopic the topic is not handled by the worker
+var ErrUnknownTopic = errors.New("unknown topic")
+
+// Pause stops fetching tasks of the topic. Tasks being handled are not affected,
+// tasks of the topic returned by a long polling request running meanwhile are unlocked
+func (p *Worker) Pause(topic string) error {
+	if _, err := p.routeOf(topic); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.paused[topic] = true
+	p.mu.Unlock()
+
+	p.log.Info().Str("topic", topic).Msg("topic paused")
+
+	return nil
+}
+
+// Resume continues fetching tasks of the paused topic
+func (p *Worker) Resume(topic string) error {
+	if _, err := p.routeOf(topic); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.paused, topic)
+	p.mu.Unlock()
+
+	p.log.Info().Str("topic", topic).Msg("topic resumed")
+
+	// Waking up the puller if it waits because all of its topics were paused
+	p.notifyChange()
+
+	return nil
+}
+
+// SetConcurrency changes the maximum number of tasks handled in parallel by the handler of the topic.
+// The concurrency is shared by all topics of the handler. When lowered, the running tasks are not
+// interrupted, but no new tasks are fetched until the handler is below the new limit.
+// For a batch handler n is the number of batches handled in parallel
+func (p *Worker) SetConcurrency(topic string, n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid concurrency %d: must be at least 1", n)
+	}
+
+	r, err := p.routeOf(topic)
+	if err != nil {
+		return err
+	}
+
+	if r.batch != nil {
+		r.slots.setCapacity(n * r.batch.opts.MaxSize)
+		r.batch.setConcurrency(n)
+	} else {
+		r.slots.setCapacity(n)
+	}
+
+	p.log.Info().Str("topic", topic).Int("concurrency", n).Msg("concurrency changed")
+
+	p.notifyChange()
+
+	return nil
+}
+
+// isPaused checks whether fetching the topic is paused
+func (p *Worker) isPaused(topic string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused[topic]
+}
+
+// routeOf returns the first route handling the topic
+func (p *Worker) routeOf(topic string) (*route, error) {
+	for _, r := range p.snapshotRoutes() {
+		for _, t := range r.topics {
+			if t.TopicName == topic {
+				return r, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+}
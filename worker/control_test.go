@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestWorker_PauseResume(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	client, rec := recordedClient(engine)
+	w := New(client, &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		started <- struct{}{}
+		<-release
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	if err := w.Pause("unknown"); err == nil {
+		t.Error("expected an error pausing an unknown topic")
+	}
+
+	addTasks(engine, "ship", 3)
+	<-started
+
+	if err := w.Pause("ship"); err != nil {
+		t.Fatal(err)
+	}
+	fetched := len(rec.fetches())
+
+	// the task being handled finishes, no further task is fetched
+	release <- struct{}{}
+	waitFor(t, "the running task to be completed", func() bool {
+		return completed(engine, "ship") == 1
+	})
+	time.Sleep(300 * time.Millisecond)
+
+	if n := len(rec.fetches()); n != fetched {
+		t.Errorf("expected no fetch of the paused topic, got %d", n-fetched)
+	}
+
+	if st := w.Status().Handlers[0]; len(st.Paused) != 1 || len(st.InFlight) != 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	// the new concurrency applies to the next fetch
+	if err := w.SetConcurrency("ship", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.SetConcurrency("ship", 0); err == nil {
+		t.Error("expected an error setting concurrency 0")
+	}
+
+	close(release)
+	if err := w.Resume("ship"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the remaining tasks to be completed", func() bool {
+		return completed(engine, "ship") == 3
+	})
+
+	if req := rec.fetches()[fetched]; req.MaxTasks != 2 {
+		t.Errorf("expected the first fetch after resume to request 2 tasks, got %d", req.MaxTasks)
+	}
+}
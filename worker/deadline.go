@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxDeadlineMargin the maximum default margin between the handler deadline and the lock expiration
+const maxDeadlineMargin = 5 * time.Second
+
+// ErrHandlerTimeout the handler did not finish before the lock of the task expired
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// ErrLockExpired the result of a task is not reported because its lock expired.
+// The engine may have given the task to another worker, so it is left to be fetched again
+var ErrLockExpired = errors.New("lock of the task expired")
+
+// withDeadline returns a context cancelled the margin before the lock expiration
+func withDeadline(lockExpiration time.Time, margin time.Duration) (context.Context, context.CancelFunc) {
+	if lockExpiration.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+
+	if margin <= 0 {
+		margin = time.Until(lockExpiration) / 10
+		if margin > maxDeadlineMargin {
+			margin = maxDeadlineMargin
+		}
+	}
+
+	return context.WithDeadline(context.Background(), lockExpiration.Add(-margin))
+}
+
+// timeoutError replaces the error returned by a handler after its deadline with a timeout error.
+// The cause is kept in the message only, so a cancelled BPMN error is reported as failure
+func timeoutError(ctx Context, err error) error {
+	if err == nil || !errors.Is(ctx.Ctx().Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	deadline, _ := ctx.Ctx().Deadline()
+
+	return fmt.Errorf("%w: deadline %s before the lock expiration passed: %s",
+		ErrHandlerTimeout, deadline.Format(time.RFC3339), err)
+}
+
+// lockExpired returns ErrLockExpired if the lock of the task expired
+func (c *ContextImpl) lockExpired() error {
+	if c.lockExpiration.IsZero() || time.Now().Before(c.lockExpiration) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: task %s at %s", ErrLockExpired, c.Task.ID, c.lockExpiration.Format(time.RFC3339))
+}
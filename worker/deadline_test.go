@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestWithDeadline(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		margin time.Duration
+		want   time.Duration
+	}{
+		{"10% of the time to expiry", 10 * time.Second, 0, 9 * time.Second},
+		{"capped at 5 seconds", 100 * time.Second, 0, 95 * time.Second},
+		{"explicit margin", 10 * time.Second, 3 * time.Second, 7 * time.Second},
+	}
+
+	for _, tt := range tests {
+		now := time.Now()
+		ctx, cancel := withDeadline(now.Add(tt.expiry), tt.margin)
+		deadline, ok := ctx.Deadline()
+		cancel()
+
+		if d := deadline.Sub(now); !ok || d < tt.want-100*time.Millisecond || d > tt.want+100*time.Millisecond {
+			t.Errorf("%s: expected deadline in %s, got %s", tt.name, tt.want, d)
+		}
+	}
+
+	ctx, cancel := withDeadline(time.Time{}, 0)
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline without lock expiration")
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	task := &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task-1"}}
+	errFailed := errors.New("failed")
+
+	ctx := NewContext(nil, task, "worker")
+	if err := timeoutError(ctx, errFailed); err != errFailed {
+		t.Errorf("expected the error before the deadline to be kept, got %v", err)
+	}
+
+	ctx.ctx, ctx.cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer ctx.cancel()
+
+	if err := timeoutError(ctx, nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := timeoutError(ctx, errFailed); !errors.Is(err, ErrHandlerTimeout) {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestContextImpl_lockExpired(t *testing.T) {
+	task := &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task-1"}}
+
+	// nothing is sent, the client would panic
+	ctx := NewContext(nil, task, "worker")
+	ctx.lockExpiration = time.Now().Add(-time.Second)
+
+	if err := ctx.Complete(&TaskComplete{}); !errors.Is(err, ErrLockExpired) {
+		t.Errorf("complete: expected lock expired, got %v", err)
+	}
+
+	if err := ctx.HandleFailure(TaskFailureRequest{}); !errors.Is(err, ErrLockExpired) {
+		t.Errorf("failure: expected lock expired, got %v", err)
+	}
+
+	if err := ctx.ReportBPMNError(&BPMNError{Code: "code"}); !errors.Is(err, ErrLockExpired) {
+		t.Errorf("bpmn error: expected lock expired, got %v", err)
+	}
+
+	if ctx.outcome != OutcomeNone {
+		t.Errorf("expected no outcome, got %s", ctx.outcome)
+	}
+}
+
+func TestWorker_handlerIgnoringDeadline(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{LockDuration: time.Second, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	var calls int32
+	completeErrs := make(chan error, 1)
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return ctx.Complete(&TaskComplete{})
+		}
+
+		// ignoring the cancelled context until the lock expired
+		<-ctx.Ctx().Done()
+		time.Sleep(1100 * time.Millisecond)
+
+		err := ctx.Complete(&TaskComplete{})
+		completeErrs <- err
+
+		return err
+	})
+
+	addTasks(engine, "ship", 1)
+
+	if err := <-completeErrs; !errors.Is(err, ErrLockExpired) {
+		t.Errorf("expected the completion after the lock expired to be refused, got %v", err)
+	}
+
+	// the task is fetched again and completed by the second run
+	waitFor(t, "the task to be completed", func() bool {
+		return completed(engine, "ship") == 1
+	})
+
+	if task := engine.ExternalTasks()[0]; task.ErrorMessage != "" {
+		t.Errorf("expected no failure reported, got %s", task.ErrorMessage)
+	}
+}
+
+// skewedClock a transport shifting the lock expirations of the fetched tasks, like an engine with another clock
+type skewedClock time.Duration
+
+func (s skewedClock) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil || !strings.HasSuffix(r.URL.Path, "/external-task/fetchAndLock") {
+		return res, err
+	}
+
+	var tasks []map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&tasks)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tasks {
+		t["lockExpirationTime"] = time.Now().Add(time.Duration(s)).Format(camunda.DefaultDateTimeFormat)
+	}
+
+	bb, err := json.Marshal(tasks)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(bb))
+	res.ContentLength = int64(len(bb))
+
+	return res, nil
+}
+
+func TestWorker_lockExpirationClockSkew(t *testing.T) {
+	for _, skew := range []time.Duration{-time.Hour, time.Hour} {
+		engine := fakeengine.New()
+
+		client := engine.Client()
+		client.SetCustomTransport(skewedClock(skew))
+
+		w := New(client, &Options{LockDuration: 10 * time.Second, LongPollingTimeout: 200 * time.Millisecond})
+
+		deadlines := make(chan time.Duration, 1)
+		w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+			deadline, _ := ctx.Ctx().Deadline()
+			deadlines <- time.Until(deadline)
+
+			return ctx.Complete(&TaskComplete{})
+		})
+
+		addTasks(engine, "ship", 1)
+
+		// the deadline follows the local clock: 10s lock duration less the 1s margin
+		if d := <-deadlines; d < 8*time.Second || d > 9*time.Second {
+			t.Errorf("skew %s: expected the deadline in 9s, got %s", skew, d)
+		}
+
+		waitFor(t, "the task to be completed", func() bool {
+			return completed(engine, "ship") == 1
+		})
+
+		w.Stop()
+		engine.Close()
+	}
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/internal/redact"
+)
+
+// unsafeFileChars the characters of a topic or task id not used in a dump file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FailureDump options for dumping the payloads of the tasks failed by a handler, to replay them locally.
+// A task is dumped when its failure is reported, by the worker or by the handler through Context.HandleFailure
+type FailureDump struct {
+	// Dir the directory of the dump files, a file <topic>-<task id>.json is written per failed task
+	Dir string
+	// RedactVariables the names of the variables whose values are not dumped, "*" for all variables.
+	// The type of a redacted variable is kept
+	RedactVariables []string
+}
+
+// TaskDump a dumped payload of a task failed by a handler
+type TaskDump struct {
+	// Task the locked task passed to the handler
+	Task *camunda.ResLockedExternalTask `json:"task"`
+	// WorkerID the id of the worker running the handler
+	WorkerID string `json:"workerId"`
+	// Failure the message of the failure reported to the engine
+	Failure string `json:"failure"`
+	// Outcome the result reported to the engine, whether or not it was delivered
+	Outcome Outcome `json:"outcome"`
+	// Delivered the engine received the result
+	Delivered bool `json:"delivered"`
+	// DeliveryError the error of sending the result to the engine
+	DeliveryError string `json:"deliveryError,omitempty"`
+	// DumpedAt the time of the dump
+	DumpedAt time.Time `json:"dumpedAt"`
+}
+
+// write dumps the task failed with the message, err is the error of sending the failure.
+// Returns the path of the file
+func (d *FailureDump) write(task *camunda.ResLockedExternalTask, workerID, failure string, err error) (string, error) {
+	dump := &TaskDump{
+		Task:      d.redact(task),
+		WorkerID:  workerID,
+		Failure:   failure,
+		Outcome:   OutcomeFailed,
+		Delivered: err == nil,
+		DumpedAt:  time.Now(),
+	}
+	if err != nil {
+		dump.DeliveryError = err.Error()
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal task dump: %w", err)
+	}
+
+	if err := os.MkdirAll(d.Dir, 0700); err != nil {
+		return "", fmt.Errorf("cannot create dump directory: %w", err)
+	}
+
+	name := unsafeFileChars.ReplaceAllString(task.TopicName, "_") + "-" + unsafeFileChars.ReplaceAllString(task.ID, "_") + ".json"
+	path := filepath.Join(d.Dir, name)
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("cannot write task dump: %w", err)
+	}
+
+	return path, nil
+}
+
+// redact returns a copy of the task with the values of the redacted variables replaced
+func (d *FailureDump) redact(task *camunda.ResLockedExternalTask) *camunda.ResLockedExternalTask {
+	res := *task
+	if task.TaskBase != nil {
+		base := *task.TaskBase
+		res.TaskBase = &base
+	}
+
+	res.Variables = redact.Variables(task.Variables, d.RedactVariables)
+
+	return &res
+}
+
+// LoadTaskDump loads a task dumped by the worker
+func LoadTaskDump(path string) (*TaskDump, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read task dump: %w", err)
+	}
+
+	var dump TaskDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("cannot parse task dump %s: %w", path, err)
+	}
+
+	if dump.Task == nil || dump.Task.TaskBase == nil {
+		return nil, fmt.Errorf("task dump %s has no task", path)
+	}
+
+	return &dump, nil
+}
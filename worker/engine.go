@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/interticketinc/camunda"
+)
+
+// defaultEngine name of the engine of a worker created by New
+const defaultEngine = "default"
+
+// Engine a Camunda engine served by the worker
+type Engine struct {
+	// Name identifies the engine in the logs and the status (default: `engine-{index}`)
+	Name   string
+	Client *camunda.Client
+}
+
+// engine an engine with the state of its fetch loops
+type engine struct {
+	// index the index of the engine in the slots of the handlers
+	index  int
+	name   string
+	client *camunda.Client
+	// sharedPuller the state of the fetch loop in SharedFetch mode
+	sharedPuller *pullerState
+	stats        engineStats
+}
+
+// engineStats counters of an engine, updated atomically
+type engineStats struct {
+	fetches     int64
+	fetchErrors int64
+	received    int64
+	unlocked    int64
+	completed   int64
+	failed      int64
+	bpmnErrors  int64
+}
+
+// outcome counts the result of a handled task
+func (s *engineStats) outcome(o Outcome) {
+	switch o {
+	case OutcomeCompleted:
+		atomic.AddInt64(&s.completed, 1)
+	case OutcomeFailed:
+		atomic.AddInt64(&s.failed, 1)
+	case OutcomeBPMNError:
+		atomic.AddInt64(&s.bpmnErrors, 1)
+	}
+}
+
+// EngineStatus a status of an engine served by the worker
+type EngineStatus struct {
+	Name string `json:"name"`
+	// Fetches number of FetchAndLock requests
+	Fetches int64 `json:"fetches"`
+	// FetchErrors number of failed FetchAndLock requests
+	FetchErrors int64 `json:"fetchErrors"`
+	// TasksReceived number of fetched tasks
+	TasksReceived int64 `json:"tasksReceived"`
+	// TasksUnlocked number of fetched tasks given back to the engine
+	TasksUnlocked int64 `json:"tasksUnlocked"`
+	Completed     int64 `json:"completed"`
+	Failed        int64 `json:"failed"`
+	BPMNErrors    int64 `json:"bpmnErrors"`
+	// InFlight number of tasks of the engine being handled
+	InFlight int `json:"inFlight"`
+}
+
+// status returns the counters of the engine
+func (e *engine) status() EngineStatus {
+	return EngineStatus{
+		Name:          e.name,
+		Fetches:       atomic.LoadInt64(&e.stats.fetches),
+		FetchErrors:   atomic.LoadInt64(&e.stats.fetchErrors),
+		TasksReceived: atomic.LoadInt64(&e.stats.received),
+		TasksUnlocked: atomic.LoadInt64(&e.stats.unlocked),
+		Completed:     atomic.LoadInt64(&e.stats.completed),
+		Failed:        atomic.LoadInt64(&e.stats.failed),
+		BPMNErrors:    atomic.LoadInt64(&e.stats.bpmnErrors),
+	}
+}
+
+// newEngines names the engines
+func newEngines(engines []Engine) []*engine {
+	res := make([]*engine, 0, len(engines))
+	for i, e := range engines {
+		name := e.Name
+		if name == "" {
+			name = fmt.Sprintf("engine-%d", i)
+		}
+
+		res = append(res, &engine{
+			index:        i,
+			name:         name,
+			client:       e.Client,
+			sharedPuller: &pullerState{},
+		})
+	}
+
+	return res
+}
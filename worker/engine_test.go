@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestWorker_multipleEngines(t *testing.T) {
+	east := fakeengine.New()
+	defer east.Close()
+
+	west := fakeengine.New()
+	defer west.Close()
+
+	w := NewWithEngines([]Engine{
+		{Name: "east", Client: east.Client()},
+		{Name: "west", Client: west.Client()},
+	}, &Options{
+		LockDuration:              time.Minute,
+		LongPollingTimeout:        200 * time.Millisecond,
+		MaxParallelTaskPerHandler: 4,
+	})
+	defer w.Stop()
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[string]bool)
+	)
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		mu.Lock()
+		handled[taskOf(ctx).BusinessKey] = true
+		mu.Unlock()
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	for i := 0; i < 5; i++ {
+		east.AddExternalTask(fakeengine.ExternalTask{TopicName: "ship", BusinessKey: fmt.Sprintf("east-%d", i)})
+		west.AddExternalTask(fakeengine.ExternalTask{TopicName: "ship", BusinessKey: fmt.Sprintf("west-%d", i)})
+	}
+
+	// a result reported to the other engine would fail, the task is unknown there
+	waitFor(t, "the tasks of both engines to be completed", func() bool {
+		return completed(east, "ship") == 5 && completed(west, "ship") == 5
+	})
+	waitFor(t, "the handlers to finish", func() bool {
+		return w.QueueDepth() == 0
+	})
+
+	mu.Lock()
+	if len(handled) != 10 {
+		t.Errorf("expected 10 handled tasks, got %v", handled)
+	}
+	mu.Unlock()
+
+	for i, name := range []string{"east", "west"} {
+		st := w.Status().Engines[i]
+		if st.Name != name || st.TasksReceived != 5 || st.Completed != 5 || st.Failed != 0 {
+			t.Errorf("unexpected stats of %s: %+v", name, st)
+		}
+	}
+}
+
+func TestWorker_multipleEngines_oneEngineWithTasks(t *testing.T) {
+	const longPolling = 2 * time.Second
+
+	east := fakeengine.New()
+	defer east.Close()
+
+	west := fakeengine.New()
+	defer west.Close()
+
+	westClient, westFetches := recordedClient(west)
+	w := NewWithEngines([]Engine{
+		{Name: "west", Client: westClient},
+		{Name: "east", Client: east.Client()},
+	}, &Options{
+		LockDuration:              time.Minute,
+		LongPollingTimeout:        longPolling,
+		MaxParallelTaskPerHandler: 4,
+	})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	// west has no task, its long polling request must not hold the slots needed by east
+	waitFor(t, "west to long poll", func() bool {
+		return len(westFetches.fetches()) > 0
+	})
+
+	started := time.Now()
+	addTasks(east, "ship", 10)
+	waitFor(t, "the tasks of east to be completed", func() bool {
+		return completed(east, "ship") == 10
+	})
+
+	if elapsed := time.Since(started); elapsed >= longPolling/2 {
+		t.Errorf("east waited %s for the long polling request of west", elapsed)
+	}
+
+	if n := westFetches.fetches()[0].MaxTasks; n != 2 {
+		t.Errorf("expected west to reserve its share of 2 slots, got %d", n)
+	}
+}
+
+func TestSlots_share(t *testing.T) {
+	s := newSlots(3, 2, func() {})
+
+	if n := s.tryAcquire(0, 0); n != 2 {
+		t.Errorf("expected 2 slots for the first engine, got %d", n)
+	}
+
+	if n := s.tryAcquire(1, 0); n != 1 {
+		t.Errorf("expected 1 slot for the second engine, got %d", n)
+	}
+
+	s.release(0, 2)
+	if n := s.tryAcquire(0, 1); n != 1 {
+		t.Errorf("expected MaxTasks to limit the reservation, got %d", n)
+	}
+
+	// every engine gets a slot, even if the capacity is lower than the number of engines
+	s = newSlots(1, 2, func() {})
+	if a, b := s.tryAcquire(0, 0), s.tryAcquire(1, 0); a != 1 || b != 1 {
+		t.Errorf("expected a slot per engine, got %d and %d", a, b)
+	}
+}
@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Results of an executable handler
+const (
+	ExecResultComplete  = "complete"
+	ExecResultFailure   = "failure"
+	ExecResultBPMNError = "bpmnError"
+)
+
+// ExecOptions options for ExecHandler
+type ExecOptions struct {
+	// Path of the executable
+	Path string
+	// Args arguments of the executable
+	Args []string
+	// Env additional environment variables in the form "key=value"
+	Env []string
+	// Dir working directory of the executable (default: the working directory of the worker)
+	Dir string
+	// Timeout kills the executable after the timeout (default: the deadline of the handler context)
+	Timeout time.Duration
+}
+
+// ExecTask the task passed as JSON on the standard input of the executable
+type ExecTask struct {
+	ID                   string            `json:"id"`
+	TopicName            string            `json:"topicName"`
+	BusinessKey          string            `json:"businessKey"`
+	ActivityID           string            `json:"activityId"`
+	ProcessInstanceID    string            `json:"processInstanceId"`
+	ProcessDefinitionKey string            `json:"processDefinitionKey"`
+	Retries              int               `json:"retries"`
+	Variables            camunda.Variables `json:"variables"`
+}
+
+// ExecResult the result read as JSON from the standard output of the executable.
+// An empty output completes the task without variables
+type ExecResult struct {
+	// Result one of complete, failure or bpmnError (default: complete)
+	Result string `json:"result"`
+	// Variables completing the task or passed with the BPMN error
+	Variables camunda.Variables `json:"variables,omitempty"`
+	// LocalVariables completing the task
+	LocalVariables camunda.Variables `json:"localVariables,omitempty"`
+	// ErrorCode code of the BPMN error
+	ErrorCode string `json:"errorCode,omitempty"`
+	// ErrorMessage message of the failure or the BPMN error
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// ErrorDetails details of the failure
+	ErrorDetails string `json:"errorDetails,omitempty"`
+}
+
+// ExecError a failure of an executable
+type ExecError struct {
+	// Message describes the failure
+	Message string
+	// ExitCode exit code of the executable, -1 if it was killed
+	ExitCode int
+	// Details the standard error output of the executable or the details reported by it
+	Details string
+}
+
+// Error error message
+func (e *ExecError) Error() string {
+	return e.Message
+}
+
+// ErrorDetails the details reported with the failure
+func (e *ExecError) ErrorDetails() string {
+	return e.Details
+}
+
+// ExecHandler returns a handler running the executable for each task, e.g. a Python or shell script.
+// The task is passed as ExecTask JSON on the standard input, the result is read as ExecResult JSON
+// from the standard output. A non-zero exit code fails the task with the standard error as failure details
+func ExecHandler(opts ExecOptions) Handler {
+	return func(ctx Context) error {
+		input, err := json.Marshal(execTask(ctx))
+		if err != nil {
+			return fmt.Errorf("cannot marshal task: %w", err)
+		}
+
+		runCtx := ctx.Ctx()
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			runCtx, cancel = context.WithTimeout(runCtx, opts.Timeout)
+			defer cancel()
+		}
+
+		// The outputs are written to files, so a killed executable is not waited for
+		// until its child processes close the output pipes
+		stdout, err := ioutil.TempFile("", "camunda-exec-stdout-*")
+		if err != nil {
+			return fmt.Errorf("cannot create output file: %w", err)
+		}
+		defer closeAndRemove(stdout)
+
+		stderr, err := ioutil.TempFile("", "camunda-exec-stderr-*")
+		if err != nil {
+			return fmt.Errorf("cannot create output file: %w", err)
+		}
+		defer closeAndRemove(stderr)
+
+		cmd := exec.CommandContext(runCtx, opts.Path, opts.Args...)
+		cmd.Dir = opts.Dir
+		cmd.Env = append(os.Environ(), opts.Env...)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		err = cmd.Run()
+
+		if runCtx.Err() != nil {
+			return &ExecError{
+				Message:  fmt.Sprintf("%s: killed: %s", opts.Path, runCtx.Err()),
+				ExitCode: -1,
+				Details:  readOutput(stderr),
+			}
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &ExecError{
+				Message:  fmt.Sprintf("%s: exited with code %d", opts.Path, exitErr.ExitCode()),
+				ExitCode: exitErr.ExitCode(),
+				Details:  readOutput(stderr),
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot run %s: %w", opts.Path, err)
+		}
+
+		return execOutcome(ctx, opts.Path, []byte(readOutput(stdout)))
+	}
+}
+
+// readOutput reads the output written to the file
+func readOutput(f *os.File) string {
+	bb, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Sprintf("cannot read output: %s", err)
+	}
+
+	return string(bb)
+}
+
+func closeAndRemove(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// execTask builds the input of the executable
+func execTask(ctx Context) *ExecTask {
+	in := &ExecTask{
+		ID:        ctx.TaskID(),
+		TopicName: ctx.TopicName(),
+		Retries:   ctx.Retries(),
+		Variables: ctx.Variables(),
+	}
+
+	if task := taskOf(ctx); task != nil {
+		in.BusinessKey = task.BusinessKey
+		in.ActivityID = task.ActivityID
+		in.ProcessInstanceID = task.ProcessInstanceID
+		in.ProcessDefinitionKey = task.ProcessDefinitionKey
+	}
+
+	return in
+}
+
+// execOutcome reports the result written by the executable
+func execOutcome(ctx Context, path string, output []byte) error {
+	res := &ExecResult{}
+	if len(bytes.TrimSpace(output)) > 0 {
+		if err := json.Unmarshal(output, res); err != nil {
+			return &ExecError{
+				Message: fmt.Sprintf("%s: invalid result: %s", path, err),
+				Details: string(output),
+			}
+		}
+	}
+
+	switch strings.TrimSpace(res.Result) {
+	case "", ExecResultComplete:
+		return ctx.Complete(&TaskComplete{
+			Variables:      res.Variables,
+			LocalVariables: res.LocalVariables,
+		})
+	case ExecResultBPMNError:
+		return NewBPMNError(res.ErrorCode, res.ErrorMessage, res.Variables)
+	case ExecResultFailure:
+		return &ExecError{
+			Message: res.ErrorMessage,
+			Details: res.ErrorDetails,
+		}
+	}
+
+	return &ExecError{
+		Message: fmt.Sprintf("%s: unknown result %q", path, res.Result),
+		Details: string(output),
+	}
+}
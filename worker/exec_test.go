@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// runScript runs the shell script as exec handler of a task
+func runScript(t *testing.T, script string, timeout time.Duration) (*completeRecorder, error) {
+	t.Helper()
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+
+	task := &camunda.ResLockedExternalTask{
+		TaskBase:    &camunda.TaskBase{ID: "task-1", TopicName: "ship"},
+		BusinessKey: "order-1",
+	}
+	ctx := &completeRecorder{ContextImpl: NewContext(nil, task, "worker")}
+
+	return ctx, ExecHandler(ExecOptions{Path: sh, Args: []string{"-c", script}, Timeout: timeout})(ctx)
+}
+
+func TestExecHandler_complete(t *testing.T) {
+	ctx, err := runScript(t, `printf '{"variables":{"input":{"type":"Object","value":%s}}}' "$(cat)"`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctx.completed == nil {
+		t.Fatal("expected the task to be completed")
+	}
+
+	input, ok := ctx.completed.Variables["input"].Value.(map[string]interface{})
+	if !ok || input["id"] != "task-1" || input["businessKey"] != "order-1" {
+		t.Errorf("unexpected task passed to the executable: %v", ctx.completed.Variables["input"])
+	}
+}
+
+func TestExecHandler_exitCode(t *testing.T) {
+	_, err := runScript(t, `echo "disk full" >&2; exit 3`, 0)
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected an exec error, got %v", err)
+	}
+
+	if execErr.ExitCode != 3 || execErr.ErrorDetails() != "disk full\n" {
+		t.Errorf("unexpected error %+v", execErr)
+	}
+}
+
+// failureRecorder a context recording the reported failure
+type failureRecorder struct {
+	*ContextImpl
+	failure *TaskFailureRequest
+}
+
+func (c *failureRecorder) HandleFailure(query TaskFailureRequest) error {
+	c.failure = &query
+	return nil
+}
+
+func TestExecHandler_exitCodeReported(t *testing.T) {
+	_, err := runScript(t, `echo "disk full" >&2; exit 3`, 0)
+
+	task := &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task-1"}}
+	ctx := &failureRecorder{ContextImpl: NewContext(nil, task, "worker")}
+	New(nil, &Options{}).report(ctx, err, nil)
+
+	if ctx.failure == nil || ctx.failure.ErrorDetails != "disk full\n" {
+		t.Errorf("expected a failure with the standard error as details, got %+v", ctx.failure)
+	}
+}
+
+func TestExecHandler_bpmnError(t *testing.T) {
+	_, err := runScript(t, `echo '{"result":"bpmnError","errorCode":"OUT_OF_STOCK","errorMessage":"no stock"}'`, 0)
+
+	var bpmnErr *BPMNError
+	if !errors.As(err, &bpmnErr) || bpmnErr.Code != "OUT_OF_STOCK" {
+		t.Errorf("expected a BPMN error, got %v", err)
+	}
+}
+
+func TestExecHandler_failure(t *testing.T) {
+	_, err := runScript(t, `echo '{"result":"failure","errorMessage":"rejected","errorDetails":"address unknown"}'`, 0)
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.Message != "rejected" || execErr.Details != "address unknown" {
+		t.Errorf("expected the reported failure, got %v", err)
+	}
+}
+
+func TestExecHandler_timeout(t *testing.T) {
+	started := time.Now()
+	_, err := runScript(t, `echo "waiting" >&2; sleep 10`, 100*time.Millisecond)
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the executable to be killed, ran %s", elapsed)
+	}
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) || execErr.ExitCode != -1 || execErr.Details != "waiting\n" {
+		t.Errorf("expected a killed exec error, got %+v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// maxRecentFailures number of failures kept per handler for the status page
+const maxRecentFailures = 20
+
+// pullerState a state of a fetch loop reported by the health endpoints
+type pullerState struct {
+	mu sync.Mutex
+	// fetching a FetchAndLock request is in progress since fetchStarted
+	fetching     bool
+	fetchStarted time.Time
+	// lastFetch time of the last successful FetchAndLock request
+	lastFetch time.Time
+	lastError string
+	// backoff current delay after a failed request
+	backoff time.Duration
+	// idle the puller waits for free handler slots
+	idle bool
+}
+
+func (s *pullerState) setIdle(idle bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idle = idle
+}
+
+func (s *pullerState) fetchStart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetching = true
+	s.fetchStarted = time.Now()
+}
+
+func (s *pullerState) fetchDone(err error, backoff time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetching = false
+	s.backoff = backoff
+
+	if err != nil {
+		s.lastError = err.Error()
+		return
+	}
+
+	s.lastFetch = time.Now()
+	s.lastError = ""
+}
+
+// ready checks whether the puller fetched successfully within threshold
+func (s *pullerState) ready(threshold time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.backoff > 0:
+		return fmt.Errorf("backing off for %s after fetch error: %s", s.backoff, s.lastError)
+	case s.idle:
+		return nil
+	case s.fetching && time.Since(s.fetchStarted) <= threshold:
+		return nil
+	case !s.lastFetch.IsZero() && time.Since(s.lastFetch) <= threshold:
+		return nil
+	}
+
+	return fmt.Errorf("no successful fetch within %s", threshold)
+}
+
+// inFlightTask a task being handled
+type inFlightTask struct {
+	task           *camunda.ResLockedExternalTask
+	engine         *engine
+	lockExpiration time.Time
+}
+
+// track registers a task of the engine being handled
+func (r *route) track(t fetchedTask) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.inFlight[t.task.ID] = inFlightTask{
+		task:           t.task,
+		engine:         t.engine,
+		lockExpiration: t.lockExpiration,
+	}
+}
+
+// untrack removes a finished task
+func (r *route) untrack(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.inFlight, id)
+}
+
+// recordFailure keeps the failure for the status page
+func (r *route) recordFailure(ctx Context, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = append(r.failures, FailureStatus{
+		TaskID:  ctx.TaskID(),
+		Topic:   ctx.TopicName(),
+		Message: message,
+		Time:    time.Now(),
+	})
+
+	if len(r.failures) > maxRecentFailures {
+		r.failures = r.failures[len(r.failures)-maxRecentFailures:]
+	}
+}
+
+// lockExpiration returns the expiration of the lock of a task fetched by a request started at fetched,
+// from the lock duration of its topic. The engine locks the task after the request started, so the expiration
+// on the local clock is never later than the actual one. The LockExpirationTime of the task is not used,
+// it is the time of the engine clock. Returns zero if the lock duration of the topic is unknown
+func (r *route) lockExpiration(task *camunda.ResLockedExternalTask, fetched time.Time) time.Time {
+	for _, t := range r.topics {
+		if t.TopicName == task.TopicName && t.LockDuration > 0 {
+			return fetched.Add(time.Duration(t.LockDuration) * time.Millisecond)
+		}
+	}
+
+	return time.Time{}
+}
+
+// Status a status of the worker
+type Status struct {
+	WorkerID   string          `json:"workerId"`
+	QueueDepth int             `json:"queueDepth"`
+	Engines    []EngineStatus  `json:"engines"`
+	Handlers   []HandlerStatus `json:"handlers"`
+}
+
+// HandlerStatus a status of a handler
+type HandlerStatus struct {
+	// Topics the handler is registered for
+	Topics []string `json:"topics"`
+	// Paused topics of the handler which are not fetched
+	Paused []string `json:"paused"`
+	// Concurrency maximum number of tasks handled in parallel
+	Concurrency int `json:"concurrency"`
+	// InFlight tasks being handled
+	InFlight []TaskStatus `json:"inFlight"`
+	// RecentFailures the last failures reported to the engine
+	RecentFailures []FailureStatus `json:"recentFailures"`
+	// Pullers the fetch loops of the handler, one per engine
+	Pullers []PullerStatus `json:"pullers"`
+}
+
+// PullerStatus a status of a fetch loop
+type PullerStatus struct {
+	// Engine the engine the tasks are fetched from
+	Engine string `json:"engine"`
+	// LastFetch time of the last successful FetchAndLock request
+	LastFetch time.Time `json:"lastFetch"`
+	// LastError error of the last failed FetchAndLock request
+	LastError string `json:"lastError,omitempty"`
+	// Backoff current delay of the puller after a failed request
+	Backoff string `json:"backoff"`
+}
+
+// TaskStatus a task being handled
+type TaskStatus struct {
+	ID          string `json:"id"`
+	Engine      string `json:"engine"`
+	Topic       string `json:"topic"`
+	BusinessKey string `json:"businessKey,omitempty"`
+	// LockExpiration the expiration of the lock estimated on the local clock, zero if unknown
+	LockExpiration time.Time `json:"lockExpiration"`
+}
+
+// FailureStatus a failure reported to the engine
+type FailureStatus struct {
+	TaskID  string    `json:"taskId"`
+	Topic   string    `json:"topic"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// status returns the status of the handler
+func (r *route) status(engines []*engine) HandlerStatus {
+	hs := HandlerStatus{
+		Concurrency:    r.slots.limit(),
+		InFlight:       []TaskStatus{},
+		RecentFailures: []FailureStatus{},
+	}
+
+	for _, t := range r.topics {
+		hs.Topics = append(hs.Topics, t.TopicName)
+	}
+
+	r.mu.Lock()
+	for _, t := range r.inFlight {
+		hs.InFlight = append(hs.InFlight, TaskStatus{
+			ID:             t.task.ID,
+			Engine:         t.engine.name,
+			Topic:          t.task.TopicName,
+			BusinessKey:    t.task.BusinessKey,
+			LockExpiration: t.lockExpiration,
+		})
+	}
+	hs.RecentFailures = append(hs.RecentFailures, r.failures...)
+	r.mu.Unlock()
+
+	sort.Slice(hs.InFlight, func(i, j int) bool {
+		return hs.InFlight[i].LockExpiration.Before(hs.InFlight[j].LockExpiration)
+	})
+
+	for i, puller := range r.pullers {
+		puller.mu.Lock()
+		hs.Pullers = append(hs.Pullers, PullerStatus{
+			Engine:    engines[i].name,
+			LastFetch: puller.lastFetch,
+			LastError: puller.lastError,
+			Backoff:   puller.backoff.String(),
+		})
+		puller.mu.Unlock()
+	}
+
+	return hs
+}
+
+// Status returns the status of the worker, its engines and its handlers
+func (p *Worker) Status() Status {
+	s := Status{
+		WorkerID: p.options.WorkerID,
+		Engines:  make([]EngineStatus, len(p.engines)),
+		Handlers: []HandlerStatus{},
+	}
+
+	index := make(map[string]int, len(p.engines))
+	for i, e := range p.engines {
+		s.Engines[i] = e.status()
+		index[e.name] = i
+	}
+
+	for _, r := range p.snapshotRoutes() {
+		hs := r.status(p.engines)
+		for _, t := range hs.InFlight {
+			s.Engines[index[t.Engine]].InFlight++
+		}
+
+		hs.Paused = []string{}
+		for _, t := range hs.Topics {
+			if p.isPaused(t) {
+				hs.Paused = append(hs.Paused, t)
+			}
+		}
+
+		s.QueueDepth += len(hs.InFlight)
+		s.Handlers = append(s.Handlers, hs)
+	}
+
+	return s
+}
+
+// Ready checks whether at least one engine is ready: it is reachable and all of its pullers
+// fetched successfully within threshold. So an outage of one engine does not stop the others being served
+func (p *Worker) Ready(threshold time.Duration) error {
+	if len(p.engines) == 0 {
+		return errors.New("no engine configured")
+	}
+
+	routes := p.snapshotRoutes()
+
+	var errs []string
+	for i, e := range p.engines {
+		err := p.engineReady(i, routes, threshold)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Sprintf("engine %s: %s", e.name, err))
+	}
+
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// engineReady checks the engine of index i
+func (p *Worker) engineReady(i int, routes []*route, threshold time.Duration) error {
+	if _, err := p.engines[i].client.Version(); err != nil {
+		return fmt.Errorf("engine is not reachable: %w", err)
+	}
+
+	for _, r := range routes {
+		if err := r.pullers[i].ready(threshold); err != nil {
+			return fmt.Errorf("handler of topics %v: %w", topicNames(r.topics), err)
+		}
+	}
+
+	return nil
+}
+
+// alive checks whether the worker is not stopped and its fetch loops are running
+func (p *Worker) alive() error {
+	if p.isStopped() {
+		return errors.New("worker is stopped")
+	}
+
+	if len(p.snapshotRoutes()) > 0 && atomic.LoadInt32(&p.loopsRunning) == 0 {
+		return errors.New("no fetch loop is running")
+	}
+
+	return nil
+}
+
+// HealthOptions options for HealthHandler
+type HealthOptions struct {
+	// FetchThreshold maximum age of the last successful fetch for readiness
+	// (default: LongPollingTimeout + 30 seconds)
+	FetchThreshold time.Duration
+}
+
+// HealthHandler returns an HTTP handler serving the liveness (/healthz), readiness (/readyz)
+// and the JSON status (/status) of the worker. The liveness fails after Stop or if no fetch loop is running
+func (p *Worker) HealthHandler(opts HealthOptions) http.Handler {
+	threshold := opts.FetchThreshold
+	if threshold <= 0 {
+		threshold = p.options.LongPollingTimeout + 30*time.Second
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.alive(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Ready(threshold); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.Status()); err != nil {
+			p.log.Error().Err(err).Msg("failed to write status")
+		}
+	})
+
+	return mux
+}
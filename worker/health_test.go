@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// waitFor waits until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// get requests the path of the handler
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return rec
+}
+
+func TestHealthHandler(t *testing.T) {
+	up := fakeengine.New()
+	defer up.Close()
+
+	down := fakeengine.New()
+	down.Close()
+
+	w := NewWithEngines([]Engine{
+		{Name: "up", Client: up.Client()},
+		{Name: "down", Client: down.Client()},
+	}, &Options{LockDuration: time.Minute})
+
+	// a handler whose fetch loops are not started, their state is set by the test
+	r := newRoute([]*camunda.TopicLockConfig{{TopicName: "ship"}}, nil, HandlerOptions{},
+		newSlots(2, 2, func() {}), []*pullerState{{}, {}})
+	w.routes = append(w.routes, r)
+
+	r.pullers[0].fetchDone(nil, 0)
+	r.pullers[1].fetchDone(errors.New("connection refused"), time.Second)
+
+	h := w.HealthHandler(HealthOptions{FetchThreshold: time.Minute})
+
+	// one engine is ready, the outage of the other does not make the worker unready
+	if rec := get(h, "/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("readyz: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	r.pullers[0].fetchDone(errors.New("timeout"), time.Second)
+	if rec := get(h, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz: expected 503 with both engines down, got %d", rec.Code)
+	}
+
+	task := &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task-1", TopicName: "ship"}}
+	r.track(fetchedTask{engine: w.engines[0], task: task})
+	r.recordFailure(NewContext(nil, task, "worker"), "out of stock")
+	w.engines[0].stats.outcome(OutcomeCompleted)
+
+	var status Status
+	if err := json.Unmarshal(get(h, "/status").Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.Engines) != 2 || status.Engines[0].Completed != 1 || status.Engines[0].InFlight != 1 ||
+		status.Engines[1].Name != "down" {
+		t.Errorf("unexpected engines %+v", status.Engines)
+	}
+
+	if len(status.Handlers) != 1 || status.Handlers[0].Topics[0] != "ship" || len(status.Handlers[0].Pullers) != 2 ||
+		status.Handlers[0].Pullers[1].LastError != "connection refused" {
+		t.Errorf("unexpected handlers %+v", status.Handlers)
+	}
+
+	if failures := status.Handlers[0].RecentFailures; len(failures) != 1 || failures[0].Message != "out of stock" {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+}
+
+func TestHealthHandler_healthz(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error { return nil })
+
+	h := w.HealthHandler(HealthOptions{})
+	if rec := get(h, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("healthz: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	w.Stop()
+	if rec := get(h, "/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("healthz: expected 503 after Stop, got %d", rec.Code)
+	}
+}
+
+func TestWorker_recentFailures(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	// the failures reported by the handler itself are recorded like the returned errors
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		return ctx.HandleFailure(TaskFailureRequest{ErrorMessage: "out of stock"})
+	})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "bill"}}, func(ctx Context) error {
+		return errors.New("card declined")
+	})
+
+	addTasks(engine, "ship", 1)
+	addTasks(engine, "bill", 1)
+
+	waitFor(t, "the failures to be recorded", func() bool {
+		st := w.Status()
+		return len(st.Handlers[0].RecentFailures) == 1 && len(st.Handlers[1].RecentFailures) == 1
+	})
+
+	st := w.Status()
+	if msg := st.Handlers[0].RecentFailures[0].Message; msg != "out of stock" {
+		t.Errorf("unexpected failure %s", msg)
+	}
+
+	if msg := st.Handlers[1].RecentFailures[0].Message; msg != "task error: card declined" {
+		t.Errorf("unexpected failure %s", msg)
+	}
+}
+
+func TestHealthHandler_notReady(t *testing.T) {
+	down := fakeengine.New()
+	down.Close()
+
+	w := New(down.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error { return nil })
+
+	if rec := get(w.HealthHandler(HealthOptions{}), "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz: expected 503, got %d", rec.Code)
+	}
+}
+
+func TestWorker_engineReady_noTopics(t *testing.T) {
+	up := fakeengine.New()
+	defer up.Close()
+
+	w := New(up.Client(), &Options{})
+	r := newRoute(nil, nil, HandlerOptions{}, newSlots(1, 1, func() {}), []*pullerState{{}})
+
+	if err := w.engineReady(0, []*route{r}, time.Second); err == nil {
+		t.Error("expected a route which never fetched not to be ready")
+	}
+}
@@ -0,0 +1,506 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// maxResponseBody maximum size of a response body read by the HTTP connector
+const maxResponseBody = 10 << 20
+
+// Results of a status rule of the HTTP connector
+const (
+	HTTPResultComplete  = "complete"
+	HTTPResultFailure   = "failure"
+	HTTPResultBPMNError = "bpmnError"
+)
+
+// HTTPConnector a configuration of a handler calling an HTTP endpoint for each task.
+// Method, URL, Headers and Body are text/template templates executed with HTTPRequestData
+type HTTPConnector struct {
+	// Method HTTP method (default: GET, or POST if Body is set)
+	Method string
+	// URL the URL of the request, e.g. "http://orders/api/orders/{{.Variables.orderId}}".
+	// The values interpolated in the URL are escaped: path escaped before the ?, query escaped after it.
+	// An action ending with pathEscape, urlquery or raw is left as is, raw inserts the value unescaped
+	URL string
+	// Headers headers of the request
+	Headers map[string]string
+	// Body JSON body of the request, e.g. `{"amount": {{json .Variables.amount}}}`
+	Body string
+	// Timeout of the request (default: the deadline of the handler context)
+	Timeout time.Duration
+	// Client sends the requests (default: http.DefaultClient)
+	Client *http.Client
+	// Rules map the response status to the result of the task. The first matching rule is used,
+	// without matching rule a 2xx status completes the task and other statuses fail it
+	Rules []StatusRule
+	// Outputs maps output variable names to JSONPath-style expressions selecting a value
+	// of the JSON response, e.g. "$.data.id" or "$.items[0].name"
+	Outputs map[string]string
+}
+
+// StatusRule maps response statuses to the result of the task
+type StatusRule struct {
+	// Status matching statuses: an exact status ("404"), a class ("5xx") or a range ("400-499")
+	Status string
+	// Result one of HTTPResultComplete, HTTPResultFailure or HTTPResultBPMNError
+	Result string
+	// ErrorCode code of the BPMN error
+	ErrorCode string
+	// ErrorMessage message of the BPMN error or the failure (default: the response status)
+	ErrorMessage string
+}
+
+// HTTPRequestData the data of the request templates
+type HTTPRequestData struct {
+	TaskID      string
+	TopicName   string
+	BusinessKey string
+	// Variables the values of the task variables
+	Variables map[string]interface{}
+}
+
+// HTTPError a failure of an HTTP call
+type HTTPError struct {
+	// Message describes the failure
+	Message string
+	// StatusCode status of the response, 0 if no response was received
+	StatusCode int
+	// Body body of the response
+	Body string
+}
+
+// Error error message
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// ErrorDetails the response body reported with the failure
+func (e *HTTPError) ErrorDetails() string {
+	return e.Body
+}
+
+// HTTPHandler returns a handler calling the configured HTTP endpoint for each task.
+// The templates, status rules and output expressions are validated upfront
+func HTTPHandler(c HTTPConnector) (Handler, error) {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			bb, err := json.Marshal(v)
+			return string(bb), err
+		},
+		"pathEscape": func(v interface{}) string {
+			return url.PathEscape(fmt.Sprint(v))
+		},
+		"raw": func(v interface{}) string {
+			return fmt.Sprint(v)
+		},
+	}
+
+	parse := func(name, text string) (*template.Template, error) {
+		t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name, err)
+		}
+
+		return t, nil
+	}
+
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+		if c.Body != "" {
+			method = http.MethodPost
+		}
+	}
+
+	urlTmpl, err := parse("url", c.URL)
+	if err != nil {
+		return nil, err
+	}
+	escapeURL(urlTmpl)
+
+	bodyTmpl, err := parse("body", c.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headerTmpls := make(map[string]*template.Template, len(c.Headers))
+	for k, v := range c.Headers {
+		if headerTmpls[k], err = parse("header "+k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range c.Rules {
+		if _, _, err := statusRange(r.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	outputs := make(map[string][]pathSegment, len(c.Outputs))
+	for name, expr := range c.Outputs {
+		if outputs[name], err = parsePath(expr); err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx Context) error {
+		data := httpRequestData(ctx)
+
+		u, err := execTemplate(urlTmpl, data)
+		if err != nil {
+			return err
+		}
+
+		body, err := execTemplate(bodyTmpl, data)
+		if err != nil {
+			return err
+		}
+
+		reqCtx := ctx.Ctx()
+		if c.Timeout > 0 {
+			var cancel func()
+			reqCtx, cancel = context.WithTimeout(reqCtx, c.Timeout)
+			defer cancel()
+		}
+
+		var bodyReader io.Reader
+		if body != "" {
+			bodyReader = strings.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(reqCtx, method, u, bodyReader)
+		if err != nil {
+			return fmt.Errorf("cannot create request: %w", err)
+		}
+
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		for k, t := range headerTmpls {
+			v, err := execTemplate(t, data)
+			if err != nil {
+				return err
+			}
+
+			req.Header.Set(k, v)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return &HTTPError{Message: fmt.Sprintf("%s %s: %s", method, u, err)}
+		}
+		defer res.Body.Close()
+
+		resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+		if err != nil {
+			return &HTTPError{
+				Message:    fmt.Sprintf("%s %s: cannot read response: %s", method, u, err),
+				StatusCode: res.StatusCode,
+			}
+		}
+
+		return c.outcome(ctx, res, resBody, outputs)
+	}, nil
+}
+
+// outcome reports the result of the response
+func (c *HTTPConnector) outcome(ctx Context, res *http.Response, body []byte, outputs map[string][]pathSegment) error {
+	rule := StatusRule{Result: HTTPResultFailure}
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		rule.Result = HTTPResultComplete
+	}
+
+	for _, r := range c.Rules {
+		if lo, hi, _ := statusRange(r.Status); res.StatusCode >= lo && res.StatusCode <= hi {
+			rule = r
+			break
+		}
+	}
+
+	message := rule.ErrorMessage
+	if message == "" {
+		message = "response status " + res.Status
+	}
+
+	switch rule.Result {
+	case HTTPResultComplete:
+		vars, err := extractOutputs(body, outputs, true)
+		if err != nil {
+			return &HTTPError{Message: err.Error(), StatusCode: res.StatusCode, Body: string(body)}
+		}
+
+		return ctx.Complete(&TaskComplete{Variables: vars})
+	case HTTPResultBPMNError:
+		// The outputs found in the response are passed to the error handler
+		vars, _ := extractOutputs(body, outputs, false)
+		return NewBPMNError(rule.ErrorCode, message, vars)
+	}
+
+	return &HTTPError{
+		Message:    message,
+		StatusCode: res.StatusCode,
+		Body:       string(body),
+	}
+}
+
+// httpRequestData builds the template data of a task
+func httpRequestData(ctx Context) *HTTPRequestData {
+	data := &HTTPRequestData{
+		TaskID:    ctx.TaskID(),
+		TopicName: ctx.TopicName(),
+		Variables: ctx.Variables().Map(),
+	}
+
+	if task := taskOf(ctx); task != nil {
+		data.BusinessKey = task.BusinessKey
+	}
+
+	return data
+}
+
+// urlEscapers the functions ending an action of the URL template which is not escaped again
+var urlEscapers = map[string]bool{"pathEscape": true, "urlquery": true, "raw": true}
+
+// escapeURL appends pathEscape to the actions of the URL template before the ? and urlquery to the actions
+// after it, so an interpolated value cannot change the path or the query of the URL
+func escapeURL(t *template.Template) {
+	if t.Tree == nil {
+		return
+	}
+
+	inQuery := false
+	escapeURLNodes(t.Tree, t.Tree.Root, &inQuery)
+}
+
+func escapeURLNodes(tree *parse.Tree, list *parse.ListNode, inQuery *bool) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if bytes.ContainsRune(n.Text, '?') {
+				*inQuery = true
+			}
+		case *parse.ActionNode:
+			// Declarations like {{$id := .TaskID}} print nothing
+			if len(n.Pipe.Decl) > 0 {
+				continue
+			}
+
+			last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+			if id, ok := last.Args[0].(*parse.IdentifierNode); ok && urlEscapers[id.Ident] {
+				continue
+			}
+
+			escaper := "pathEscape"
+			if *inQuery {
+				escaper = "urlquery"
+			}
+
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(escaper).SetTree(tree).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeURLNodes(tree, n.List, inQuery)
+			escapeURLNodes(tree, n.ElseList, inQuery)
+		case *parse.RangeNode:
+			escapeURLNodes(tree, n.List, inQuery)
+			escapeURLNodes(tree, n.ElseList, inQuery)
+		case *parse.WithNode:
+			escapeURLNodes(tree, n.List, inQuery)
+			escapeURLNodes(tree, n.ElseList, inQuery)
+		}
+	}
+}
+
+func execTemplate(t *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("cannot execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// statusRange parses a status rule into an inclusive range of statuses
+func statusRange(status string) (int, int, error) {
+	status = strings.TrimSpace(status)
+
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		class, err := strconv.Atoi(status[:1])
+		if err == nil {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+
+	if parts := strings.SplitN(status, "-", 2); len(parts) == 2 {
+		lo, errLo := strconv.Atoi(strings.TrimSpace(parts[0]))
+		hi, errHi := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errLo == nil && errHi == nil && lo <= hi {
+			return lo, hi, nil
+		}
+	}
+
+	if code, err := strconv.Atoi(status); err == nil {
+		return code, code, nil
+	}
+
+	return 0, 0, fmt.Errorf("invalid status rule %q", status)
+}
+
+// pathSegment a segment of a JSONPath-style expression, either an object key or an array index
+type pathSegment struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// parsePath parses expressions like "$", "$.data.id", "$.items[0].name" or "$[1]"
+func parsePath(expr string) ([]pathSegment, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("invalid expression %q: must start with $", expr)
+	}
+
+	var segments []pathSegment
+
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			if end == 0 {
+				return nil, fmt.Errorf("invalid expression %q: empty key", expr)
+			}
+
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid expression %q: missing ]", expr)
+			}
+
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: invalid index: %w", expr, err)
+			}
+
+			segments = append(segments, pathSegment{index: idx, isIdx: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid expression %q", expr)
+		}
+	}
+
+	return segments, nil
+}
+
+// selectPath selects the value of the path in a decoded JSON value
+func selectPath(v interface{}, path []pathSegment) (interface{}, bool) {
+	for _, s := range path {
+		if s.isIdx {
+			arr, ok := v.([]interface{})
+			if !ok || s.index < 0 || s.index >= len(arr) {
+				return nil, false
+			}
+
+			v = arr[s.index]
+
+			continue
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if v, ok = obj[s.key]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// extractOutputs extracts the output variables from the JSON response.
+// Missing outputs are an error if strict, otherwise they are skipped
+func extractOutputs(body []byte, outputs map[string][]pathSegment, strict bool) (camunda.Variables, error) {
+	vars := camunda.Variables{}
+	if len(outputs) == 0 {
+		return vars, nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse response: %w", err)
+	}
+
+	for name, path := range outputs {
+		v, ok := selectPath(doc, path)
+		if !ok && !strict {
+			continue
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("output %s not found in response", name)
+		}
+
+		vars[name] = toVariable(v)
+	}
+
+	return vars, nil
+}
+
+// toVariable converts a decoded JSON value to a typed variable
+func toVariable(v interface{}) *camunda.Variable {
+	switch val := v.(type) {
+	case nil:
+		return &camunda.Variable{Type: "Null"}
+	case bool:
+		return &camunda.Variable{Value: val, Type: "Boolean"}
+	case string:
+		return &camunda.Variable{Value: val, Type: "String"}
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return &camunda.Variable{Value: int64(val), Type: "Long"}
+		}
+
+		return &camunda.Variable{Value: val, Type: "Double"}
+	}
+
+	bb, _ := json.Marshal(v)
+
+	return &camunda.Variable{Value: string(bb), Type: "Json"}
+}
@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interticketinc/camunda"
+)
+
+type completeRecorder struct {
+	*ContextImpl
+	completed *TaskComplete
+}
+
+func (c *completeRecorder) Complete(tc *TaskComplete) error {
+	c.completed = tc
+	return nil
+}
+
+func TestHTTPHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Business-Key") != "order-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req struct {
+			Amount int64 `json:"amount"`
+		}
+		_ = json.Unmarshal(body, &req)
+
+		switch r.URL.Path {
+		case "/payments/ok":
+			fmt.Fprintf(w, `{"data": {"id": "p-1", "amount": %d}, "items": [{"name": "first"}]}`, req.Amount)
+		case "/payments/declined":
+			w.WriteHeader(http.StatusPaymentRequired)
+			w.Write([]byte(`{"data": {"id": "p-2"}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`boom`))
+		}
+	}))
+	defer srv.Close()
+
+	handler, err := HTTPHandler(HTTPConnector{
+		URL: srv.URL + "/payments/{{.Variables.result}}",
+		Headers: map[string]string{
+			"X-Business-Key": "{{.BusinessKey}}",
+		},
+		Body: `{"amount":{{json .Variables.amount}}}`,
+		Rules: []StatusRule{
+			{Status: "402", Result: HTTPResultBPMNError, ErrorCode: "DECLINED"},
+		},
+		Outputs: map[string]string{
+			"paymentId": "$.data.id",
+			"item":      "$.items[0].name",
+			"amount":    "$.data.amount",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(result string) (*completeRecorder, error) {
+		task := &camunda.ResLockedExternalTask{
+			TaskBase:    &camunda.TaskBase{ID: "task-1"},
+			BusinessKey: "order-1",
+			Variables: camunda.Variables{
+				"result": {Value: result, Type: "String"},
+				"amount": {Value: 42, Type: "Long"},
+			},
+		}
+
+		ctx := &completeRecorder{ContextImpl: NewContext(nil, task, "worker")}
+
+		return ctx, handler(ctx)
+	}
+
+	ctx, err := run("ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ctx.completed == nil {
+		t.Fatal("task not completed")
+	}
+
+	vars := ctx.completed.Variables
+	if vars["paymentId"].Value != "p-1" || vars["item"].Value != "first" || vars["amount"].Value != int64(42) {
+		t.Errorf("unexpected variables: %v, %v, %v", vars["paymentId"], vars["item"], vars["amount"])
+	}
+
+	_, err = run("declined")
+
+	var bpmnErr *BPMNError
+	if !errors.As(err, &bpmnErr) || bpmnErr.Code != "DECLINED" || bpmnErr.Variables["paymentId"].Value != "p-2" {
+		t.Errorf("expected bpmn error DECLINED, got %v", err)
+	}
+
+	_, err = run("unknown")
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || httpErr.ErrorDetails() != "boom" {
+		t.Errorf("expected http error 500, got %v", err)
+	}
+}
+
+func TestHTTPHandler_escapeURL(t *testing.T) {
+	var requested string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.RequestURI()
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/orders/{{.Variables.orderId}}", "/orders/a%2Fb%3Fx=1"},
+		{"/orders?id={{.Variables.orderId}}&key={{.BusinessKey}}", "/orders?id=a%2Fb%3Fx%3D1&key=order+1%26admin%3Dtrue"},
+		{"/orders/{{if .Variables.orderId}}{{.Variables.orderId}}{{end}}", "/orders/a%2Fb%3Fx=1"},
+		{"/orders?key={{urlquery .BusinessKey}}", "/orders?key=order+1%26admin%3Dtrue"},
+		{"{{raw .Variables.path}}", "/orders/a/b"},
+	}
+
+	for _, test := range tests {
+		handler, err := HTTPHandler(HTTPConnector{URL: srv.URL + test.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task := &camunda.ResLockedExternalTask{
+			TaskBase:    &camunda.TaskBase{ID: "task-1"},
+			BusinessKey: "order 1&admin=true",
+			Variables: camunda.Variables{
+				"orderId": {Value: "a/b?x=1", Type: "String"},
+				"path":    {Value: "/orders/a/b", Type: "String"},
+			},
+		}
+
+		if err := handler(&completeRecorder{ContextImpl: NewContext(nil, task, "worker")}); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.url, err)
+		}
+
+		if requested != test.want {
+			t.Errorf("%s: requested %s, want %s", test.url, requested, test.want)
+		}
+	}
+}
+
+func TestHTTPHandler_InvalidConfig(t *testing.T) {
+	tests := []HTTPConnector{
+		{URL: "{{.Variables"},
+		{URL: "http://localhost", Rules: []StatusRule{{Status: "abc"}}},
+		{URL: "http://localhost", Outputs: map[string]string{"x": "data.id"}},
+		{URL: "http://localhost", Outputs: map[string]string{"x": "$.items[a]"}},
+	}
+
+	for _, c := range tests {
+		if _, err := HTTPHandler(c); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// IdempotencyRecord a recorded completion of a task
+type IdempotencyRecord struct {
+	// Key the idempotency key of the task
+	Key string `json:"key"`
+	// TaskID the id of the task completed first with the key
+	TaskID string `json:"taskId"`
+	// Variables sent with the completion
+	Variables camunda.Variables `json:"variables,omitempty"`
+	// LocalVariables sent with the completion
+	LocalVariables camunda.Variables `json:"localVariables,omitempty"`
+	// CompletedAt time of the completion
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// IdempotencyStore stores the completions of the tasks
+type IdempotencyStore interface {
+	// Get returns the record of the key, or nil if the key was not completed yet
+	Get(key string) (*IdempotencyRecord, error)
+	// Put stores the record
+	Put(record *IdempotencyRecord) error
+	// Delete removes the record of the key, deleting a missing key is not an error
+	Delete(key string) error
+}
+
+// KeyFunc returns the idempotency key of a task
+type KeyFunc func(task *camunda.ResLockedExternalTask) string
+
+// TaskIDKey uses the task id as idempotency key. It protects against running a handler twice
+// for the same task, e.g. when its lock expired or the completion failed
+func TaskIDKey(task *camunda.ResLockedExternalTask) string {
+	return task.ID
+}
+
+// BusinessKeyActivityKey uses the business key and the activity id as idempotency key.
+// It protects against running a handler twice for the same activity of a business process,
+// even if the engine created a new task for it. Instances without business key are keyed
+// by the process instance id, or by the task id if the task has no process instance
+func BusinessKeyActivityKey(task *camunda.ResLockedExternalTask) string {
+	switch {
+	case task.BusinessKey != "":
+		return task.BusinessKey + "/" + task.ActivityID
+	case task.ProcessInstanceID != "":
+		return "instance:" + task.ProcessInstanceID + "/" + task.ActivityID
+	}
+
+	return "task:" + task.ID
+}
+
+// Idempotency options for idempotent task execution.
+// When a task was already completed with the same key, the recorded completion is sent again
+// instead of running the handler. The completion is recorded before it is sent, and the record is
+// deleted if the engine rejects the completion, so the handler runs again for the next task of the key
+type Idempotency struct {
+	// Store stores the completions
+	Store IdempotencyStore
+	// Key returns the idempotency key of a task (default: TaskIDKey)
+	Key KeyFunc
+}
+
+// validate checks the options
+func (i *Idempotency) validate() error {
+	if i.Store == nil {
+		return errors.New("idempotency store is not set")
+	}
+
+	return nil
+}
+
+// wrap returns a handler running the handler only if the task was not completed before
+func (i *Idempotency) wrap(task *camunda.ResLockedExternalTask, handler Handler) Handler {
+	keyFunc := i.Key
+	if keyFunc == nil {
+		keyFunc = TaskIDKey
+	}
+
+	key := keyFunc(task)
+
+	return func(ctx Context) error {
+		record, err := i.Store.Get(key)
+		if err != nil {
+			return fmt.Errorf("cannot read idempotency store: %w", err)
+		}
+
+		if record != nil {
+			return forgetRejected(i.Store, key, ctx.Complete(&TaskComplete{
+				Variables:      record.Variables,
+				LocalVariables: record.LocalVariables,
+			}))
+		}
+
+		return handler(&idempotentContext{
+			Context: ctx,
+			store:   i.Store,
+			key:     key,
+		})
+	}
+}
+
+// forgetRejected deletes the record of the key if the engine rejected its completion, a record which cannot
+// be completed would be sent again forever. The record is kept if the completion may have been done,
+// e.g. the engine did not answer, or was not sent because the lock expired
+func forgetRejected(store IdempotencyStore, key string, err error) error {
+	var engineErr *camunda.Error
+	if !errors.As(err, &engineErr) {
+		return err
+	}
+
+	if delErr := store.Delete(key); delErr != nil {
+		return fmt.Errorf("%w, cannot delete the completion record: %s", err, delErr)
+	}
+
+	return err
+}
+
+// idempotentContext records the completion before sending it to the engine
+type idempotentContext struct {
+	Context
+
+	store IdempotencyStore
+	key   string
+}
+
+// lockedTask returns the task of the wrapped context
+func (c *idempotentContext) lockedTask() *camunda.ResLockedExternalTask {
+	return taskOf(c.Context)
+}
+
+// Complete records the completion and marks the external task complete.
+// The record is deleted if the engine rejects the completion
+func (c *idempotentContext) Complete(tc *TaskComplete) error {
+	err := c.store.Put(&IdempotencyRecord{
+		Key:            c.key,
+		TaskID:         c.TaskID(),
+		Variables:      tc.Variables,
+		LocalVariables: tc.LocalVariables,
+		CompletedAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot record completion: %w", err)
+	}
+
+	return forgetRejected(c.store, c.key, c.Context.Complete(tc))
+}
+
+// MemoryStore an in-memory IdempotencyStore. The records are lost when the process exits
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*IdempotencyRecord
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*IdempotencyRecord),
+	}
+}
+
+// Get returns the record of the key
+func (s *MemoryStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.records[key], nil
+}
+
+// Put stores the record
+func (s *MemoryStore) Put(record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Key] = record
+
+	return nil
+}
+
+// Delete removes the record of the key
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// FileStore an IdempotencyStore keeping every record in a JSON file of a local directory
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a new file store in the directory
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create store directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Get returns the record of the key
+func (s *FileStore) Get(key string) (*IdempotencyRecord, error) {
+	bb, err := ioutil.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read record: %w", err)
+	}
+
+	record := &IdempotencyRecord{}
+	if err := json.Unmarshal(bb, record); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal record: %w", err)
+	}
+
+	return record, nil
+}
+
+// Put stores the record. The file is replaced atomically, so a crash never leaves a partial record
+func (s *FileStore) Put(record *IdempotencyRecord) error {
+	bb, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot marshal record: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, ".record-*")
+	if err != nil {
+		return fmt.Errorf("cannot create record: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bb); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write record: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write record: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write record: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path(record.Key))
+}
+
+// Delete removes the record of the key
+func (s *FileStore) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot delete record: %w", err)
+	}
+
+	return nil
+}
+
+// path returns the file of the key. Keys are hashed, so they can contain any character
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/interticketinc/camunda"
+)
+
+func testStore(t *testing.T, store IdempotencyStore) {
+	t.Helper()
+
+	record, err := store.Get("order-1/ship")
+	if err != nil || record != nil {
+		t.Fatalf("expected no record, got %+v, %v", record, err)
+	}
+
+	want := &IdempotencyRecord{
+		Key:       "order-1/ship",
+		TaskID:    "task-1",
+		Variables: camunda.Variables{"tracking": {Value: "T-1", Type: "String"}},
+	}
+	if err := store.Put(want); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err = store.Get("order-1/ship")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record == nil || record.TaskID != want.TaskID || !reflect.DeepEqual(record.Variables, want.Variables) {
+		t.Errorf("expected %+v, got %+v", want, record)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := store.Delete("order-1/ship"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if record, err := store.Get("order-1/ship"); err != nil || record != nil {
+		t.Errorf("expected the record to be deleted, got %+v, %v", record, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store)
+}
+
+func TestIdempotency_wrap(t *testing.T) {
+	i := &Idempotency{Store: NewMemoryStore(), Key: BusinessKeyActivityKey}
+	task := &camunda.ResLockedExternalTask{
+		TaskBase:    &camunda.TaskBase{ID: "task-1", ActivityID: "ship"},
+		BusinessKey: "order-1",
+	}
+
+	calls := 0
+	handler := func(ctx Context) error {
+		calls++
+		return ctx.Complete(&TaskComplete{Variables: camunda.Variables{"tracking": {Value: "T-1", Type: "String"}}})
+	}
+
+	first := &completeRecorder{ContextImpl: NewContext(nil, task, "worker")}
+	if err := i.wrap(task, handler)(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// the engine created a new task for the same activity
+	retried := &camunda.ResLockedExternalTask{
+		TaskBase:    &camunda.TaskBase{ID: "task-2", ActivityID: "ship"},
+		BusinessKey: "order-1",
+	}
+	second := &completeRecorder{ContextImpl: NewContext(nil, retried, "worker")}
+	if err := i.wrap(retried, handler)(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", calls)
+	}
+
+	if second.completed == nil || second.completed.Variables["tracking"].Value != "T-1" {
+		t.Errorf("expected the recorded completion to be sent again, got %+v", second.completed)
+	}
+}
+
+func TestBusinessKeyActivityKey(t *testing.T) {
+	tests := []struct {
+		task        *camunda.TaskBase
+		businessKey string
+		key         string
+	}{
+		{&camunda.TaskBase{ID: "t", ProcessInstanceID: "p", ActivityID: "a"}, "b", "b/a"},
+		{&camunda.TaskBase{ID: "t", ProcessInstanceID: "p", ActivityID: "a"}, "", "instance:p/a"},
+		{&camunda.TaskBase{ID: "t", ActivityID: "a"}, "", "task:t"},
+	}
+
+	for _, tt := range tests {
+		task := &camunda.ResLockedExternalTask{TaskBase: tt.task, BusinessKey: tt.businessKey}
+		if key := BusinessKeyActivityKey(task); key != tt.key {
+			t.Errorf("expected key %s, got %s", tt.key, key)
+		}
+	}
+}
+
+// failingComplete a context failing the completions with err
+type failingComplete struct {
+	*ContextImpl
+	err error
+}
+
+func (c *failingComplete) Complete(*TaskComplete) error {
+	return c.err
+}
+
+func TestIdempotency_completionFailed(t *testing.T) {
+	task := &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task-1"}}
+
+	calls := 0
+	handler := func(ctx Context) error {
+		calls++
+		return ctx.Complete(&TaskComplete{Variables: camunda.Variables{"tracking": {Value: "T-1", Type: "String"}}})
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		// the engine rejected the completion, the handler runs again
+		{"rejected", &camunda.Error{Type: "ProcessEngineException", Message: "cannot serialize variable"}, 2},
+		// the completion may have been done, the recorded completion is sent again
+		{"no response", errors.New("connection reset"), 1},
+		{"lock expired", ErrLockExpired, 1},
+	}
+
+	for _, test := range tests {
+		calls = 0
+		i := &Idempotency{Store: NewMemoryStore()}
+
+		first := &failingComplete{ContextImpl: NewContext(nil, task, "worker"), err: test.err}
+		if err := i.wrap(task, handler)(first); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected the error of the completion, got %v", test.name, err)
+		}
+
+		second := &completeRecorder{ContextImpl: NewContext(nil, task, "worker")}
+		if err := i.wrap(task, handler)(second); err != nil {
+			t.Fatal(err)
+		}
+
+		if calls != test.wantCalls || second.completed == nil {
+			t.Errorf("%s: expected %d handler runs and a completion, got %d runs, %+v",
+				test.name, test.wantCalls, calls, second.completed)
+		}
+	}
+
+	// a rejected replay deletes the record as well
+	i := &Idempotency{Store: NewMemoryStore()}
+	_ = i.Store.Put(&IdempotencyRecord{Key: task.ID, TaskID: task.ID})
+
+	rejected := &failingComplete{ContextImpl: NewContext(nil, task, "worker"), err: &camunda.Error{Message: "invalid"}}
+	if err := i.wrap(task, handler)(rejected); err == nil {
+		t.Error("expected the error of the completion")
+	}
+
+	if record, _ := i.Store.Get(task.ID); record != nil {
+		t.Errorf("expected the rejected record to be deleted, got %+v", record)
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Outcome a result of a task reported to the engine
+type Outcome string
+
+const (
+	// OutcomeNone the handler returned without reporting a result
+	OutcomeNone Outcome = "none"
+	// OutcomeCompleted the task was completed
+	OutcomeCompleted Outcome = "completed"
+	// OutcomeFailed a failure was reported
+	OutcomeFailed Outcome = "failed"
+	// OutcomeBPMNError a BPMN error was reported
+	OutcomeBPMNError Outcome = "bpmnError"
+)
+
+// Observer receives the lifecycle events of the worker, e.g. for auditing, alerting or analytics.
+// The callbacks are called synchronously from the goroutines of the worker, so they must return quickly
+// and be safe for concurrent use. Embed NopObserver to implement only some of the callbacks
+type Observer interface {
+	// FetchStarted a FetchAndLock request is sent for the topics
+	FetchStarted(topics []string)
+	// FetchFinished the FetchAndLock request returned the number of tasks or an error
+	FetchFinished(topics []string, tasks int, err error)
+	// TaskReceived a locked task is received
+	TaskReceived(task *camunda.ResLockedExternalTask)
+	// HandlerStarted the handler of the task is started
+	HandlerStarted(task *camunda.ResLockedExternalTask)
+	// HandlerFinished the handler of the task returned with the result reported to the engine
+	HandlerFinished(task *camunda.ResLockedExternalTask, outcome Outcome, duration time.Duration)
+	// CompleteSent the completion of the task is sent
+	CompleteSent(task *camunda.ResLockedExternalTask, err error)
+	// FailureSent the failure of the task is sent
+	FailureSent(task *camunda.ResLockedExternalTask, failure TaskFailureRequest, err error)
+	// BPMNErrorSent the BPMN error of the task is sent
+	BPMNErrorSent(task *camunda.ResLockedExternalTask, bpmnErr *BPMNError, err error)
+	// LockExtended the lock of the task is extended by duration
+	LockExtended(task *camunda.ResLockedExternalTask, duration time.Duration, err error)
+	// LockLost the lock extender could not extend the lock of the task
+	LockLost(task *camunda.ResLockedExternalTask, err error)
+	// BackoffEntered the puller sleeps for delay after a failed FetchAndLock request
+	BackoffEntered(topics []string, delay time.Duration, err error)
+}
+
+// NopObserver an Observer ignoring all events
+type NopObserver struct{}
+
+func (NopObserver) FetchStarted([]string)                                                  {}
+func (NopObserver) FetchFinished([]string, int, error)                                     {}
+func (NopObserver) TaskReceived(*camunda.ResLockedExternalTask)                            {}
+func (NopObserver) HandlerStarted(*camunda.ResLockedExternalTask)                          {}
+func (NopObserver) HandlerFinished(*camunda.ResLockedExternalTask, Outcome, time.Duration) {}
+func (NopObserver) CompleteSent(*camunda.ResLockedExternalTask, error)                     {}
+func (NopObserver) FailureSent(*camunda.ResLockedExternalTask, TaskFailureRequest, error)  {}
+func (NopObserver) BPMNErrorSent(*camunda.ResLockedExternalTask, *BPMNError, error)        {}
+func (NopObserver) LockExtended(*camunda.ResLockedExternalTask, time.Duration, error)      {}
+func (NopObserver) LockLost(*camunda.ResLockedExternalTask, error)                         {}
+func (NopObserver) BackoffEntered([]string, time.Duration, error)                          {}
+
+// topicNames returns the names of the topics
+func topicNames(topics []*camunda.TopicLockConfig) []string {
+	names := make([]string, 0, len(topics))
+	for _, t := range topics {
+		names = append(names, t.TopicName)
+	}
+
+	return names
+}
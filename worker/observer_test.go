@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// eventRecorder an Observer recording the events as strings
+type eventRecorder struct {
+	NopObserver
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *eventRecorder) record(format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+// recorded returns the events containing s
+func (o *eventRecorder) recorded(s string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var res []string
+	for _, e := range o.events {
+		if strings.Contains(e, s) {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+func (o *eventRecorder) FetchStarted(topics []string) {
+	o.record("FetchStarted %v", topics)
+}
+
+func (o *eventRecorder) FetchFinished(topics []string, tasks int, err error) {
+	o.record("FetchFinished %v %d %v", topics, tasks, err != nil)
+}
+
+func (o *eventRecorder) TaskReceived(task *camunda.ResLockedExternalTask) {
+	o.record("TaskReceived %s", task.ID)
+}
+
+func (o *eventRecorder) HandlerStarted(task *camunda.ResLockedExternalTask) {
+	o.record("HandlerStarted %s", task.ID)
+}
+
+func (o *eventRecorder) HandlerFinished(task *camunda.ResLockedExternalTask, outcome Outcome, _ time.Duration) {
+	o.record("HandlerFinished %s %s", task.ID, outcome)
+}
+
+func (o *eventRecorder) CompleteSent(task *camunda.ResLockedExternalTask, err error) {
+	o.record("CompleteSent %s %v", task.ID, err)
+}
+
+func (o *eventRecorder) FailureSent(task *camunda.ResLockedExternalTask, failure TaskFailureRequest, err error) {
+	o.record("FailureSent %s %s %v", task.ID, failure.ErrorMessage, err)
+}
+
+func (o *eventRecorder) BackoffEntered(topics []string, delay time.Duration, err error) {
+	o.record("BackoffEntered %v %s %v", topics, delay, err != nil)
+}
+
+func TestObserver(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	obs := &eventRecorder{}
+	w := New(engine.Client(), &Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: 200 * time.Millisecond,
+		Observer:           obs,
+	})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		return ctx.Complete(&TaskComplete{})
+	})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "bill"}}, func(ctx Context) error {
+		return errors.New("card declined")
+	})
+
+	ship := engine.AddExternalTask(fakeengine.ExternalTask{TopicName: "ship"})
+	bill := engine.AddExternalTask(fakeengine.ExternalTask{TopicName: "bill"})
+
+	waitFor(t, "the handlers to finish", func() bool {
+		return len(obs.recorded("HandlerFinished")) == 2
+	})
+
+	tests := map[string][]string{
+		ship.ID: {
+			"TaskReceived " + ship.ID,
+			"HandlerStarted " + ship.ID,
+			"CompleteSent " + ship.ID + " <nil>",
+			"HandlerFinished " + ship.ID + " completed",
+		},
+		bill.ID: {
+			"TaskReceived " + bill.ID,
+			"HandlerStarted " + bill.ID,
+			"FailureSent " + bill.ID + " task error: card declined <nil>",
+			"HandlerFinished " + bill.ID + " failed",
+		},
+	}
+
+	for id, want := range tests {
+		if got := obs.recorded(id); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected the events\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	// the fetch returning the task of ship is started and finished before the task is received
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	started, finished := -1, -1
+	for i, e := range obs.events {
+		switch {
+		case e == "FetchStarted [ship]" && started < 0:
+			started = i
+		case e == "FetchFinished [ship] 1 false" && finished < 0:
+			finished = i
+		case e == "TaskReceived "+ship.ID:
+			if started < 0 || finished < started || i < finished {
+				t.Errorf("expected the fetch events before the task, got %v", obs.events)
+			}
+		}
+	}
+}
+
+func TestObserver_backoff(t *testing.T) {
+	engine := fakeengine.New()
+	engine.Close()
+
+	obs := &eventRecorder{}
+	w := New(engine.Client(), &Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: 200 * time.Millisecond,
+		Observer:           obs,
+	})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error { return nil })
+
+	waitFor(t, "the backoff", func() bool {
+		return len(obs.recorded("BackoffEntered")) > 0
+	})
+
+	want := []string{"FetchStarted [ship]", "FetchFinished [ship] 0 true", "BackoffEntered [ship] 1s true"}
+	if got := obs.recorded("[ship]"); !reflect.DeepEqual(got[:3], want) {
+		t.Errorf("expected the events %v, got %v", want, got)
+	}
+}
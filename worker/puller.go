@@ -0,0 +1,422 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/interticketinc/camunda"
+)
+
+// fetchedTask a task with the engine it came from
+type fetchedTask struct {
+	engine *engine
+	task   *camunda.ResLockedExternalTask
+	// lockExpiration the expiration of the lock on the local clock, zero if unknown
+	lockExpiration time.Time
+}
+
+// route a handler registered for a set of topics
+type route struct {
+	topics  []*camunda.TopicLockConfig
+	handler Handler
+	// batch collects the tasks of a batch handler, nil for single task handlers
+	batch   *batcher
+	options HandlerOptions
+	slots   *slots
+	// pullers the states of the fetch loops serving the route, one per engine
+	pullers []*pullerState
+
+	mu       sync.Mutex
+	inFlight map[string]inFlightTask
+	failures []FailureStatus
+}
+
+func newRoute(topics []*camunda.TopicLockConfig, handler Handler, opts HandlerOptions, s *slots, pullers []*pullerState) *route {
+	return &route{
+		topics:   topics,
+		handler:  handler,
+		options:  opts,
+		slots:    s,
+		pullers:  pullers,
+		inFlight: make(map[string]inFlightTask),
+	}
+}
+
+// fetchLoop fetches and locks tasks of the engine for the routes returned by routes and dispatches them to the handlers.
+// Only routes with free slots take part in a request, so a saturated handler never blocks the others
+func (p *Worker) fetchLoop(e *engine, routes func() []*route, state *pullerState) {
+	defer p.loops.Done()
+	defer atomic.AddInt32(&p.loopsRunning, -1)
+
+	delay := 0
+	offset := 0
+
+	for {
+		if p.isStopped() {
+			return
+		}
+
+		// Capturing the change notification before reserving, so a slot released meanwhile is not missed
+		changed := p.changes()
+
+		rs := routes()
+		reserved, req := p.reserve(e, rs, offset)
+		if req == nil {
+			state.setIdle(true)
+
+			select {
+			case <-changed:
+			case <-p.done:
+				return
+			}
+
+			continue
+		}
+		state.setIdle(false)
+		offset++
+
+		topics := topicNames(req.Topics)
+		p.options.Observer.FetchStarted(topics)
+
+		state.fetchStart()
+		fetched := time.Now()
+		tasks, err := e.client.TaskManager().FetchAndLock(*req)
+		p.options.Observer.FetchFinished(topics, len(tasks), err)
+		atomic.AddInt64(&e.stats.fetches, 1)
+
+		if err != nil {
+			atomic.AddInt64(&e.stats.fetchErrors, 1)
+
+			for r, n := range reserved {
+				r.slots.release(e.index, n)
+			}
+
+			if delay < 60 {
+				delay++
+			}
+
+			bb, _ := json.Marshal(req)
+
+			p.log.Error().Err(err).
+				Str("engine", e.name).
+				RawJSON("req", bb).
+				Msgf("failed to pull message! sleeping: %d seconds", delay)
+			state.fetchDone(err, time.Duration(delay)*time.Second)
+			p.options.Observer.BackoffEntered(topics, time.Duration(delay)*time.Second, err)
+
+			select {
+			case <-time.After(time.Duration(delay) * time.Second):
+			case <-p.done:
+				return
+			}
+
+			continue
+		}
+		delay = 0
+		state.fetchDone(nil, 0)
+
+		if p.isStopped() {
+			for _, task := range tasks {
+				p.unlock(e, task)
+			}
+
+			for r, n := range reserved {
+				r.slots.release(e.index, n)
+			}
+
+			return
+		}
+
+		p.dispatch(e, tasks, rs, reserved, fetched)
+	}
+}
+
+// reserve reserves the free slots of the engine on the routes and builds the request for them.
+// The routes are visited from a rotating offset, so the MaxTasks budget is shared fairly between them.
+// Returns nil request if none of the routes can accept a task
+func (p *Worker) reserve(e *engine, routes []*route, offset int) (map[*route]int, *camunda.FetchAndLockRequest) {
+	reserved := make(map[*route]int, len(routes))
+	budget := p.options.MaxTasks
+	total := 0
+	byTopic := topicRoutes(routes)
+
+	var topics []*camunda.TopicLockConfig
+
+	for i := range routes {
+		r := routes[(offset+i)%len(routes)]
+
+		// The tasks of a topic handled twice go to the first handler, the other one does not request them
+		var active []*camunda.TopicLockConfig
+		for _, t := range p.activeTopics(r) {
+			if byTopic[t.TopicName] == r {
+				active = append(active, t)
+			}
+		}
+
+		if len(active) == 0 {
+			continue
+		}
+
+		n := r.slots.tryAcquire(e.index, budget)
+		if n == 0 {
+			continue
+		}
+
+		reserved[r] = n
+		topics = append(topics, active...)
+		total += n
+
+		if budget > 0 {
+			budget -= n
+			if budget == 0 {
+				break
+			}
+		}
+	}
+
+	if total == 0 {
+		return nil, nil
+	}
+
+	msValue := int(p.options.LongPollingTimeout / time.Millisecond)
+
+	return reserved, &camunda.FetchAndLockRequest{
+		WorkerID:             p.options.WorkerID,
+		MaxTasks:             total,
+		UsePriority:          p.options.UsePriority,
+		AsyncResponseTimeout: &msValue,
+		Topics:               topics,
+	}
+}
+
+// dispatch starts the handlers of the fetched tasks and releases the unused reservations.
+// A task goes to the first of the routes handling its topic, in the order the handlers were added.
+// The engine distributes the tasks arbitrarily among the requested topics, so tasks exceeding
+// the free slots of their handler are unlocked to let them be fetched again. fetched is the start of the request
+func (p *Worker) dispatch(e *engine, tasks []*camunda.ResLockedExternalTask, routes []*route, reserved map[*route]int,
+	fetched time.Time) {
+	byTopic := topicRoutes(routes)
+
+	atomic.AddInt64(&e.stats.received, int64(len(tasks)))
+
+	for _, task := range tasks {
+		p.options.Observer.TaskReceived(task)
+
+		if !p.options.Sharding.owns(task) {
+			p.log.Debug().
+				Str("task", task.ID).
+				Str("businessKey", task.BusinessKey).
+				Msg("task belongs to another shard, unlocking")
+
+			p.unlock(e, task)
+
+			continue
+		}
+
+		r, ok := byTopic[task.TopicName]
+		if !ok || reserved[r] == 0 || p.isPaused(task.TopicName) {
+			p.log.Warn().
+				Str("task", task.ID).
+				Str("topic", task.TopicName).
+				Msg("no free slot for task or topic paused, unlocking")
+
+			p.unlock(e, task)
+
+			continue
+		}
+
+		reserved[r]--
+		r.slots.start(1)
+
+		t := fetchedTask{engine: e, task: task, lockExpiration: r.lockExpiration(task, fetched)}
+
+		if r.batch != nil {
+			r.batch.add(t)
+			continue
+		}
+
+		// Queueing in fetch order, so the tasks of a business key run in the order they were received
+		var turn <-chan struct{}
+		if p.serialized(task) {
+			turn = p.serial.enter(task.BusinessKey)
+		}
+
+		p.running.Add(1)
+		go p.runTask(r, t, turn)
+	}
+
+	// Giving back the slots reserved for tasks not returned by the engine
+	for r, n := range reserved {
+		r.slots.release(e.index, n)
+	}
+}
+
+// topicRoutes returns the route handling each topic, the first route of a topic in the order the handlers were added
+func topicRoutes(routes []*route) map[string]*route {
+	byTopic := make(map[string]*route)
+	for _, r := range routes {
+		for _, t := range r.topics {
+			if _, ok := byTopic[t.TopicName]; !ok {
+				byTopic[t.TopicName] = r
+			}
+		}
+	}
+
+	return byTopic
+}
+
+// unlock gives back a fetched task to the engine
+func (p *Worker) unlock(e *engine, task *camunda.ResLockedExternalTask) {
+	atomic.AddInt64(&e.stats.unlocked, 1)
+
+	if err := e.client.TaskManager().Unlock(task.ID); err != nil {
+		p.log.Error().Err(err).Str("engine", e.name).Str("task", task.ID).Msg("failed to unlock task")
+	}
+}
+
+// serialized reports whether the task has to wait for the other tasks of its business key
+func (p *Worker) serialized(task *camunda.ResLockedExternalTask) bool {
+	return p.options.Sharding != nil && p.options.Sharding.Serialize && task.BusinessKey != ""
+}
+
+// runTask runs the handler of the task. If turn is not nil, the handler waits until it is closed.
+// A task whose lock expired while waiting is skipped, the engine gives it out again
+func (p *Worker) runTask(r *route, t fetchedTask, turn <-chan struct{}) {
+	e, task := t.engine, t.task
+
+	defer p.running.Done()
+	defer r.slots.finish(e.index)
+
+	r.track(t)
+	defer r.untrack(task.ID)
+
+	if turn != nil {
+		<-turn
+		defer p.serial.leave(task.BusinessKey)
+
+		if !t.lockExpiration.IsZero() && !time.Now().Before(t.lockExpiration) {
+			p.log.Warn().
+				Str("task", task.ID).
+				Str("businessKey", task.BusinessKey).
+				Msg("lock of the task expired waiting for its business key, skipping")
+
+			return
+		}
+	}
+
+	handler := r.handler
+	if p.options.Idempotency != nil {
+		handler = p.options.Idempotency.wrap(task, handler)
+	}
+
+	ctx := p.newContext(r, t)
+	defer ctx.cancel()
+
+	if r.options.LockExtension {
+		ctx.StartLockExtender()
+		defer ctx.StopExtender()
+	}
+
+	p.options.Observer.HandlerStarted(task)
+	started := time.Now()
+
+	p.handle(ctx, handler, r.options.RetryPolicy)
+
+	e.stats.outcome(ctx.outcome)
+	p.options.Observer.HandlerFinished(task, ctx.outcome, time.Since(started))
+}
+
+// dumpFailure dumps the failed task if enabled, sendErr is the error of reporting the failure to the engine
+func (p *Worker) dumpFailure(task *camunda.ResLockedExternalTask, failure string, sendErr error) {
+	if p.options.FailureDump == nil {
+		return
+	}
+
+	path, err := p.options.FailureDump.write(task, p.options.WorkerID, failure, sendErr)
+	if err != nil {
+		p.log.Error().Err(err).Str("task", task.ID).Msg("cannot dump failed task")
+		return
+	}
+
+	p.log.Info().Str("task", task.ID).Str("path", path).Msg("failed task dumped")
+}
+
+// newContext creates the context of a task reporting to the engine it came from. The handler context is cancelled
+// before the lock of the task expires, unless the lock extension of the handler is enabled.
+// Call cancel of the context after the handler returned
+func (p *Worker) newContext(r *route, t fetchedTask) *ContextImpl {
+	ctx := NewContext(t.engine.client, t.task, p.options.WorkerID)
+	ctx.observer = p.options.Observer
+	ctx.onFailure = func(query TaskFailureRequest, err error) {
+		if err == nil {
+			r.recordFailure(ctx, query.ErrorMessage)
+		}
+
+		p.dumpFailure(t.task, query.ErrorMessage, err)
+	}
+
+	if r.options.LockExtension {
+		ctx.ctx, ctx.cancel = context.WithCancel(context.Background())
+	} else {
+		ctx.lockExpiration = t.lockExpiration
+		ctx.ctx, ctx.cancel = withDeadline(ctx.lockExpiration, p.options.DeadlineMargin)
+	}
+
+	return ctx
+}
+
+// activeTopics returns the topics of the route which are not paused
+func (p *Worker) activeTopics(r *route) []*camunda.TopicLockConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	active := make([]*camunda.TopicLockConfig, 0, len(r.topics))
+	for _, t := range r.topics {
+		if !p.paused[t.TopicName] {
+			active = append(active, t)
+		}
+	}
+
+	return active
+}
+
+// isStopped checks whether Stop was called
+func (p *Worker) isStopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// changes returns a channel which is closed on the next change of the handler capacities
+func (p *Worker) changes() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.changed
+}
+
+// notifyChange wakes up the pullers waiting for free handler slots
+func (p *Worker) notifyChange() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// snapshotRoutes returns the currently registered routes
+func (p *Worker) snapshotRoutes() []*route {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	routes := make([]*route, len(p.routes))
+	copy(routes, p.routes)
+
+	return routes
+}
@@ -0,0 +1,234 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+// fetchRecorder a transport recording the FetchAndLock requests
+type fetchRecorder struct {
+	mu       sync.Mutex
+	requests []camunda.FetchAndLockRequest
+	// onFetch is called with every request before it is sent
+	onFetch func(req camunda.FetchAndLockRequest)
+}
+
+func (f *fetchRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(r.URL.Path, "/external-task/fetchAndLock") {
+		bb, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(bb))
+
+		var req camunda.FetchAndLockRequest
+		if err := json.Unmarshal(bb, &req); err != nil {
+			return nil, err
+		}
+
+		if f.onFetch != nil {
+			f.onFetch(req)
+		}
+
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+	}
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// fetches returns the recorded requests
+func (f *fetchRecorder) fetches() []camunda.FetchAndLockRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]camunda.FetchAndLockRequest(nil), f.requests...)
+}
+
+// recordedClient returns a client of the engine recording its FetchAndLock requests
+func recordedClient(e *fakeengine.Engine) (*camunda.Client, *fetchRecorder) {
+	rec := &fetchRecorder{}
+	client := e.Client()
+	client.SetCustomTransport(rec)
+
+	return client, rec
+}
+
+// addTasks adds n tasks of the topic
+func addTasks(e *fakeengine.Engine, topic string, n int) {
+	for i := 0; i < n; i++ {
+		e.AddExternalTask(fakeengine.ExternalTask{TopicName: topic})
+	}
+}
+
+// completed returns the number of completed tasks of the topic
+func completed(e *fakeengine.Engine, topic string) int {
+	n := 0
+	for _, t := range e.ExternalTasks() {
+		if t.TopicName == topic && t.State == fakeengine.TaskCompleted {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestWorker_maxTasksWithinFreeSlots(t *testing.T) {
+	const capacity = 3
+
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	var running, peak int64
+	client, rec := recordedClient(engine)
+	rec.onFetch = func(req camunda.FetchAndLockRequest) {
+		if n := atomic.LoadInt64(&running); int64(req.MaxTasks)+n > capacity {
+			t.Errorf("fetching %d tasks while %d of %d slots are busy", req.MaxTasks, n, capacity)
+		}
+	}
+
+	w := New(client, &Options{
+		LockDuration:              time.Minute,
+		LongPollingTimeout:        200 * time.Millisecond,
+		MaxParallelTaskPerHandler: capacity,
+	})
+	defer w.Stop()
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		n := atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	addTasks(engine, "ship", 30)
+	waitFor(t, "the tasks to be completed", func() bool {
+		return completed(engine, "ship") == 30
+	})
+
+	if peak > capacity {
+		t.Errorf("expected at most %d parallel tasks, got %d", capacity, peak)
+	}
+
+	if unlocked := w.Status().Engines[0].TasksUnlocked; unlocked != 0 {
+		t.Errorf("expected no task fetched beyond the free slots, %d unlocked", unlocked)
+	}
+
+	for _, req := range rec.fetches() {
+		if req.MaxTasks < 1 || req.MaxTasks > capacity {
+			t.Errorf("unexpected maxTasks %d", req.MaxTasks)
+		}
+	}
+}
+
+func TestWorker_sharedFetchFairness(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{
+		LockDuration:       time.Minute,
+		LongPollingTimeout: 200 * time.Millisecond,
+		SharedFetch:        true,
+	})
+	defer w.Stop()
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	handler := func(ctx Context) error {
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		order = append(order, ctx.TopicName())
+		mu.Unlock()
+
+		return ctx.Complete(&TaskComplete{})
+	}
+
+	// The tasks of ship come first, so the engine returns them for both topics
+	addTasks(engine, "ship", 10)
+	addTasks(engine, "bill", 10)
+
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, handler)
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "bill"}}, handler)
+
+	waitFor(t, "the tasks to be completed", func() bool {
+		return completed(engine, "ship") == 10 && completed(engine, "bill") == 10
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	bills := 0
+	for _, topic := range order[:10] {
+		if topic == "bill" {
+			bills++
+		}
+	}
+
+	if bills < 3 {
+		t.Errorf("expected the topics to be handled side by side, got %v", order)
+	}
+
+	if unlocked := w.Status().Engines[0].TasksUnlocked; unlocked == 0 {
+		t.Error("expected the tasks beyond the free slots of their handler to be unlocked")
+	}
+}
+
+func TestWorker_sharedFetchDuplicateTopic(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{
+		LockDuration:              time.Minute,
+		LongPollingTimeout:        200 * time.Millisecond,
+		MaxParallelTaskPerHandler: 2,
+		SharedFetch:               true,
+	})
+	defer w.Stop()
+
+	var first, second int64
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		atomic.AddInt64(&first, 1)
+		return ctx.Complete(&TaskComplete{})
+	})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}, {TopicName: "bill"}}, func(ctx Context) error {
+		if ctx.TopicName() == "ship" {
+			atomic.AddInt64(&second, 1)
+		}
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	addTasks(engine, "ship", 10)
+	addTasks(engine, "bill", 2)
+
+	waitFor(t, "the tasks to be completed", func() bool {
+		return completed(engine, "ship") == 10 && completed(engine, "bill") == 2
+	})
+
+	if n := atomic.LoadInt64(&second); n != 0 || atomic.LoadInt64(&first) != 10 {
+		t.Errorf("expected the tasks of ship to go to the first handler, the second one got %d", n)
+	}
+}
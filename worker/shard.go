@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/interticketinc/camunda"
+)
+
+// Sharding distributes the tasks between worker replicas by business key.
+// Each replica processes the tasks whose business key hashes to its shard and unlocks the others
+type Sharding struct {
+	// Index the shard of the replica, from 0 to Count-1
+	Index int
+	// Count number of shards, the replicas must use the same count
+	Count int
+	// Serialize runs the tasks of a business key one at a time in the order they were fetched.
+	// A task waits for its turn while its lock runs, a task whose lock expired meanwhile is skipped
+	// and fetched again. Tasks of batch handlers are not serialized
+	Serialize bool
+}
+
+// validate checks the shard configuration
+func (s *Sharding) validate() error {
+	if s.Count < 1 {
+		return fmt.Errorf("invalid shard count %d", s.Count)
+	}
+
+	if s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("shard index %d out of range [0, %d)", s.Index, s.Count)
+	}
+
+	return nil
+}
+
+// owns reports whether the task belongs to the shard. Tasks without business key belong to every shard
+func (s *Sharding) owns(task *camunda.ResLockedExternalTask) bool {
+	if s == nil || s.Count <= 1 || task.BusinessKey == "" {
+		return true
+	}
+
+	return ShardOf(task.BusinessKey, s.Count) == s.Index
+}
+
+// ShardOf returns the shard of the business key
+func ShardOf(businessKey string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(businessKey))
+
+	return int(h.Sum32() % uint32(count))
+}
+
+// keyQueue runs the holders of a key one at a time in the order they entered
+type keyQueue struct {
+	mu      sync.Mutex
+	waiting map[string][]chan struct{}
+}
+
+// enter queues for the key and returns a channel closed when it is the turn of the caller.
+// Call leave after the work is done
+func (q *keyQueue) enter(key string) <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.waiting == nil {
+		q.waiting = make(map[string][]chan struct{})
+	}
+
+	turn := make(chan struct{})
+	if len(q.waiting[key]) == 0 {
+		close(turn)
+	}
+
+	q.waiting[key] = append(q.waiting[key], turn)
+
+	return turn
+}
+
+// leave passes the turn to the next holder of the key
+func (q *keyQueue) leave(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rest := q.waiting[key][1:]
+	if len(rest) == 0 {
+		delete(q.waiting, key)
+		return
+	}
+
+	q.waiting[key] = rest
+	close(rest[0])
+}
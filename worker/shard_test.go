@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+func TestShardOf(t *testing.T) {
+	counts := make([]int, 4)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("order-%d", i)
+
+		shard := ShardOf(key, len(counts))
+		if shard != ShardOf(key, len(counts)) {
+			t.Fatalf("shard of %s is not stable", key)
+		}
+
+		counts[shard]++
+	}
+
+	for shard, n := range counts {
+		if n < 150 {
+			t.Errorf("shard %d got only %d of 1000 keys", shard, n)
+		}
+	}
+}
+
+func TestSharding_owns(t *testing.T) {
+	task := func(businessKey string) *camunda.ResLockedExternalTask {
+		return &camunda.ResLockedExternalTask{TaskBase: &camunda.TaskBase{ID: "task"}, BusinessKey: businessKey}
+	}
+
+	shards := []*Sharding{{Index: 0, Count: 3}, {Index: 1, Count: 3}, {Index: 2, Count: 3}}
+	for i := 0; i < 100; i++ {
+		owners := 0
+		for _, s := range shards {
+			if s.owns(task(fmt.Sprintf("order-%d", i))) {
+				owners++
+			}
+		}
+
+		if owners != 1 {
+			t.Fatalf("order-%d owned by %d shards", i, owners)
+		}
+	}
+
+	for _, s := range shards {
+		if !s.owns(task("")) {
+			t.Errorf("shard %d does not own a task without business key", s.Index)
+		}
+	}
+
+	var none *Sharding
+	if !none.owns(task("order-1")) {
+		t.Error("no sharding does not own every task")
+	}
+}
+
+func TestSharding_validate(t *testing.T) {
+	for _, s := range []*Sharding{{Index: 0, Count: 0}, {Index: -1, Count: 2}, {Index: 2, Count: 2}} {
+		if s.validate() == nil {
+			t.Errorf("expected %+v to be invalid", s)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the worker not to be created with an invalid sharding")
+		}
+	}()
+
+	New(nil, &Options{Sharding: &Sharding{Index: 3, Count: 2}})
+}
+
+func TestKeyQueue(t *testing.T) {
+	var (
+		q     keyQueue
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+
+	// the holders enter in order, each one waits for the previous one to leave
+	turns := make([]<-chan struct{}, 5)
+	for i := range turns {
+		turns[i] = q.enter("order-1")
+	}
+
+	other := q.enter("order-2")
+	select {
+	case <-other:
+	default:
+		t.Fatal("another key waits for order-1")
+	}
+	q.leave("order-2")
+
+	for i := len(turns) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			<-turns[i]
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			q.leave("order-1")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, n := range order {
+		if i != n {
+			t.Fatalf("expected the holders in the order they entered, got %v", order)
+		}
+	}
+
+	if len(q.waiting) != 0 {
+		t.Errorf("expected no waiting keys, got %v", q.waiting)
+	}
+}
+
+func TestWorker_serializedLockExpired(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	w := New(engine.Client(), &Options{
+		LockDuration:              time.Second,
+		LongPollingTimeout:        200 * time.Millisecond,
+		MaxParallelTaskPerHandler: 2,
+		Sharding:                  &Sharding{Count: 1, Serialize: true},
+	})
+	defer w.Stop()
+
+	var (
+		mu      sync.Mutex
+		calls   int
+		expired []string
+	)
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		if ctx.Ctx().Err() != nil {
+			expired = append(expired, ctx.TaskID())
+		}
+		mu.Unlock()
+
+		// the second task of the business key waits until its lock expired
+		if first {
+			time.Sleep(1500 * time.Millisecond)
+		}
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	for i := 0; i < 2; i++ {
+		engine.AddExternalTask(fakeengine.ExternalTask{TopicName: "ship", BusinessKey: "order-1"})
+	}
+
+	// the tasks are fetched again after their locks expired in the engine
+	waitFor(t, "the tasks to be completed", func() bool {
+		return completed(engine, "ship") == 2
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(expired) != 0 {
+		t.Errorf("expected no handler to start after the lock expired, started for %v", expired)
+	}
+}
@@ -0,0 +1,123 @@
+package worker
+
+import "sync"
+
+// slots a counting semaphore limiting how many tasks a handler runs in parallel.
+// The puller reserves slots before fetching, so tasks are only locked when they can start immediately.
+// The capacity is split between the engines, so an engine long polling with its share reserved
+// does not keep the tasks of the other engines from being fetched
+type slots struct {
+	mu       sync.Mutex
+	capacity int
+	// busy number of reserved slots per engine, including the running ones
+	busy []int
+	// running number of slots occupied by tasks being handled
+	running int
+
+	// onRelease is called when a slot becomes free
+	onRelease func()
+}
+
+func newSlots(capacity, engines int, onRelease func()) *slots {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	if engines < 1 {
+		engines = 1
+	}
+
+	return &slots{
+		capacity:  capacity,
+		busy:      make([]int, engines),
+		onRelease: onRelease,
+	}
+}
+
+// share returns the number of slots of the engine of index i, every engine gets at least one slot.
+// Call with mu held
+func (s *slots) share(i int) int {
+	n := s.capacity / len(s.busy)
+	if i < s.capacity%len(s.busy) {
+		n++
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	return n
+}
+
+// tryAcquire reserves up to max free slots of the engine of index i without blocking.
+// If max is less than 1 all free slots of the engine are reserved
+func (s *slots) tryAcquire(i, max int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.share(i) - s.busy[i]
+	if max > 0 && n > max {
+		n = max
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	s.busy[i] += n
+
+	return n
+}
+
+// release gives back n reserved slots of the engine of index i
+func (s *slots) release(i, n int) {
+	if n <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.busy[i] -= n
+	s.mu.Unlock()
+
+	s.onRelease()
+}
+
+// start marks n reserved slots as occupied by running tasks
+func (s *slots) start(n int) {
+	s.mu.Lock()
+	s.running += n
+	s.mu.Unlock()
+}
+
+// finish frees a slot of the engine of index i occupied by a running task
+func (s *slots) finish(i int) {
+	s.mu.Lock()
+	s.running--
+	s.busy[i]--
+	s.mu.Unlock()
+
+	s.onRelease()
+}
+
+// inFlight returns the number of tasks being handled
+func (s *slots) inFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+// limit returns the maximum number of slots
+func (s *slots) limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.capacity
+}
+
+// setCapacity changes the maximum number of slots
+func (s *slots) setCapacity(capacity int) {
+	s.mu.Lock()
+	s.capacity = capacity
+	s.mu.Unlock()
+}
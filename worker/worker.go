@@ -1,10 +1,13 @@
 package worker
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -19,9 +22,29 @@ const extendDuration = 10
 
 // Worker external task worker
 type Worker struct {
-	client  *camunda.Client
+	// engines the engines the tasks are fetched from
+	engines []*engine
 	options *Options
 	log     zerolog.Logger
+
+	bpmnErrors ErrorRegistry
+
+	mu      sync.Mutex
+	routes  []*route
+	paused  map[string]bool
+	changed chan struct{}
+	shared  sync.Once
+	// serial orders the tasks of a business key if Sharding.Serialize is set
+	serial keyQueue
+
+	// done is closed by Stop, stopped is set with mu held
+	done    chan struct{}
+	stopped bool
+	// loops the running fetch loops, loopsRunning their number for the liveness check
+	loops        sync.WaitGroup
+	loopsRunning int32
+	// running the running handlers and batch collectors
+	running sync.WaitGroup
 }
 
 // Options options for Worker
@@ -30,42 +53,97 @@ type Options struct {
 	WorkerID string `json:"workerId"`
 	// LockDuration lock duration for all external task
 	LockDuration time.Duration
-	// MaxTasks maximum tasks to receive for 1 request to camunda
+	// MaxTasks maximum tasks to receive for 1 request to camunda.
+	// The puller never requests more tasks than the handler has free slots (default: number of free slots)
 	MaxTasks int
-	// MaxParallelTaskPerHandler maximum running parallel task per handler
+	// MaxParallelTaskPerHandler maximum running parallel task per handler (default: 1)
 	MaxParallelTaskPerHandler int
 	// UsePriority use priority
 	UsePriority *bool
 	// LongPollingTimeout long polling timeout
 	LongPollingTimeout time.Duration
+	// SharedFetch fetch the tasks of all handlers with a single FetchAndLock request and route them
+	// to the handlers by topic name, instead of running a long polling request per handler.
+	// Topics of a handler added later are requested after the running long polling request returns
+	SharedFetch bool
+	// Idempotency skips the handler of tasks completed before and sends the recorded completion again
+	Idempotency *Idempotency
+	// Observer receives the lifecycle events of the worker
+	Observer Observer
+	// Sharding processes only the tasks whose business key belongs to the shard of the replica
+	Sharding *Sharding
+	// DeadlineMargin the handler context is cancelled this long before the lock of the task expires,
+	// unless the lock extension of the handler is enabled (default: 10% of the lock duration, at most 5 seconds).
+	// The results reported after the lock expired are not sent to the engine, see ErrLockExpired
+	DeadlineMargin time.Duration
+	// FailureDump dumps the payloads of the tasks failed by a handler to files, see LoadTaskDump
+	FailureDump *FailureDump
 }
 
 // New a create new instance Worker
 func New(client *camunda.Client, options *Options) *Worker {
+	return NewWithEngines([]Engine{{Name: defaultEngine, Client: client}}, options)
+}
+
+// NewWithEngines a constructor of a worker serving the same handlers on several engines.
+// The tasks are fetched from every engine and reported to the engine they came from,
+// the concurrency of a handler is split between the engines, so a long polling request of an engine does not
+// hold the slots needed by the others. Every engine runs at least one task of a handler.
+// Panics if the idempotency or the sharding options are invalid
+func NewWithEngines(engines []Engine, options *Options) *Worker {
+	if options.Idempotency != nil {
+		if err := options.Idempotency.validate(); err != nil {
+			panic(fmt.Sprintf("invalid worker options: %s", err))
+		}
+	}
+
+	if options.Sharding != nil {
+		if err := options.Sharding.validate(); err != nil {
+			panic(fmt.Sprintf("invalid worker options: %s", err))
+		}
+	}
+
 	if options.WorkerID == "" {
 		rand.Seed(time.Now().UnixNano())
 		options.WorkerID = fmt.Sprintf("worker-%d", rand.Int())
 	}
 
-	return &Worker{
-		client:  client,
+	if options.Observer == nil {
+		options.Observer = NopObserver{}
+	}
+
+	w := &Worker{
+		engines: newEngines(engines),
 		options: options,
+		paused:  make(map[string]bool),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
 		log: log.With().
 			Caller().
 			Str("worker", options.WorkerID).
 			Logger(),
 	}
+
+	return w
 }
 
 // Handler a handler for external task
 type Handler func(ctx Context) error
 
+// Context a task passed to a handler, with the methods reporting its result to the engine.
+// The worker passes a *ContextImpl, other implementations e.g. for tests can embed it to get new methods
 type Context interface {
+	// Ctx returns a context cancelled shortly before the lock of the task expires.
+	// Pass it to the downstream calls made by the handler
+	Ctx() context.Context
 	Complete(tc *TaskComplete) error
 	HandleFailure(query TaskFailureRequest) error
 	HandleBPMNError(code int, message string) error
+	ReportBPMNError(e *BPMNError) error
 	ExtendLock(id string, duration int) error
 	Variables() camunda.Variables
+	SetVariables(vars camunda.Variables) error
+	SetLocalVariables(vars camunda.Variables) error
 	StartLockExtender()
 	StopExtender()
 	TaskID() string
@@ -79,6 +157,10 @@ func NewContext(client *camunda.Client, task *camunda.ResLockedExternalTask, wor
 		Task:     task,
 		client:   client,
 		workerID: workerID,
+		observer: NopObserver{},
+		outcome:  OutcomeNone,
+		ctx:      context.Background(),
+		cancel:   func() {},
 	}
 }
 
@@ -88,10 +170,42 @@ type ContextImpl struct {
 	client   *camunda.Client
 	workerID string
 
+	observer Observer
+	// outcome the last result reported to the engine
+	outcome Outcome
+	// ctx the handler context with the lock deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+	// lockExpiration the results are not reported after it, zero if the lock is extended
+	lockExpiration time.Time
+	// onFailure is called with the failures reported by HandleFailure and the error of sending them
+	onFailure func(query TaskFailureRequest, err error)
+
 	// Extender stop channel
 	done chan interface{}
 }
 
+// lockedTask returns the task of the context
+func (c *ContextImpl) lockedTask() *camunda.ResLockedExternalTask {
+	return c.Task
+}
+
+// taskOf returns the task of a context created by the worker, or nil for other implementations
+func taskOf(ctx Context) *camunda.ResLockedExternalTask {
+	if c, ok := ctx.(interface {
+		lockedTask() *camunda.ResLockedExternalTask
+	}); ok {
+		return c.lockedTask()
+	}
+
+	return nil
+}
+
+// Ctx returns the context of the handler
+func (c *ContextImpl) Ctx() context.Context {
+	return c.ctx
+}
+
 func (c *ContextImpl) TaskID() string {
 	return c.Task.ID
 }
@@ -108,34 +222,97 @@ func (c *ContextImpl) Retries() int {
 	return c.Task.Retries
 }
 
-// Complete a mark external task is complete
+// Complete a mark external task is complete.
+// Returns ErrLockExpired without completing the task if its lock expired
 func (c *ContextImpl) Complete(tc *TaskComplete) error {
+	if err := c.lockExpired(); err != nil {
+		return err
+	}
+
 	tm := c.client.TaskManager()
-	return tm.Complete(c.Task.ID, camunda.QueryComplete{
+	err := tm.Complete(c.Task.ID, camunda.QueryComplete{
 		WorkerID:       &c.Task.WorkerID,
 		Variables:      tc.Variables,
 		LocalVariables: tc.LocalVariables,
 	})
+	c.observer.CompleteSent(c.Task, err)
+
+	if err == nil {
+		c.outcome = OutcomeCompleted
+	}
+
+	return err
+}
+
+// SetVariables updates variables of the process instance while the task is running
+func (c *ContextImpl) SetVariables(vars camunda.Variables) error {
+	return c.client.ProcessManager().ModifyInstanceVars(c.Task.ProcessInstanceID, camunda.ReqModifyVariables{
+		Modifications: vars,
+	})
+}
+
+// SetLocalVariables updates variables in the execution scope of the task while it is running
+func (c *ContextImpl) SetLocalVariables(vars camunda.Variables) error {
+	return c.client.ExecutionManager().ModifyLocalVars(c.Task.ExecutionID, camunda.ReqModifyVariables{
+		Modifications: vars,
+	})
 }
 
 // HandleFailure handle external task failure
 func (c *ContextImpl) HandleFailure(query TaskFailureRequest) error {
-	return c.client.TaskManager().TaskFailed(c.Task.ID, camunda.Failure{
+	if err := c.lockExpired(); err != nil {
+		return err
+	}
+
+	err := c.client.TaskManager().TaskFailed(c.Task.ID, camunda.Failure{
 		WorkerID:     c.Task.WorkerID,
 		ErrorMessage: query.ErrorMessage,
 		ErrorDetails: query.ErrorDetails,
 		Retries:      query.Retries,
 		RetryTimeout: query.RetryTimeout,
 	})
+	c.observer.FailureSent(c.Task, query, err)
+
+	if c.onFailure != nil {
+		c.onFailure(query, err)
+	}
+
+	if err == nil {
+		c.outcome = OutcomeFailed
+	}
+
+	return err
 }
 
 // HandleBPMNError handle external task failure
+//
+// Deprecated: BPMN error codes are strings, use ReportBPMNError or return a *BPMNError from the handler
 func (c *ContextImpl) HandleBPMNError(code int, message string) error {
-	return c.client.TaskManager().HandleBPMNError(c.Task.ID, camunda.QueryHandleBPMNError{
+	return c.ReportBPMNError(&BPMNError{
+		Code:    strconv.Itoa(code),
+		Message: message,
+	})
+}
+
+// ReportBPMNError reports a business error of the external task
+func (c *ContextImpl) ReportBPMNError(e *BPMNError) error {
+	if err := c.lockExpired(); err != nil {
+		return err
+	}
+
+	err := c.client.TaskManager().HandleBPMNError(c.Task.ID, camunda.QueryHandleBPMNError{
 		WorkerID:     c.Task.WorkerID,
-		ErrorMessage: message,
-		ErrorCode:    strconv.Itoa(code),
+		ErrorMessage: e.Message,
+		ErrorCode:    e.Code,
+		Variables:    e.Variables,
 	})
+	c.observer.BPMNErrorSent(c.Task, e, err)
+
+	if err == nil {
+		c.outcome = OutcomeBPMNError
+	}
+
+	return err
 }
 
 // ExtendLock extending lock on specific task ID
@@ -145,6 +322,8 @@ func (c *ContextImpl) ExtendLock(id string, duration int) error {
 		NewDuration: duration,
 		WorkerID:    c.workerID,
 	})
+	c.observer.LockExtended(c.Task, time.Duration(duration)*time.Millisecond, err)
+
 	if err != nil {
 		return fmt.Errorf("error while extending lock: %w", err)
 	}
@@ -171,6 +350,7 @@ func (c *ContextImpl) StartLockExtender() {
 				err := c.ExtendLock(c.Task.ID, extendDuration*1000)
 				if err != nil {
 					log.Err(err).Msg("failed to extend lock")
+					c.observer.LockLost(c.Task, err)
 					return
 				}
 			case <-c.done:
@@ -189,8 +369,65 @@ func (c *ContextImpl) StopExtender() {
 	}
 }
 
+// HandlerOptions options for a handler
+type HandlerOptions struct {
+	// Concurrency maximum running parallel task of the handler (default: Options.MaxParallelTaskPerHandler)
+	Concurrency int
+	// RetryPolicy retries of the tasks failed by the handler (default: no retry, an incident is created)
+	RetryPolicy *RetryPolicy
+	// LockExtension extends the lock of the tasks while the handler runs
+	LockExtension bool
+}
+
+// RetryPolicy a policy for retrying failed tasks
+type RetryPolicy struct {
+	// Retries number of retries after the first failure of a task
+	Retries int
+	// Timeout before a failed task can be fetched again
+	Timeout time.Duration
+}
+
+// failure builds the failure request of the task. The first failure of the task sets the retries of the policy,
+// the next ones decrease the retries left. Without policy no retries are set, so an incident is created
+func (rp *RetryPolicy) failure(ctx Context, message, details string) TaskFailureRequest {
+	req := TaskFailureRequest{
+		ErrorMessage: message,
+		ErrorDetails: details,
+	}
+
+	if rp == nil {
+		return req
+	}
+
+	// The engine returns no retries for a task which never failed before
+	req.Retries = rp.Retries
+	if ctx.Retries() > 0 {
+		req.Retries = ctx.Retries() - 1
+	}
+
+	if req.Retries > 0 {
+		req.RetryTimeout = int(rp.Timeout / time.Millisecond)
+	}
+
+	return req
+}
+
 // AddHandler a add handler for external task
 func (p *Worker) AddHandler(topics []*camunda.TopicLockConfig, handler Handler) {
+	p.AddHandlerWithOptions(topics, handler, HandlerOptions{})
+}
+
+// AddHandlerWithOptions a add handler for external task with handler specific options
+func (p *Worker) AddHandlerWithOptions(topics []*camunda.TopicLockConfig, handler Handler, opts HandlerOptions) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = p.options.MaxParallelTaskPerHandler
+	}
+
+	p.addRoute(topics, handler, nil, opts)
+}
+
+// addRoute registers the handler or the batcher of the topics and starts fetching their tasks
+func (p *Worker) addRoute(topics []*camunda.TopicLockConfig, handler Handler, b *batcher, opts HandlerOptions) *route {
 	if topics != nil && p.options.LockDuration != 0 {
 		for i := range topics {
 			v := topics[i]
@@ -201,74 +438,146 @@ func (p *Worker) AddHandler(topics []*camunda.TopicLockConfig, handler Handler)
 		}
 	}
 
-	var asyncResponseTimeout *int
-	msValue := int(p.options.LongPollingTimeout.Nanoseconds() / int64(time.Millisecond))
-	asyncResponseTimeout = &msValue
+	pullers := make([]*pullerState, len(p.engines))
+	for i, e := range p.engines {
+		pullers[i] = &pullerState{}
+		if p.options.SharedFetch {
+			pullers[i] = e.sharedPuller
+		}
+	}
 
-	go p.startPuller(camunda.FetchAndLockRequest{
-		WorkerID:             p.options.WorkerID,
-		MaxTasks:             p.options.MaxTasks,
-		UsePriority:          p.options.UsePriority,
-		AsyncResponseTimeout: asyncResponseTimeout,
-		Topics:               topics,
-	}, handler)
-}
+	r := newRoute(topics, handler, opts, newSlots(opts.Concurrency, len(p.engines), p.notifyChange), pullers)
+	r.batch = b
+
+	p.mu.Lock()
+	if p.options.SharedFetch {
+		for _, registered := range p.routes {
+			for _, t := range registered.topics {
+				for _, v := range topics {
+					if t.TopicName == v.TopicName {
+						p.log.Warn().Str("topic", v.TopicName).
+							Msg("topic is already handled, tasks are routed to the first handler")
+					}
+				}
+			}
+		}
+	}
+	p.routes = append(p.routes, r)
+
+	stopped := p.stopped
+	if !stopped {
+		if b != nil {
+			p.running.Add(1)
+		}
 
-func (p *Worker) startPuller(req camunda.FetchAndLockRequest, handler Handler) {
-	tasksChan := make(chan *camunda.ResLockedExternalTask)
+		if !p.options.SharedFetch {
+			p.startLoops()
+		}
+	}
+	p.mu.Unlock()
 
-	maxParallelTaskPerHandler := p.options.MaxParallelTaskPerHandler
-	if maxParallelTaskPerHandler < 1 {
-		maxParallelTaskPerHandler = 1
+	if stopped {
+		p.log.Warn().Strs("topics", topicNames(topics)).Msg("worker is stopped, the handler is not started")
+		return r
 	}
 
-	// create worker pool
-	for i := 0; i < maxParallelTaskPerHandler; i++ {
-		go p.runWorker(handler, tasksChan)
+	if b != nil {
+		go b.collect()
 	}
 
-	delay := 0
+	if p.options.SharedFetch {
+		p.shared.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
 
-	for {
-		tasks, err := p.client.TaskManager().FetchAndLock(req)
-		if err != nil {
-			if delay < 60 {
-				delay++
+			if p.stopped {
+				return
 			}
 
-			bb, _ := json.Marshal(req)
+			p.startLoops()
+			for _, e := range p.engines {
+				go p.fetchLoop(e, p.snapshotRoutes, e.sharedPuller)
+			}
+		})
 
-			p.log.Error().Err(err).
-				RawJSON("req", bb).
-				Msgf("failed to pull message! sleeping: %d seconds", delay)
-			time.Sleep(time.Duration(delay) * time.Second)
+		// Waking up the shared puller if it waits for free slots
+		p.notifyChange()
 
-			continue
-		}
-		delay = 0
+		return r
+	}
+
+	for i, e := range p.engines {
+		go p.fetchLoop(e, func() []*route {
+			return []*route{r}
+		}, pullers[i])
+	}
+
+	return r
+}
+
+// startLoops counts the fetch loops started for every engine, call with mu held
+func (p *Worker) startLoops() {
+	p.loops.Add(len(p.engines))
+	atomic.AddInt32(&p.loopsRunning, int32(len(p.engines)))
+}
+
+// Stop stops fetching tasks and waits until the handlers of the fetched tasks finished.
+// A FetchAndLock request in progress cannot be cancelled, so Stop blocks until it returns,
+// up to LongPollingTimeout, and the tasks it returns are unlocked. Handlers added after Stop are not started
+func (p *Worker) Stop() {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.done)
+	p.mu.Unlock()
+
+	p.loops.Wait()
 
-		for _, task := range tasks {
-			tasksChan <- task
+	// No task is dispatched anymore, the batch collectors run the collected tasks and return
+	for _, r := range p.snapshotRoutes() {
+		if r.batch != nil {
+			close(r.batch.tasks)
 		}
 	}
+
+	p.running.Wait()
 }
 
-func (p *Worker) runWorker(handler Handler, tasksChan chan *camunda.ResLockedExternalTask) {
-	for task := range tasksChan {
-		ctx := NewContext(p.client, task, p.options.WorkerID)
-		p.handle(ctx, handler)
+// MapBPMNError reports the handler errors matching target (see errors.Is) as BPMN error with the given code
+func (p *Worker) MapBPMNError(target error, code string) {
+	p.bpmnErrors.Register(target, code)
+}
+
+// MapBPMNErrorType reports the handler errors of the same type as example as BPMN error with the given code
+func (p *Worker) MapBPMNErrorType(example error, code string) {
+	p.bpmnErrors.RegisterType(example, code)
+}
+
+// BPMNErrors returns the registry mapping the handler errors to BPMN errors
+func (p *Worker) BPMNErrors() *ErrorRegistry {
+	return &p.bpmnErrors
+}
+
+// QueueDepth returns the number of tasks locked by the worker which are not finished yet
+func (p *Worker) QueueDepth() int {
+	depth := 0
+	for _, r := range p.snapshotRoutes() {
+		depth += r.slots.inFlight()
 	}
+
+	return depth
 }
 
-func (p *Worker) handle(ctx Context, handler Handler) {
+// handle runs the handler and reports its result to the engine
+func (p *Worker) handle(ctx Context, handler Handler, retry *RetryPolicy) {
 	defer func() {
 		if r := recover(); r != nil {
 			errMessage := fmt.Sprintf("fatal error in task: %s", r)
 			errDetails := fmt.Sprintf("fatal error in task: %s\nStack trace: %s", r, string(debug.Stack()))
-			err := ctx.HandleFailure(TaskFailureRequest{
-				ErrorMessage: errMessage,
-				ErrorDetails: errDetails,
-			})
+			err := ctx.HandleFailure(retry.failure(ctx, errMessage, errDetails))
 			if err != nil {
 				p.log.Error().
 					Err(err).
@@ -279,17 +588,45 @@ func (p *Worker) handle(ctx Context, handler Handler) {
 		}
 	}()
 
-	err := handler(ctx)
+	p.report(ctx, timeoutError(ctx, handler(ctx)), retry)
+}
+
+// report reports the error returned for the task to the engine, as BPMN error if it is one
+// or it is mapped to one, otherwise as failure. Errors having an ErrorDetails() string method
+// report their details with the failure. Nothing is reported for nil error, or if the lock of the task expired
+func (p *Worker) report(ctx Context, err error, retry *RetryPolicy) {
+	if err == nil {
+		return
+	}
+
+	err = reportError(ctx, err, &p.bpmnErrors, retry)
+
+	if errors.Is(err, ErrLockExpired) {
+		p.log.Warn().Err(err).Msg("task result not reported, the task is fetched again")
+		return
+	}
+
 	if err != nil {
-		msg := fmt.Sprintf("task error: %s", err)
-		err = ctx.HandleFailure(TaskFailureRequest{
-			ErrorMessage: msg,
-		})
+		p.log.Error().
+			Err(err).
+			Msg("error send task result")
+	}
+}
 
-		if err != nil {
-			p.log.Error().
-				Err(err).
-				Msg("error send handle failure")
-		}
+// reportError reports the error as BPMN error or failure, returns the error of sending the report
+func reportError(ctx Context, err error, registry *ErrorRegistry, retry *RetryPolicy) error {
+	if bpmnErr, ok := registry.Resolve(err); ok {
+		return ctx.ReportBPMNError(bpmnErr)
 	}
+
+	var details string
+
+	var detailed interface{ ErrorDetails() string }
+	if errors.As(err, &detailed) {
+		details = detailed.ErrorDetails()
+	}
+
+	msg := fmt.Sprintf("task error: %s", err)
+
+	return ctx.HandleFailure(retry.failure(ctx, msg, details))
 }
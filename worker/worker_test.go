@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/interticketinc/camunda"
+	"github.com/interticketinc/camunda/camtest/fakeengine"
+)
+
+const shipProcess = `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" id="definitions">
+  <bpmn:process id="ship" isExecutable="true">
+    <bpmn:startEvent id="start" />
+  </bpmn:process>
+</bpmn:definitions>`
+
+func TestContextImpl_SetVariables(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	if _, err := engine.Deploy("ship", map[string][]byte{"ship.bpmn": []byte(shipProcess)}); err != nil {
+		t.Fatal(err)
+	}
+
+	inst, err := engine.StartInstance("ship", "order-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.AddExternalTask(fakeengine.ExternalTask{
+		TopicName:         "ship",
+		ProcessInstanceID: inst.ID,
+		ExecutionID:       "execution-1",
+	})
+
+	w := New(engine.Client(), &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+	defer w.Stop()
+
+	errs := make(chan error, 2)
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		errs <- ctx.SetVariables(camunda.Variables{"status": {Value: "packed", Type: "String"}})
+		errs <- ctx.SetLocalVariables(camunda.Variables{"parcel": {Value: "P-1", Type: "String"}})
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "the task to be completed", func() bool {
+		return completed(engine, "ship") == 1
+	})
+
+	if got, _ := engine.Instance(inst.ID); got.Variables["status"] == nil || got.Variables["status"].Value != "packed" {
+		t.Errorf("expected the instance variable to be set, got %v", got.Variables)
+	}
+
+	if local := engine.LocalVariables("execution-1"); local["parcel"] == nil || local["parcel"].Value != "P-1" {
+		t.Errorf("expected the local variable to be set, got %v", local)
+	}
+
+	if got, _ := engine.Instance(inst.ID); got.Variables["parcel"] != nil {
+		t.Error("expected the local variable not to be set on the instance")
+	}
+}
+
+func TestWorker_Stop(t *testing.T) {
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	client, rec := recordedClient(engine)
+	w := New(client, &Options{LockDuration: time.Minute, LongPollingTimeout: 200 * time.Millisecond})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error {
+		close(started)
+		<-release
+
+		return ctx.Complete(&TaskComplete{})
+	})
+
+	addTasks(engine, "ship", 1)
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after the handler finished")
+	}
+
+	if completed(engine, "ship") != 1 {
+		t.Error("expected the handler to complete the task before Stop returned")
+	}
+
+	// a stopped worker starts no fetch loop
+	fetches := len(rec.fetches())
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "bill"}}, func(ctx Context) error { return nil })
+	w.Stop()
+
+	if n := len(rec.fetches()); n != fetches {
+		t.Errorf("expected no fetch after Stop, got %d", n-fetches)
+	}
+}
+
+func TestWorker_Stop_longPolling(t *testing.T) {
+	const longPolling = 500 * time.Millisecond
+
+	engine := fakeengine.New()
+	defer engine.Close()
+
+	client, rec := recordedClient(engine)
+	w := New(client, &Options{LockDuration: time.Minute, LongPollingTimeout: longPolling})
+	w.AddHandler([]*camunda.TopicLockConfig{{TopicName: "ship"}}, func(ctx Context) error { return nil })
+
+	waitFor(t, "the long polling request", func() bool {
+		return len(rec.fetches()) > 0
+	})
+
+	// the request in progress cannot be cancelled, Stop waits for it
+	started := time.Now()
+	w.Stop()
+
+	if elapsed := time.Since(started); elapsed > longPolling+time.Second {
+		t.Errorf("expected Stop to return after the long polling request, took %s", elapsed)
+	}
+}